@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseAndroidDocument finds the translatable <string>, <plurals> and <string-array>
+// values of an Android strings.xml file. Resources marked translatable="false" are
+// skipped and the XML comment in front of a resource is passed on as context.
+//
+// Values keep their inline markup (<b>, <xliff:g>) and are identified by the resource
+// name, "name#quantity" for plurals and "name[index]" for string arrays.
+func parseAndroidDocument(data []byte) (*spliceDocument, error) {
+	doc := &spliceDocument{data: data, escape: escapeAndroidString}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		depth        int
+		comment      string // last comment seen at resource level
+		resource     string // name of the enclosing <plurals> or <string-array>
+		resourceNote string
+		skip         bool // enclosing resource is not translatable
+		itemIndex    int
+		open         *spliceRange // value whose end tag has not been read yet
+		openDepth    int
+	)
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse strings.xml: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.Comment:
+			if depth == 1 {
+				comment = strings.TrimSpace(string(t))
+			}
+		case xml.StartElement:
+			depth++
+			if open != nil {
+				continue
+			}
+			name := t.Name.Local
+			switch {
+			case depth == 2 && (name == "string" || name == "plurals" || name == "string-array"):
+				resourceNote = comment
+				comment = ""
+				skip = androidAttr(t, "translatable") == "false"
+				resource = androidAttr(t, "name")
+				itemIndex = 0
+				if name == "string" && !skip {
+					open = &spliceRange{start: int(decoder.InputOffset()), path: resource, context: resourceNote}
+					openDepth = depth
+				}
+			case depth == 3 && name == "item" && !skip && resource != "":
+				path := fmt.Sprintf("%s[%d]", resource, itemIndex)
+				note := resourceNote
+				if quantity := androidAttr(t, "quantity"); quantity != "" {
+					path = resource + "#" + quantity
+					note = fmt.Sprintf("plural form %q", quantity)
+					if resourceNote != "" {
+						note += ", " + resourceNote
+					}
+				}
+				itemIndex++
+				open = &spliceRange{start: int(decoder.InputOffset()), path: path, context: note}
+				openDepth = depth
+			}
+		case xml.EndElement:
+			if open != nil && depth == openDepth {
+				open.end = offset
+				open.value = unescapeAndroidString(string(data[open.start:open.end]))
+				if strings.TrimSpace(open.value) != "" {
+					doc.ranges = append(doc.ranges, *open)
+				}
+				open = nil
+			}
+			if depth == 2 {
+				resource, skip = "", false
+			}
+			depth--
+		}
+	}
+	return doc, nil
+}
+
+func androidAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// unescapeAndroidString removes the backslash escapes aapt applies to quotes so the model
+// sees plain text. Markup and XML entities are left as they are.
+func unescapeAndroidString(s string) string {
+	return strings.NewReplacer(`\'`, `'`, `\"`, `"`, `\@`, `@`, `\?`, `?`).Replace(s)
+}
+
+// escapeAndroidString escapes apostrophes and double quotes outside of tags, and a
+// leading @ or ?, which aapt would otherwise interpret.
+func escapeAndroidString(s string) string {
+	var sb strings.Builder
+	inTag := false
+	for i, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag && (r == '\'' || r == '"') && (i == 0 || s[i-1] != '\\'):
+			sb.WriteByte('\\')
+		case i == 0 && (r == '@' || r == '?'):
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
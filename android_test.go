@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const androidStrings = `<?xml version="1.0" encoding="utf-8"?>
+<resources xmlns:xliff="urn:oasis:names:tc:xliff:document:1.2">
+    <!-- Button that saves the form -->
+    <string name="save">Save</string>
+    <string name="app_id" translatable="false">Save</string>
+    <string name="greeting">Hello, <b><xliff:g id="user">%1$s</xliff:g></b>! It\'s \"here\".</string>
+    <string name="blank"> </string>
+    <plurals name="files">
+        <item quantity="one">%d file</item>
+        <item quantity="other">%d files</item>
+    </plurals>
+    <string-array name="actions">
+        <item>Save</item>
+        <item>Cancel</item>
+    </string-array>
+</resources>
+`
+
+// i18nEntry is an i18nString without its setter, to compare parsed documents.
+type i18nEntry struct {
+	path, value, context string
+}
+
+func i18nEntries(doc i18nDocument) []i18nEntry {
+	var entries []i18nEntry
+	for _, s := range doc.strings() {
+		entries = append(entries, i18nEntry{s.path, s.value, s.context})
+	}
+	return entries
+}
+
+func TestParseAndroidDocument(t *testing.T) {
+	doc, err := parseAndroidDocument([]byte(androidStrings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []i18nEntry{
+		{"save", "Save", "Button that saves the form"},
+		{"greeting", `Hello, <b><xliff:g id="user">%1$s</xliff:g></b>! It's "here".`, ""},
+		{"files#one", "%d file", `plural form "one"`},
+		{"files#other", "%d files", `plural form "other"`},
+		{"actions[0]", "Save", ""},
+		{"actions[1]", "Cancel", ""},
+	}
+	if got := i18nEntries(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAndroidDocument =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestParseAndroidDocumentInvalid(t *testing.T) {
+	if _, err := parseAndroidDocument([]byte(`<resources><string name="a>Save</string></resources>`)); err == nil {
+		t.Error("parseAndroidDocument did not fail on an unterminated attribute")
+	}
+}
+
+func TestEscapeAndroidString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Save", "Save"},
+		{"It's", `It\'s`},
+		{`Say "hi"`, `Say \"hi\"`},
+		{`<a href="x">Link</a>`, `<a href="x">Link</a>`},
+		{"@home", `\@home`},
+		{"?", `\?`},
+		{`Already \'escaped\'`, `Already \'escaped\'`},
+	}
+	for _, tt := range tests {
+		if got := escapeAndroidString(tt.in); got != tt.want {
+			t.Errorf("escapeAndroidString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateI18nAndroid(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	got, err := agent.TranslateI18n(context.Background(), []byte(androidStrings), I18nAndroidXML, I18nOptions{SourceLang: "English", TargetLang: "German"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="utf-8"?>
+<resources xmlns:xliff="urn:oasis:names:tc:xliff:document:1.2">
+    <!-- Button that saves the form -->
+    <string name="save">Speichern</string>
+    <string name="app_id" translatable="false">Save</string>
+    <string name="greeting">Hallo, <b><xliff:g id="user">%1$s</xliff:g></b>! It\'s \"here\".</string>
+    <string name="blank"> </string>
+    <plurals name="files">
+        <item quantity="one">%d Datei</item>
+        <item quantity="other">%d Dateien</item>
+    </plurals>
+    <string-array name="actions">
+        <item>Speichern</item>
+        <item>Abbrechen</item>
+    </string-array>
+</resources>
+`
+	if string(got) != want {
+		t.Errorf("TranslateI18n =\n%s\nwant\n%s", got, want)
+	}
+}
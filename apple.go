@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// parseAppleStringsDocument finds the values of a Localizable.strings file, which is a
+// list of `"key" = "value";` pairs. The comment in front of a pair is passed on as
+// context. UTF-16 files, which older Xcode versions write, are converted back on encode.
+func parseAppleStringsDocument(data []byte) (*spliceDocument, error) {
+	text, output := decodeAppleStrings(data)
+	doc := &spliceDocument{data: text, escape: escapeAppleString, output: output}
+
+	var comment, key string
+	expectValue := false
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == ' ' || text[i] == '\t' || text[i] == '\r' || text[i] == '\n':
+			i++
+		case bytes.HasPrefix(text[i:], []byte("/*")):
+			end := bytes.Index(text[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("parse strings: unterminated comment at offset %d", i)
+			}
+			comment = strings.TrimSpace(string(text[i+2 : i+2+end]))
+			i += end + 4
+		case bytes.HasPrefix(text[i:], []byte("//")):
+			end := bytes.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			comment = strings.TrimSpace(string(text[i+2 : i+end]))
+			i += end
+		case text[i] == '"':
+			end, err := appleStringEnd(text, i+1)
+			if err != nil {
+				return nil, err
+			}
+			value := unescapeAppleString(string(text[i+1 : end]))
+			if expectValue {
+				doc.ranges = append(doc.ranges, spliceRange{start: i + 1, end: end, path: key, value: value, context: comment})
+				comment, expectValue = "", false
+			} else {
+				key = value
+			}
+			i = end + 1
+		case text[i] == '=':
+			expectValue = true
+			i++
+		case text[i] == ';':
+			expectValue = false
+			i++
+		default:
+			// unquoted keys are allowed for plain identifiers
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\r\n=;\"", rune(text[i])) {
+				i++
+			}
+			key = string(text[start:i])
+		}
+	}
+	return doc, nil
+}
+
+// appleStringEnd returns the offset of the closing quote of a string starting at start.
+func appleStringEnd(text []byte, start int) (int, error) {
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("parse strings: unterminated string at offset %d", start-1)
+}
+
+// decodeAppleStrings converts a UTF-16 file to UTF-8 and returns a function that converts
+// the translated file back to the original encoding.
+func decodeAppleStrings(data []byte) ([]byte, func([]byte) []byte) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	default:
+		return data, nil
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	text := []byte(string(utf16.Decode(units)))
+	return text, func(b []byte) []byte {
+		encoded := utf16.Encode([]rune(string(b)))
+		out := make([]byte, 2+2*len(encoded))
+		order.PutUint16(out, 0xFEFF)
+		for i, unit := range encoded {
+			order.PutUint16(out[2+2*i:], unit)
+		}
+		return out
+	}
+}
+
+func unescapeAppleString(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'U', 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+					sb.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+func escapeAppleString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+}
+
+// stringsDictCategories are the plural categories a .stringsdict rule can define.
+var stringsDictCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// parseStringsDictDocument finds the plural forms of a .stringsdict plist, together with
+// the NSStringLocalizedFormatKey of an entry when it contains text around its variables.
+// Values are identified as "entry/variable/category".
+func parseStringsDictDocument(data []byte) (*spliceDocument, error) {
+	doc := &spliceDocument{data: data, escape: escapeXMLText}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		dicts []string // key of each enclosing <dict>
+		key   string   // last <key> read in the innermost dict
+		inKey bool
+		open  *spliceRange
+	)
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse stringsdict: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "dict":
+				dicts = append(dicts, key)
+				key = ""
+			case "key":
+				inKey, key = true, ""
+			case "string":
+				if len(dicts) < 2 || !(stringsDictCategories[key] || key == "NSStringLocalizedFormatKey") {
+					continue
+				}
+				path := strings.Join(append(dicts[1:len(dicts):len(dicts)], key), "/")
+				context := fmt.Sprintf("plural form %q of %s", key, dicts[1])
+				if key == "NSStringLocalizedFormatKey" {
+					context = "format of " + dicts[1] + ", keep the %#@variable@ references"
+				}
+				open = &spliceRange{start: int(decoder.InputOffset()), path: path, context: context}
+			}
+		case xml.CharData:
+			if inKey {
+				key += string(t)
+			} else if open != nil {
+				open.value += string(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "dict":
+				dicts = dicts[:len(dicts)-1]
+				key = ""
+			case "key":
+				inKey = false
+			case "string":
+				if open != nil {
+					open.end = offset
+					if hasTranslatableText(open.value) {
+						doc.ranges = append(doc.ranges, *open)
+					}
+					open = nil
+				}
+				key = ""
+			}
+		}
+	}
+	return doc, nil
+}
+
+// hasTranslatableText reports whether s has letters outside of its placeholders.
+func hasTranslatableText(s string) bool {
+	protector, _ := newPlaceholderProtector(DefaultPlaceholderPatterns)
+	s = placeholderToken.ReplaceAllString(protector.protect(s), "")
+	for _, r := range s {
+		if r >= utf8.RuneSelf || (r|0x20 >= 'a' && r|0x20 <= 'z') {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeXMLText escapes only what character data requires, unlike xml.EscapeText which
+// also escapes quotes and newlines that plist editors keep literal.
+func escapeXMLText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// xcstringsDocument adds the target localization to every entry of a String Catalog that
+// has not been translated yet. Variations such as plural forms are copied from the
+// source localization and each of their string units is translated.
+type xcstringsDocument struct {
+	*jsonDocument
+	pending []i18nString
+}
+
+func parseXCStringsDocument(data []byte, targetLocale string) (*xcstringsDocument, error) {
+	if targetLocale == "" {
+		return nil, fmt.Errorf("string catalogs need a target locale")
+	}
+	jsonDoc, err := parseJSONDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := &xcstringsDocument{jsonDocument: jsonDoc}
+	sourceLocale := ""
+	if node := jsonDoc.root.get("sourceLanguage"); node != nil {
+		sourceLocale = node.str
+	}
+	entries := jsonDoc.root.get("strings")
+	if entries == nil {
+		return doc, nil
+	}
+
+	for _, member := range entries.object {
+		entry := member.value
+		if node := entry.get("shouldTranslate"); node != nil && string(node.literal) == "false" {
+			continue
+		}
+		localizations := entry.get("localizations")
+		if localizations == nil {
+			localizations = &jsonNode{isObj: true}
+			entry.set("localizations", localizations)
+		}
+		if xcstringsTranslated(localizations.get(targetLocale)) {
+			continue
+		}
+
+		var localization *jsonNode
+		if source := localizations.get(sourceLocale); source != nil {
+			localization = source.copy()
+		} else {
+			// Entries without a source localization use their key as source text.
+			localization = &jsonNode{isObj: true, object: []jsonMember{{key: "stringUnit", value: &jsonNode{isObj: true, object: []jsonMember{
+				{key: "state", value: &jsonNode{isStr: true}},
+				{key: "value", value: &jsonNode{isStr: true, str: member.key}},
+			}}}}}
+		}
+		context := ""
+		if comment := entry.get("comment"); comment != nil {
+			context = comment.str
+		}
+		doc.collect(localization, member.key, context)
+		localizations.set(targetLocale, localization)
+	}
+	return doc, nil
+}
+
+// collect registers every string unit below node, marking it as new until it is translated.
+func (doc *xcstringsDocument) collect(node *jsonNode, path string, context string) {
+	if unit := node.get("stringUnit"); unit != nil {
+		state, value := unit.get("state"), unit.get("value")
+		if state != nil && value != nil {
+			state.str = "new"
+			doc.pending = append(doc.pending, i18nString{path: path, value: value.str, context: context, set: func(s string) {
+				value.str = s
+				state.str = "translated"
+			}})
+		}
+	}
+	for _, member := range node.object {
+		if member.key != "stringUnit" {
+			doc.collect(member.value, path+"/"+member.key, context)
+		}
+	}
+}
+
+// xcstringsTranslated reports whether every string unit of a localization is translated.
+func xcstringsTranslated(node *jsonNode) bool {
+	if node == nil {
+		return false
+	}
+	translated, units := true, 0
+	var walk func(n *jsonNode)
+	walk = func(n *jsonNode) {
+		if unit := n.get("stringUnit"); unit != nil {
+			units++
+			if state := unit.get("state"); state == nil || state.str != "translated" {
+				translated = false
+			}
+		}
+		for _, member := range n.object {
+			walk(member.value)
+		}
+	}
+	walk(node)
+	return units > 0 && translated
+}
+
+func (doc *xcstringsDocument) strings() []i18nString {
+	return doc.pending
+}
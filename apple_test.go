@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const appleStrings = `/* Button that saves the form */
+"save" = "Save";
+// Shown on launch
+"welcome" = "Welcome, %@!\nHello \"friend\"";
+cancel = "Cancel";
+"empty" = "";
+`
+
+func TestParseAppleStringsDocument(t *testing.T) {
+	doc, err := parseAppleStringsDocument([]byte(appleStrings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []i18nEntry{
+		{"save", "Save", "Button that saves the form"},
+		{"welcome", "Welcome, %@!\nHello \"friend\"", "Shown on launch"},
+		{"cancel", "Cancel", ""},
+		{"empty", "", ""},
+	}
+	if got := i18nEntries(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAppleStringsDocument =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestParseAppleStringsDocumentInvalid(t *testing.T) {
+	for _, input := range []string{`"save" = "Save;`, `/* comment "save" = "Save";`} {
+		if _, err := parseAppleStringsDocument([]byte(input)); err == nil {
+			t.Errorf("parseAppleStringsDocument(%q) did not fail", input)
+		}
+	}
+}
+
+func TestUnescapeAppleString(t *testing.T) {
+	tests := []struct {
+		in, want string
+		// escaped reports whether escapeAppleString gives in back.
+		escaped bool
+	}{
+		{`Save`, "Save", true},
+		{`a\nb\tc`, "a\nb\tc", true},
+		{`\"quoted\" \\`, `"quoted" \`, true},
+		{`caf\U00e9`, "café", false},
+		{`trailing\`, `trailing\`, false},
+	}
+	for _, tt := range tests {
+		got := unescapeAppleString(tt.in)
+		if got != tt.want {
+			t.Errorf("unescapeAppleString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if escaped := escapeAppleString(got); tt.escaped && escaped != tt.in {
+			t.Errorf("escapeAppleString(%q) = %q, want %q", got, escaped, tt.in)
+		}
+	}
+}
+
+func TestTranslateI18nAppleStrings(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	opts := I18nOptions{SourceLang: "English", TargetLang: "German"}
+	want := `/* Button that saves the form */
+"save" = "Speichern";
+// Shown on launch
+"welcome" = "Willkommen, %@!\nHallo \"friend\"";
+cancel = "Abbrechen";
+"empty" = "";
+`
+	got, err := agent.TranslateI18n(context.Background(), []byte(appleStrings), I18nAppleStrings, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("TranslateI18n =\n%s\nwant\n%s", got, want)
+	}
+
+	// UTF-16 files are written back in UTF-16 with the same byte order.
+	got, err = agent.TranslateI18n(context.Background(), utf16LE(appleStrings), I18nAppleStrings, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, utf16LE(want)) {
+		t.Errorf("TranslateI18n of UTF-16 = %q, want %q", got, utf16LE(want))
+	}
+}
+
+func utf16LE(s string) []byte {
+	out := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(unit), byte(unit>>8))
+	}
+	return out
+}
+
+const stringsDict = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>files</key>
+	<dict>
+		<key>NSStringLocalizedFormatKey</key>
+		<string>%#@count@ in the folder</string>
+		<key>count</key>
+		<dict>
+			<key>NSStringFormatSpecTypeKey</key>
+			<string>NSStringPluralRuleType</string>
+			<key>NSStringFormatValueTypeKey</key>
+			<string>d</string>
+			<key>one</key>
+			<string>%d file</string>
+			<key>other</key>
+			<string>%d files</string>
+		</dict>
+	</dict>
+	<key>items</key>
+	<dict>
+		<key>NSStringLocalizedFormatKey</key>
+		<string>%#@count@</string>
+	</dict>
+</dict>
+</plist>
+`
+
+func TestParseStringsDictDocument(t *testing.T) {
+	doc, err := parseStringsDictDocument([]byte(stringsDict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []i18nEntry{
+		{"files/NSStringLocalizedFormatKey", "%#@count@ in the folder", "format of files, keep the %#@variable@ references"},
+		{"files/count/one", "%d file", `plural form "one" of files`},
+		{"files/count/other", "%d files", `plural form "other" of files`},
+	}
+	if got := i18nEntries(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStringsDictDocument =\n%q\nwant\n%q", got, want)
+	}
+}
+
+const stringCatalog = `{
+  "sourceLanguage" : "en",
+  "strings" : {
+    "Cancel" : {
+
+    },
+    "save" : {
+      "comment" : "Button that saves the form",
+      "localizations" : {
+        "en" : {
+          "stringUnit" : {
+            "state" : "translated",
+            "value" : "Save"
+          }
+        }
+      }
+    },
+    "done" : {
+      "localizations" : {
+        "de" : {
+          "stringUnit" : {
+            "state" : "translated",
+            "value" : "Fertig"
+          }
+        },
+        "en" : {
+          "stringUnit" : {
+            "state" : "translated",
+            "value" : "Done"
+          }
+        }
+      }
+    },
+    "id" : {
+      "shouldTranslate" : false
+    }
+  },
+  "version" : "1.0"
+}
+`
+
+func TestTranslateI18nStringCatalog(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	opts := I18nOptions{SourceLang: "English", TargetLang: "German"}
+	if _, err := agent.TranslateI18n(context.Background(), []byte(stringCatalog), I18nXCStrings, opts); err == nil {
+		t.Error("TranslateI18n of a string catalog without a target locale did not fail")
+	}
+	opts.TargetLocale = "de"
+	got, err := agent.TranslateI18n(context.Background(), []byte(stringCatalog), I18nXCStrings, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parseJSONDocument(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := doc.root.get("strings")
+	for key, want := range map[string]string{"Cancel": "Abbrechen", "save": "Speichern", "done": "Fertig"} {
+		unit := entries.get(key).get("localizations").get("de").get("stringUnit")
+		if value, state := unit.get("value").str, unit.get("state").str; value != want || state != "translated" {
+			t.Errorf("%s = %q (%s), want %q (translated)", key, value, state, want)
+		}
+	}
+	if entries.get("id").get("localizations") != nil {
+		t.Error("an entry that should not be translated got a localization")
+	}
+}
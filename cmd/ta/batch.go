@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// batchFile is a file picked by "ta batch" and the outcome of its translation.
+type batchFile struct {
+	rel    string
+	input  string
+	output string
+	format string
+
+	status string
+	usage  ta.Usage
+	err    error
+}
+
+// batchOptions select the files of a batch and where their translations go.
+type batchOptions struct {
+	include globList
+	exclude globList
+	format  string
+	outDir  string
+	suffix  string
+	force   bool
+}
+
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ta batch [flags] dir\n\nTranslates the files of a directory tree into -out, or next to them as name.<locale>.ext, and prints a summary.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	var agentOpts agentFlags
+	var lang languageFlags
+	var prices priceFlags
+	var opts batchOptions
+	var profile profileFlags
+	agentOpts.register(flags)
+	profile.register(flags)
+	lang.register(flags)
+	prices.register(flags)
+	flags.Var(&opts.include, "include", "glob of files to translate, e.g. \"locales/en/*.json\"; may be repeated (default: text and .strings files that are not translations)")
+	flags.Var(&opts.exclude, "exclude", "glob of files to skip; may be repeated")
+	flags.StringVar(&opts.outDir, "out", "", "output directory mirroring the input tree (default: name.<locale>.ext next to each file)")
+	flags.BoolVar(&opts.force, "force", false, "translate files whose output is newer than the input")
+	jobs := flags.Int("jobs", 4, "number of files translated concurrently")
+	missingOnly := flags.Bool("missing-only", false, "for resource files, only translate keys missing from the existing output")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "ta: batch needs exactly one directory")
+		return exitUsage
+	}
+	if err := profile.apply(flags, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if err := lang.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := detectFormat("", lang.format); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if *jobs < 1 {
+		fmt.Fprintln(os.Stderr, "ta: -jobs must be positive")
+		return exitUsage
+	}
+	config, err := agentOpts.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := config.StyleProfile(lang.style); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: -style: %v\n", err)
+		return exitUsage
+	}
+	opts.format = lang.format
+	opts.suffix = lang.fileSuffix()
+
+	files, err := collectBatchFiles(flags.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	queue := make(chan *batchFile)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				translateBatchFile(ctx, config, lang, file, *missingOnly)
+			}
+		}()
+	}
+	for _, file := range files {
+		if file.status == "" {
+			queue <- file
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if printBatchSummary(files, config.ModelName, &prices) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// collectBatchFiles walks root and returns the files to translate, in walk order. Files
+// whose output is up to date are returned with the status "skipped".
+func collectBatchFiles(root string, opts batchOptions) ([]*batchFile, error) {
+	outDir := ""
+	if opts.outDir != "" {
+		abs, err := filepath.Abs(opts.outDir)
+		if err != nil {
+			return nil, err
+		}
+		outDir = abs
+	}
+	var files []*batchFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil && abs == outDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if opts.exclude.match(rel) || (len(opts.include) > 0 && !opts.include.match(rel)) {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		format, _ := detectFormat(path, "auto")
+		if len(opts.include) == 0 && !isDefaultBatchFile(path, format) {
+			return nil
+		}
+		if opts.format != "auto" && format != opts.format {
+			return nil
+		}
+
+		file := &batchFile{rel: rel, input: path, format: format}
+		if outDir != "" {
+			file.output = filepath.Join(outDir, filepath.FromSlash(rel))
+		} else {
+			if strings.HasSuffix(strings.TrimSuffix(path, ext), "."+opts.suffix) {
+				// A translation written by an earlier run.
+				return nil
+			}
+			file.output = siblingName(path, opts.suffix)
+		}
+		if !opts.force && isUpToDate(path, file.output) {
+			file.status = "skipped"
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// isDefaultBatchFile reports whether path is picked by "ta batch" without -include: plain
+// texts with a text extension and resource files of formats made for translations, such
+// as .strings. JSON, YAML and XML files are as often configuration as they are locale
+// files, so they are only picked by -include, and so are files named like a translation.
+func isDefaultBatchFile(path string, format string) bool {
+	switch format {
+	case "json", "yaml", "android":
+		return false
+	case "text":
+		if !textExtensions[strings.ToLower(filepath.Ext(path))] {
+			return false
+		}
+	}
+	return !hasLanguageSuffix(path)
+}
+
+// hasLanguageSuffix reports whether the name of path ends in a language before its
+// extension, as in guide.de.md, guide.pt-BR.md or guide.german.md. Three-letter codes
+// are not taken as languages, as they are too easily mistaken for words such as min.
+func hasLanguageSuffix(path string) bool {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := strings.LastIndex(stem, ".")
+	if i < 0 {
+		return false
+	}
+	suffix := stem[i+1:]
+	l, err := ta.ParseLanguage(suffix)
+	if err != nil {
+		return false
+	}
+	prefix, _, _ := strings.Cut(strings.ReplaceAll(suffix, "_", "-"), "-")
+	base, _ := l.Tag.Base()
+	// A language name such as german does not start with its code.
+	return len(prefix) == 2 || !strings.EqualFold(prefix, base.String())
+}
+
+// siblingName returns the name of the translation of a file written next to it, e.g.
+// docs/guide.de.md for docs/guide.md.
+func siblingName(path string, suffix string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + suffix + ext
+}
+
+// isUpToDate reports whether output exists and is not older than input.
+func isUpToDate(input string, output string) bool {
+	inputInfo, err := os.Stat(input)
+	if err != nil {
+		return false
+	}
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	return !outputInfo.ModTime().Before(inputInfo.ModTime())
+}
+
+// translateBatchFile translates one file with its own agent, so that its usage can be
+// reported, and writes the output only when the whole file was translated. A partial
+// output would look up to date to the next run.
+func translateBatchFile(ctx context.Context, config ta.AgentConfig, lang languageFlags, file *batchFile, missingOnly bool) {
+	agent := ta.NewTranslationAgent(config)
+	defer func() {
+		file.usage = agent.Usage()
+		if file.err != nil {
+			file.status = "failed"
+		} else {
+			file.status = "ok"
+		}
+	}()
+	if err := ctx.Err(); err != nil {
+		file.err = err
+		return
+	}
+	data, err := os.ReadFile(file.input)
+	if err != nil {
+		file.err = err
+		return
+	}
+	var existing []byte
+	if missingOnly {
+		existing, err = os.ReadFile(file.output)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			file.err = err
+			return
+		}
+	}
+	translated, err := translateDocument(ctx, agent, file.rel, file.format, data, lang, existing)
+	if err != nil {
+		file.err = err
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file.output), 0o755); err != nil {
+		file.err = err
+		return
+	}
+	file.err = os.WriteFile(file.output, translated, 0o644)
+}
+
+// printBatchSummary prints a table of the files and their usage to stdout and the
+// errors to stderr, and returns the number of failed files.
+func printBatchSummary(files []*batchFile, model string, prices *priceFlags) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tTOKENS\tCOST")
+	var total ta.Usage
+	counts := map[string]int{}
+	for _, file := range files {
+		total = total.Add(file.usage)
+		counts[file.status]++
+		cost, known := prices.cost(model, file.usage)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", file.rel, file.status, file.usage.TotalTokens(), formatCost(cost, known))
+	}
+	cost, known := prices.cost(model, total)
+	fmt.Fprintf(w, "TOTAL\t%d ok, %d skipped, %d failed\t%d\t%s\n", counts["ok"], counts["skipped"], counts["failed"], total.TotalTokens(), formatCost(cost, known))
+	w.Flush()
+
+	for _, file := range files {
+		if file.err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %s: %v\n", file.rel, file.err)
+		}
+	}
+	return counts["failed"]
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.md", "docs/guide.md", true},
+		{"docs/**/*.md", "docs/guide.md", true},
+		{"docs/**/*.md", "docs/a/b/guide.md", true},
+		{"docs/**/*.md", "src/guide.md", false},
+		{"locales/en/*.json", "locales/en/app.json", true},
+		{"locales/en/*.json", "locales/en/nested/app.json", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectBatchFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"README.md",
+		"docs/guide.md",
+		"docs/guide.de.md",
+		"docs/guide.pt-BR.md",
+		"docs/min.md",
+		"docs/notes.min.md",
+		"package.json",
+		".github/workflows/ci.yaml",
+		"locales/en/app.json",
+		"ios/Localizable.strings",
+		"main.go",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("Hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		include globList
+		want    []string
+	}{
+		{"default", nil, []string{"README.md", "docs/guide.md", "docs/min.md", "docs/notes.min.md", "ios/Localizable.strings"}},
+		{"include", globList{"locales/en/*.json"}, []string{"locales/en/app.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := collectBatchFiles(root, batchOptions{include: tt.include, format: "auto", suffix: "fr"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.rel)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectBatchFiles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiblingName(t *testing.T) {
+	if got, want := siblingName(filepath.Join("docs", "guide.md"), "de"), filepath.Join("docs", "guide.de.md"); got != want {
+		t.Errorf("siblingName = %q, want %q", got, want)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	useStubModel(t)
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "docs", "guide.md"), "Hello")
+	writeFile(t, filepath.Join(root, "docs", "guide.fr.md"), "Bonjour")
+	writeFile(t, filepath.Join(root, "package.json"), `{"name": "Hello"}`)
+
+	if code := run([]string{"batch", "-source", "English", "-target", "German", "-target-locale", "de", root}); code != exitOK {
+		t.Fatalf("ta batch = %d, want %d", code, exitOK)
+	}
+	if got := readFile(t, filepath.Join(root, "docs", "guide.de.md")); got != "Hallo" {
+		t.Errorf("guide.de.md = %q, want Hallo", got)
+	}
+	for _, name := range []string{"docs/guide.fr.de.md", "package.de.json"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			t.Errorf("ta batch wrote %s", name)
+		}
+	}
+
+	// The translations are up to date now.
+	files, err := collectBatchFiles(root, batchOptions{format: "auto", suffix: "de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].status != "skipped" {
+		t.Errorf("files after the batch = %+v, want guide.md skipped", files)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+const formatNames = "text, json, yaml, android, strings, stringsdict, xcstrings, epub"
+
+var i18nFormats = map[string]ta.I18nFormat{
+	"json":        ta.I18nJSON,
+	"yaml":        ta.I18nYAML,
+	"android":     ta.I18nAndroidXML,
+	"strings":     ta.I18nAppleStrings,
+	"stringsdict": ta.I18nStringsDict,
+	"xcstrings":   ta.I18nXCStrings,
+}
+
+// detectFormat returns the format named by the -format flag, or the one matching the
+// extension of filename when the flag is "auto". Unknown extensions are plain text.
+func detectFormat(filename string, format string) (string, error) {
+	if format != "" && format != "auto" {
+		if _, ok := i18nFormats[format]; ok || format == "text" || format == "epub" {
+			return format, nil
+		}
+		return "", fmt.Errorf("unknown format %q, expected one of %s", format, formatNames)
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".xml":
+		return "android", nil
+	case ".strings":
+		return "strings", nil
+	case ".stringsdict":
+		return "stringsdict", nil
+	case ".xcstrings":
+		return "xcstrings", nil
+	case ".epub":
+		return "epub", nil
+	}
+	return "text", nil
+}
+
+// textExtensions are the extensions of plain text files picked by "ta batch" when no
+// format is given.
+var textExtensions = map[string]bool{
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".rst":      true,
+}
+
+// translateDocument translates data, read from the file name, in the given format.
+// existing is the current target file of resource formats, whose translations are kept.
+// Resource files and books may return a partly translated output together with an error.
+func translateDocument(ctx context.Context, agent *ta.TranslationAgent, name string, format string, data []byte, lang languageFlags, existing []byte) ([]byte, error) {
+	if i18nFormat, ok := i18nFormats[format]; ok {
+		return agent.TranslateI18n(ctx, data, i18nFormat, ta.I18nOptions{
+			SourceLang:   lang.sourceLang,
+			TargetLang:   lang.targetLang,
+			Country:      lang.country,
+			Formality:    ta.Formality(lang.formality),
+			Style:        lang.style,
+			Existing:     existing,
+			SourceLocale: lang.sourceLocale,
+			TargetLocale: lang.targetLocale,
+		})
+	}
+	if format == "epub" {
+		return agent.TranslateEPUB(ctx, data, ta.EPUBOptions{
+			SourceLang:   lang.sourceLang,
+			TargetLang:   lang.targetLang,
+			Country:      lang.country,
+			Formality:    ta.Formality(lang.formality),
+			Style:        lang.style,
+			TargetLocale: lang.targetLocale,
+			Progress: func(p ta.EPUBProgress) {
+				fmt.Fprintf(os.Stderr, "%s: chapter %d/%d %s\n", name, p.Chapter, p.Chapters, p.Href)
+			},
+		})
+	}
+
+	result, err := agent.Execute(ctx, ta.TranslationRequest{
+		SourceLang: lang.sourceLang,
+		TargetLang: lang.targetLang,
+		SourceText: string(data),
+		Country:    lang.country,
+		PivotLang:  lang.pivotLang,
+		Style:      lang.style,
+		Formality:  ta.Formality(lang.formality),
+	})
+	if err != nil {
+		return nil, err
+	}
+	translation := result.Translation
+	if strings.HasSuffix(string(data), "\n") && !strings.HasSuffix(translation, "\n") {
+		translation += "\n"
+	}
+	return []byte(translation), nil
+}
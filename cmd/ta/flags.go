@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// agentFlags are the flags that configure the translation agent. Their defaults come
+// from the environment, so the API key does not have to be passed on the command line.
+type agentFlags struct {
+	apiKey       string
+	baseURL      string
+	model        string
+	maxTokens    int
+	temperature  float64
+	placeholders bool
+	patterns     []string
+	retries      int
+	glossary     string
+	styleGuide   string
+	styleDir     string
+}
+
+func (f *agentFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.apiKey, "api-key", os.Getenv("OPENAI_API_KEY"), "API key (env OPENAI_API_KEY)")
+	fs.StringVar(&f.baseURL, "base-url", os.Getenv("OPENAI_BASE_URL"), "base URL of an OpenAI compatible API (env OPENAI_BASE_URL)")
+	fs.StringVar(&f.model, "model", envString("TA_MODEL", "gpt-4o-mini"), "model name (env TA_MODEL)")
+	fs.IntVar(&f.maxTokens, "max-tokens", envInt("TA_MAX_TOKENS", 1000), "maximum tokens per chunk (env TA_MAX_TOKENS)")
+	fs.Float64Var(&f.temperature, "temperature", envFloat("TA_TEMPERATURE", 0.3), "sampling temperature (env TA_TEMPERATURE)")
+	fs.BoolVar(&f.placeholders, "placeholders", true, "protect placeholders and markup such as {name}, %s and <b>")
+	fs.IntVar(&f.retries, "retries", 2, "retries of a step that loses placeholders")
+	fs.StringVar(&f.glossary, "glossary", "", "glossary file with a term and its translation per line, .csv or .tsv")
+	fs.StringVar(&f.styleGuide, "style-guide", "", "file with a style guide for the translation")
+	fs.StringVar(&f.styleDir, "style-dir", os.Getenv("TA_STYLE_DIR"), "directory of .yaml and .toml style profiles requests select by name (env TA_STYLE_DIR)")
+}
+
+func (f *agentFlags) config() (ta.AgentConfig, error) {
+	if f.apiKey == "" {
+		return ta.AgentConfig{}, errors.New("missing API key, set OPENAI_API_KEY or -api-key")
+	}
+	return f.settings()
+}
+
+// settings returns the agent configuration without requiring an API key, for commands
+// that do not call the API themselves.
+func (f *agentFlags) settings() (ta.AgentConfig, error) {
+	if f.maxTokens <= 0 {
+		return ta.AgentConfig{}, errors.New("-max-tokens must be positive")
+	}
+	config := ta.AgentConfig{
+		BaseURL:     f.baseURL,
+		ModelName:   f.model,
+		MaxTokens:   f.maxTokens,
+		Temperature: float32(f.temperature),
+		ApiKey:      f.apiKey,
+		MaxRetries:  f.retries,
+	}
+	if !f.placeholders {
+		config.DisablePlaceholders = true
+	}
+	if len(f.patterns) > 0 {
+		config.PlaceholderPatterns = f.patterns
+	}
+	var err error
+	if f.glossary != "" {
+		if config.Glossary, err = ta.LoadGlossary(f.glossary); err != nil {
+			return config, err
+		}
+	}
+	if f.styleGuide != "" {
+		styleGuide, err := os.ReadFile(f.styleGuide)
+		if err != nil {
+			return config, err
+		}
+		config.StyleGuide = string(styleGuide)
+	}
+	if config.StyleProfiles, err = loadStyleProfiles(f.styleDir); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// loadStyleProfiles loads the .yaml, .yml and .toml style profiles of a directory by
+// their name.
+func loadStyleProfiles(dir string) (map[string]ta.StyleProfile, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	profiles := map[string]ta.StyleProfile{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".toml":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+		profile, err := ta.LoadStyleProfile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		profiles[profile.Name] = profile
+	}
+	return profiles, nil
+}
+
+// languageFlags select the language pair and the document format.
+type languageFlags struct {
+	sourceLang   string
+	targetLang   string
+	country      string
+	pivotLang    string
+	style        string
+	formality    string
+	sourceLocale string
+	targetLocale string
+	format       string
+}
+
+func (f *languageFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.sourceLang, "source", os.Getenv("TA_SOURCE_LANG"), "source language, e.g. English, detected when it is auto or empty (env TA_SOURCE_LANG)")
+	fs.StringVar(&f.targetLang, "target", os.Getenv("TA_TARGET_LANG"), "target language, e.g. German (env TA_TARGET_LANG)")
+	fs.StringVar(&f.country, "country", os.Getenv("TA_COUNTRY"), "country whose style the translation should match (env TA_COUNTRY)")
+	fs.StringVar(&f.pivotLang, "pivot", os.Getenv("TA_PIVOT_LANG"), "language plain texts are translated into first, e.g. English for Thai to Finnish (env TA_PIVOT_LANG)")
+	fs.StringVar(&f.style, "style", os.Getenv("TA_STYLE"), "name of a style profile of -style-dir plain texts follow (env TA_STYLE)")
+	fs.StringVar(&f.formality, "formality", os.Getenv("TA_FORMALITY"), "form of address: default, more, less, prefer_more or prefer_less (env TA_FORMALITY)")
+	fs.StringVar(&f.sourceLocale, "source-locale", "", "source locale code of resource files, e.g. en")
+	fs.StringVar(&f.targetLocale, "target-locale", "", "target locale code of resource files and books, e.g. de")
+	fs.StringVar(&f.format, "format", "auto", "input format: auto, "+formatNames)
+}
+
+func (f *languageFlags) validate() error {
+	if f.targetLang == "" {
+		return errors.New("-target is required")
+	}
+	return nil
+}
+
+// fileSuffix returns the suffix of translated files, the target locale or else the
+// lower-cased target language.
+func (f *languageFlags) fileSuffix() string {
+	if f.targetLocale != "" {
+		return f.targetLocale
+	}
+	return strings.ToLower(strings.ReplaceAll(f.targetLang, " ", "-"))
+}
+
+func envString(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envFloat(name string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// jsonlRequest is a line of the input of "ta jsonl". Empty fields fall back to the flags.
+type jsonlRequest struct {
+	ID          string   `json:"id"`
+	SourceLang  string   `json:"source_lang"`
+	TargetLang  string   `json:"target_lang"`
+	Country     string   `json:"country"`
+	PivotLang   string   `json:"pivot_lang"`
+	Style       string   `json:"style"`
+	Formality   string   `json:"formality"`
+	Text        *string  `json:"text"`
+	File        string   `json:"file"`
+	Model       string   `json:"model"`
+	Temperature *float32 `json:"temperature"`
+	MaxTokens   int      `json:"max_tokens"`
+}
+
+// jsonlResult is a line of the output of "ta jsonl".
+type jsonlResult struct {
+	ID          string   `json:"id"`
+	Translation string   `json:"translation,omitempty"`
+	Reflection  string   `json:"reflection,omitempty"`
+	Usage       ta.Usage `json:"usage"`
+	Error       string   `json:"error,omitempty"`
+}
+
+func runJSONL(args []string) int {
+	flags := flag.NewFlagSet("jsonl", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `Usage: ta jsonl [flags] -o results.jsonl requests.jsonl
+
+Translates every line of requests.jsonl, or stdin when it is missing or -, and appends
+the results to -o. Lines whose id is already in -o are skipped, so an interrupted run
+can be resumed. A request line looks like
+
+  {"id": "1", "source_lang": "English", "target_lang": "German", "country": "Germany",
+   "style": "brand", "formality": "more", "pivot_lang": "...",
+   "text": "...", "file": "relative/to/requests.txt",
+   "model": "...", "temperature": 0.3, "max_tokens": 1000}
+
+where either text or file is set and the other fields default to the flags.
+
+Flags:`)
+		flags.PrintDefaults()
+	}
+	var agentOpts agentFlags
+	var lang languageFlags
+	var profile profileFlags
+	agentOpts.register(flags)
+	profile.register(flags)
+	lang.register(flags)
+	output := flags.String("o", "", "results file, created or appended to")
+	jobs := flags.Int("jobs", 4, "number of requests translated concurrently")
+	retryFailed := flags.Bool("retry-failed", false, "translate again the ids whose result in -o has an error")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 1 || *output == "" {
+		fmt.Fprintln(os.Stderr, "ta: jsonl needs -o and at most one requests file")
+		return exitUsage
+	}
+	if *jobs < 1 {
+		fmt.Fprintln(os.Stderr, "ta: -jobs must be positive")
+		return exitUsage
+	}
+	if err := profile.apply(flags, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	config, err := agentOpts.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := config.StyleProfile(lang.style); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: -style: %v\n", err)
+		return exitUsage
+	}
+
+	input := flags.Arg(0)
+	data, err := readInput(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	requests, err := parseJSONLRequests(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %s: %v\n", inputName(input), err)
+		return exitUsage
+	}
+	done, err := readJSONLResults(*output, *retryFailed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	out, err := os.OpenFile(*output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	defer out.Close()
+
+	baseDir := "."
+	if input != "" && input != "-" {
+		baseDir = filepath.Dir(input)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var mu sync.Mutex
+	var translated, failed int
+	var writeErr error
+	queue := make(chan jsonlRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				result := translateJSONLRequest(ctx, config, lang, &profile, baseDir, req)
+				if result.Error != "" && ctx.Err() != nil {
+					// The request was cut short by the interrupt, leave it to the next run.
+					continue
+				}
+				line, _ := json.Marshal(result)
+				mu.Lock()
+				if _, err := out.Write(append(line, '\n')); err != nil && writeErr == nil {
+					writeErr = err
+				}
+				if result.Error != "" {
+					failed++
+				} else {
+					translated++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	skipped := 0
+feed:
+	for _, req := range requests {
+		if done[req.ID] {
+			skipped++
+			continue
+		}
+		select {
+		case queue <- req:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	fmt.Fprintf(os.Stderr, "%d translated, %d skipped, %d failed\n", translated, skipped, failed)
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", writeErr)
+		return exitFailure
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "ta: interrupted, run again to translate the remaining requests")
+		return exitFailure
+	}
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// parseJSONLRequests parses the request lines, skipping blank ones. Every request needs
+// a unique id.
+func parseJSONLRequests(data []byte) ([]jsonlRequest, error) {
+	var requests []jsonlRequest
+	seen := map[string]bool{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var req jsonlRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if req.ID == "" {
+			return nil, fmt.Errorf("line %d: missing id", i+1)
+		}
+		if seen[req.ID] {
+			return nil, fmt.Errorf("line %d: duplicate id %q", i+1, req.ID)
+		}
+		seen[req.ID] = true
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// readJSONLResults returns the ids found in the results file, leaving out the failed
+// ones when retryFailed is set. A missing file has no ids. A last line cut short by an
+// interrupted run is removed from the file, so that new results start on a line of
+// their own.
+func readJSONLResults(name string, retryFailed bool) (map[string]bool, error) {
+	done := map[string]bool{}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	for _, line := range bytes.Split(data[:complete], []byte("\n")) {
+		var result jsonlResult
+		if json.Unmarshal(line, &result) == nil && result.ID != "" {
+			done[result.ID] = result.Error == "" || !retryFailed
+		}
+	}
+	if complete < len(data) {
+		if err := os.Truncate(name, int64(complete)); err != nil {
+			return nil, err
+		}
+	}
+	return done, nil
+}
+
+// translateJSONLRequest translates a request with its own agent, so that the usage of
+// the request can be reported.
+func translateJSONLRequest(ctx context.Context, config ta.AgentConfig, lang languageFlags, profile *profileFlags, baseDir string, req jsonlRequest) jsonlResult {
+	result := jsonlResult{ID: req.ID}
+	translation, reflection, usage, err := executeJSONLRequest(ctx, config, lang, profile, baseDir, req)
+	result.Translation, result.Reflection, result.Usage = translation, reflection, usage
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func executeJSONLRequest(ctx context.Context, config ta.AgentConfig, lang languageFlags, profile *profileFlags, baseDir string, req jsonlRequest) (string, string, ta.Usage, error) {
+	request := ta.TranslationRequest{
+		SourceLang: req.SourceLang,
+		TargetLang: req.TargetLang,
+	}
+	if request.SourceLang == "" {
+		request.SourceLang = lang.sourceLang
+	}
+	if request.TargetLang == "" {
+		request.TargetLang = lang.targetLang
+	}
+	request.PivotLang = req.PivotLang
+	if request.PivotLang == "" {
+		request.PivotLang = lang.pivotLang
+	}
+	request.Style = req.Style
+	if request.Style == "" {
+		request.Style = lang.style
+	}
+	request.Formality = ta.Formality(req.Formality)
+	if request.Formality == "" {
+		request.Formality = ta.Formality(lang.formality)
+	}
+	if request.TargetLang == "" {
+		return "", "", ta.Usage{}, errors.New("missing target_lang")
+	}
+	config, country, err := profile.pair(config, req.Country, lang, request.SourceLang, request.TargetLang)
+	if err != nil {
+		return "", "", ta.Usage{}, err
+	}
+	request.Country = country
+	if req.Model != "" {
+		config.ModelName = req.Model
+	}
+	if req.Temperature != nil {
+		config.Temperature = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		config.MaxTokens = req.MaxTokens
+	}
+
+	switch {
+	case req.Text != nil && req.File != "":
+		return "", "", ta.Usage{}, errors.New("text and file are both set")
+	case req.Text != nil:
+		request.SourceText = *req.Text
+	case req.File != "":
+		name := req.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", "", ta.Usage{}, err
+		}
+		request.SourceText = string(data)
+	default:
+		return "", "", ta.Usage{}, errors.New("missing text or file")
+	}
+
+	agent := ta.NewTranslationAgent(config)
+	result, err := agent.Execute(ctx, request)
+	if err != nil {
+		return "", "", agent.Usage(), err
+	}
+	reflections := make([]string, len(result.Chunks))
+	for i, chunk := range result.Chunks {
+		reflections[i] = chunk.Reflection
+	}
+	return result.Translation, strings.Join(reflections, "\n\n"), agent.Usage(), nil
+}
@@ -1,33 +1,63 @@
+// Command ta translates text and documents with the reflection translation agent.
+//
+//	ta [translate] [flags] [file]   translate a file or stdin
+//	ta batch [flags] dir            translate a directory tree
+//	ta jsonl [flags] requests.jsonl translate the requests of a JSONL file
+//	ta offline <command> [flags]    translate through OpenAI Batch API files
+//	ta repl [flags]                 translate and refine texts interactively
+//	ta serve [flags]                serve the translation API over HTTP
+//
+// Run "ta <command> -h" for the flags of a command.
 package main
 
 import (
 	"fmt"
-
-	ta "github.com/zaigie/translation-agent-go"
+	"os"
 )
 
-func main() {
-	text := `在现代社会的快速发展中，城市化进程显著地改变了人类的生活方式。从农业社会向工业社会的转型，再到如今的信息化、数字化时代，人们的生活节奏愈加快速。然而，伴随着现代化的进步，也出现了城市化带来的各种问题。环境污染、交通拥堵、资源消耗加剧等问题日益成为城市管理者和居民所关注的重要话题。因此，如何在繁忙的城市生活中寻求与自然的和谐共存，成为了现代社会亟需解决的课题。
-
-首先，我们需要认识到自然资源是城市发展的基础。从水资源、空气质量到绿地面积，健康的自然环境对人类身心健康和经济持续发展都有着不可忽视的影响。然而，现代城市中常常存在着过度开发和环境破坏的问题。工厂排放的废气、汽车尾气和建筑工地的扬尘等，不断侵蚀着我们赖以生存的自然环境。为了缓解这一问题，许多城市开始推动环保政策，通过法律和技术手段限制污染排放。例如，许多国家引入了新能源汽车政策，鼓励市民使用更为环保的出行方式。与此同时，政府也投资于公共交通系统的建设，为居民提供更多样化的选择。
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // the translation failed
+	exitUsage   = 2 // invalid flags or arguments
+)
 
-然而，政策和技术的创新只是其中一部分。更重要的是，市民意识的觉醒和参与。每一个居住在城市中的人都与自然环境息息相关。我们可以通过自身的行动来改善城市环境，比如垃圾分类、减少塑料使用、节水节电等。每一项小小的努力汇聚起来，都将对环境的改善起到积极的作用。许多社区也通过环保教育活动和实践项目，帮助居民更好地理解与自然和谐共存的意义。这样的行动，不仅提升了居民的环保意识，也让人与自然的关系更加紧密。
+var commands = map[string]func(args []string) int{
+	"translate": runTranslate,
+	"batch":     runBatch,
+	"jsonl":     runJSONL,
+	"offline":   runOffline,
+	"repl":      runREPL,
+	"serve":     runServe,
+}
 
-另一方面，绿色空间的规划和建设在现代城市生活中占据着重要地位。公园、花园、步道、绿道等城市绿地，不仅美化了环境，也为人们提供了休闲、锻炼和放松的场所。研究表明，接触自然可以有效缓解压力，提高人们的心理健康水平。因此，许多城市在规划时，都会保留一定的绿化区域，并努力将城市与自然相融合。城市里的“森林公园”、河流湿地保护区，甚至在办公大楼顶层的花园，这些都体现了城市设计师与政府在实现人与自然和谐共存方面的努力。
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-在科技飞速发展的当下，智能化、数字化也逐渐渗透到城市管理和自然保护领域。例如，智能传感器可以实时监测空气质量、噪音污染等数据，帮助相关部门更有效地管理和改善城市环境。无人机与卫星影像技术也为自然资源的监测与保护提供了新的可能性。通过数据分析和科技手段，我们能够更准确地了解环境变化的趋势，从而制定更科学的管理策略。然而，我们也需要保持警惕，科技的过度依赖可能会忽视自然界本身的自主性与生态平衡。因此，我们应当在发展科技的同时，保持对自然的敬畏之心。
+func run(args []string) int {
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			return command(args[1:])
+		}
+		if args[0] == "help" {
+			fmt.Fprint(os.Stderr, usage)
+			return exitOK
+		}
+	}
+	return runTranslate(args)
+}
 
-回顾历史，人类从未停止与自然的对话。从古代的田园诗人到今天的环保倡导者，人们一直在寻找平衡现代化进程与自然保护的最佳方式。我们的祖先或许无法理解信息化时代的繁忙与复杂，但他们在自然中生活的智慧与经验，依然值得我们借鉴。或许，现代人需要更多地向自然学习，懂得如何在科技与自然之间找到平衡点，建立一种既高效又可持续的生活方式。
+const usage = `Usage: ta <command> [flags]
 
-总之，现代城市生活与自然和谐共存是一项长期而艰巨的任务。我们需要政策、技术和社会的共同努力，更需要每一个人承担起自己的责任。只有这样，我们才能创造一个更加宜居、绿色的未来，为子孙后代留下一个美丽、可持续的世界。`
-	agent := ta.NewTranslationAgent(ta.AgentConfig{
-		BaseURL:     "https://apivip.aiproxy.io/v1",
-		ModelName:   "gpt-4o-mini",
-		MaxTokens:   1000,
-		Temperature: 0.3,
-		ApiKey:      "sk-xxxxxx",
-	})
+Commands:
+  translate   translate a file or stdin (default)
+  batch       translate a directory tree
+  jsonl       translate the requests of a JSONL file
+  offline     translate through OpenAI Batch API files
+  repl        translate and refine texts interactively
+  serve       serve the translation API over HTTP
+  help        show this help
 
-	translatedText := agent.Translate("Chinese", "English", text, "America")
-	fmt.Printf("Translated text: %s\n", translatedText)
-}
+Run "ta <command> -h" for the flags of a command.
+`
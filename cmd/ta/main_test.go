@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+// toGerman translates the words of the tests.
+var toGerman = strings.NewReplacer("Hello", "Hallo", "world", "Welt").Replace
+
+// useStubModel points the commands at a stub model and clears the environment they read
+// their defaults from.
+func useStubModel(t *testing.T) *stubmodel.Model {
+	t.Helper()
+	model := stubmodel.New(t, toGerman)
+	for _, name := range []string{"TA_CONFIG", "TA_PROFILE", "TA_SOURCE_LANG", "TA_TARGET_LANG", "TA_COUNTRY", "TA_PIVOT_LANG", "TA_STYLE", "TA_FORMALITY", "TA_STYLE_DIR", "TA_MODEL", "TA_MAX_TOKENS"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", model.URL)
+	return model
+}
+
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunTranslate(t *testing.T) {
+	useStubModel(t)
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "hello.txt"), filepath.Join(dir, "hello.de.txt")
+	writeFile(t, input, "Hello world")
+
+	if code := run([]string{"-source", "English", "-target", "German", "-o", output, input}); code != exitOK {
+		t.Fatalf("ta translate = %d, want %d", code, exitOK)
+	}
+	if got := readFile(t, output); got != "Hallo Welt" {
+		t.Errorf("translation = %q, want %q", got, "Hallo Welt")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"target", []string{"translate", "-source", "English", input}},
+		{"inputs", []string{"translate", "-target", "German", input, input}},
+		{"format", []string{"translate", "-target", "German", "-format", "docx", input}},
+		{"flag", []string{"translate", "-unknown"}},
+	}
+	for _, tt := range tests {
+		if code := run(tt.args); code != exitUsage {
+			t.Errorf("ta %s with an invalid %s = %d, want %d", strings.Join(tt.args, " "), tt.name, code, exitUsage)
+		}
+	}
+}
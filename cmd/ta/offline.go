@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// offlineState is the state file of "ta offline": the batch and where the translation of
+// each of its texts goes.
+type offlineState struct {
+	Batch   *ta.OfflineBatch  `json:"batch"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+func runOffline(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "start":
+			return runOfflineStart(args[1:])
+		case "export":
+			return runOfflineExport(args[1:])
+		case "import":
+			return runOfflineImport(args[1:])
+		case "status":
+			return runOfflineStatus(args[1:])
+		}
+	}
+	fmt.Fprint(os.Stderr, offlineUsage)
+	return exitUsage
+}
+
+const offlineUsage = `Usage: ta offline <command> -state job.json [flags]
+
+Runs the three translation steps through OpenAI Batch API files instead of live requests.
+
+Commands:
+  start    add text files to a new job and write the batch file of the first step
+  import   read a batch output file, and write the batch file of the next step with -o
+           or the translations once the last step is imported
+  export   write the batch file of the chunks of the current step still missing
+  status   show the step and the failed chunks of a job
+
+Run "ta offline <command> -h" for the flags of a command.
+`
+
+func offlineFlags(name string, usage string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("offline "+name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ta offline %s\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+	state := flags.String("state", "", "state file of the job")
+	return flags, state
+}
+
+func parseOfflineFlags(flags *flag.FlagSet, state *string, args []string) int {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *state == "" {
+		fmt.Fprintln(os.Stderr, "ta: -state is required")
+		return exitUsage
+	}
+	return -1
+}
+
+func runOfflineStart(args []string) int {
+	flags, statePath := offlineFlags("start", "start -state job.json -o batch.jsonl [flags] file...")
+	var agentOpts agentFlags
+	var lang languageFlags
+	var profile profileFlags
+	agentOpts.register(flags)
+	profile.register(flags)
+	lang.register(flags)
+	output := flags.String("o", "", "batch input file of the first step")
+	outDir := flags.String("out", "", "output directory of the translations (default: name.<locale>.ext next to each file)")
+	if code := parseOfflineFlags(flags, statePath, args); code >= 0 {
+		return code
+	}
+	if *output == "" || flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "ta: offline start needs -o and at least one file")
+		return exitUsage
+	}
+	if err := profile.apply(flags, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if err := lang.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	config, err := agentOpts.settings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := config.StyleProfile(lang.style); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: -style: %v\n", err)
+		return exitUsage
+	}
+	if _, err := os.Stat(*statePath); err == nil {
+		fmt.Fprintf(os.Stderr, "ta: %s already exists\n", *statePath)
+		return exitUsage
+	}
+
+	state := &offlineState{Batch: ta.NewOfflineBatch(config), Outputs: map[string]string{}}
+	for _, name := range flags.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+		err = state.Batch.Add(name, ta.TranslationRequest{
+			SourceLang: lang.sourceLang,
+			TargetLang: lang.targetLang,
+			SourceText: string(data),
+			Country:    lang.country,
+			Style:      lang.style,
+			Formality:  ta.Formality(lang.formality),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %s: %v\n", name, err)
+			return exitFailure
+		}
+		if *outDir != "" {
+			state.Outputs[name] = filepath.Join(*outDir, name)
+		} else {
+			state.Outputs[name] = siblingName(name, lang.fileSuffix())
+		}
+	}
+	if err := exportOffline(state, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	if err := saveOfflineState(*statePath, state); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runOfflineExport(args []string) int {
+	flags, statePath := offlineFlags("export", "export -state job.json -o batch.jsonl")
+	output := flags.String("o", "", "batch input file")
+	if code := parseOfflineFlags(flags, statePath, args); code >= 0 {
+		return code
+	}
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "ta: offline export needs -o")
+		return exitUsage
+	}
+	state, err := loadOfflineState(*statePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	if err := exportOffline(state, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runOfflineImport(args []string) int {
+	flags, statePath := offlineFlags("import", "import -state job.json [-o next.jsonl] output.jsonl...")
+	output := flags.String("o", "", "batch input file of the next step, written when the current step is complete")
+	if code := parseOfflineFlags(flags, statePath, args); code >= 0 {
+		return code
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "ta: offline import needs a batch output file")
+		return exitUsage
+	}
+	state, err := loadOfflineState(*statePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	stage := state.Batch.Stage
+	if stage == ta.OfflineDone {
+		fmt.Fprintln(os.Stderr, "the batch is already done, there is nothing to import")
+		return exitOK
+	}
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+		result, err := state.Batch.Import(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %s: %v\n", name, err)
+			return exitFailure
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d completed, %d failed, %d ignored\n", name, result.Completed, result.Failed, result.Ignored)
+	}
+	if err := saveOfflineState(*statePath, state); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+
+	switch batch := state.Batch; {
+	case batch.Stage == stage:
+		fmt.Fprintf(os.Stderr, "%d chunks of the %s step are missing, export them again\n", batch.Pending(), batch.Stage)
+		return exitFailure
+	case batch.Stage == ta.OfflineDone:
+		return writeOfflineResults(state)
+	case *output != "":
+		if err := exportOffline(state, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "the %s step is next, export it with ta offline export\n", batch.Stage)
+	}
+	return exitOK
+}
+
+func runOfflineStatus(args []string) int {
+	flags, statePath := offlineFlags("status", "status -state job.json")
+	if code := parseOfflineFlags(flags, statePath, args); code >= 0 {
+		return code
+	}
+	state, err := loadOfflineState(*statePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	batch := state.Batch
+	fmt.Printf("step: %s\n", batch.Stage)
+	fmt.Printf("texts: %d\n", len(batch.Documents))
+	if batch.Stage != ta.OfflineDone {
+		fmt.Printf("missing chunks: %d\n", batch.Pending())
+	}
+	fmt.Printf("tokens: %d prompt, %d completion\n", batch.Usage.PromptTokens, batch.Usage.CompletionTokens)
+	for _, doc := range batch.Documents {
+		for i, message := range doc.Errors {
+			fmt.Printf("%s chunk %d: %s\n", doc.ID, i+1, message)
+		}
+	}
+	return exitOK
+}
+
+// exportOffline writes the batch input file of the current step.
+func exportOffline(state *offlineState, name string) error {
+	var buf bytes.Buffer
+	n, err := state.Batch.Export(&buf)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d requests of the %s step to %s\n", n, state.Batch.Stage, name)
+	return nil
+}
+
+func writeOfflineResults(state *offlineState) int {
+	code := exitOK
+	for _, doc := range state.Batch.Documents {
+		result, err := state.Batch.Result(doc.ID)
+		if err == nil {
+			translation := result.Translation
+			if strings.HasSuffix(doc.Request.SourceText, "\n") && !strings.HasSuffix(translation, "\n") {
+				translation += "\n"
+			}
+			output := state.Outputs[doc.ID]
+			if err = os.MkdirAll(filepath.Dir(output), 0o755); err == nil {
+				err = os.WriteFile(output, []byte(translation), 0o644)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %s: %v\n", doc.ID, err)
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+func loadOfflineState(name string) (*offlineState, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var state offlineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if state.Batch == nil {
+		return nil, fmt.Errorf("%s: not a ta offline state file", name)
+	}
+	return &state, nil
+}
+
+// saveOfflineState writes the state to a temporary file first, so that an interrupted
+// save does not lose the job.
+func saveOfflineState(name string, state *offlineState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// modelPrices are the prices in USD per million input and output tokens of common
+// models. Dated model names such as gpt-4o-mini-2024-07-18 match by prefix.
+var modelPrices = map[string][2]float64{
+	"gpt-4o-mini":   {0.15, 0.60},
+	"gpt-4o":        {2.50, 10.00},
+	"gpt-4.1-nano":  {0.10, 0.40},
+	"gpt-4.1-mini":  {0.40, 1.60},
+	"gpt-4.1":       {2.00, 8.00},
+	"gpt-4-turbo":   {10.00, 30.00},
+	"gpt-3.5-turbo": {0.50, 1.50},
+}
+
+// priceFlags override the price of the model, for models missing from modelPrices.
+type priceFlags struct {
+	input  float64
+	output float64
+}
+
+func (f *priceFlags) register(fs *flag.FlagSet) {
+	fs.Float64Var(&f.input, "input-price", 0, "USD per million input tokens (default: known price of -model)")
+	fs.Float64Var(&f.output, "output-price", 0, "USD per million output tokens (default: known price of -model)")
+}
+
+// cost returns the price of usage with model, and false when the price is unknown.
+func (f *priceFlags) cost(model string, usage ta.Usage) (float64, bool) {
+	prices, ok := [2]float64{f.input, f.output}, f.input > 0 || f.output > 0
+	if !ok {
+		match := ""
+		for name, p := range modelPrices {
+			if strings.HasPrefix(model, name) && len(name) > len(match) {
+				match, prices, ok = name, p, true
+			}
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*prices[0] + float64(usage.CompletionTokens)*prices[1]) / 1e6, true
+}
+
+func formatCost(cost float64, known bool) string {
+	if !known {
+		return "-"
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// profileFlags select a profile of a configuration file. Its settings are used for the
+// flags not given on the command line, and take precedence over the environment.
+type profileFlags struct {
+	path    string
+	name    string
+	profile *ta.Profile
+	// explicit holds the flags given on the command line.
+	explicit map[string]bool
+	// lang holds the language flags before the defaults of their pair were applied.
+	lang languageFlags
+}
+
+func (f *profileFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.path, "config", os.Getenv("TA_CONFIG"), "YAML or TOML configuration file with profiles (env TA_CONFIG)")
+	fs.StringVar(&f.name, "profile", os.Getenv("TA_PROFILE"), "profile of the configuration file (env TA_PROFILE)")
+}
+
+// apply loads the selected profile into the flags, followed by the defaults of the
+// language pair. It must be called after parsing and before the flags are validated.
+func (f *profileFlags) apply(fs *flag.FlagSet, agent *agentFlags, lang *languageFlags) error {
+	f.explicit = map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) {
+		f.explicit[fl.Name] = true
+	})
+	if f.path == "" {
+		if f.name != "" {
+			return errors.New("-profile needs -config")
+		}
+		return nil
+	}
+	config, err := ta.LoadConfig(f.path)
+	if err != nil {
+		return err
+	}
+	if f.profile, err = config.Profile(f.name); err != nil {
+		return err
+	}
+
+	p := f.profile
+	f.setString("api-key", &agent.apiKey, p.APIKey)
+	f.setString("base-url", &agent.baseURL, p.BaseURL)
+	f.setString("model", &agent.model, p.Model)
+	if p.MaxTokens > 0 && !f.explicit["max-tokens"] {
+		agent.maxTokens = p.MaxTokens
+	}
+	if p.Temperature != nil && !f.explicit["temperature"] {
+		agent.temperature = float64(*p.Temperature)
+	}
+	if p.MaxRetries > 0 && !f.explicit["retries"] {
+		agent.retries = p.MaxRetries
+	}
+	if !f.explicit["placeholders"] {
+		if p.Placeholders != nil {
+			agent.placeholders = *p.Placeholders
+		}
+		agent.patterns = p.PlaceholderPatterns
+	}
+	f.setString("source", &lang.sourceLang, p.SourceLang)
+	f.setString("target", &lang.targetLang, p.TargetLang)
+	f.setString("country", &lang.country, p.Country)
+	f.lang = *lang
+	if pair := p.Language(lang.sourceLang, lang.targetLang); pair != nil {
+		f.setString("country", &lang.country, pair.Country)
+		f.setString("glossary", &agent.glossary, pair.Glossary)
+		f.setString("style-guide", &agent.styleGuide, pair.StyleGuide)
+	}
+	return nil
+}
+
+func (f *profileFlags) setString(name string, target *string, value string) {
+	if value != "" && !f.explicit[name] {
+		*target = value
+	}
+}
+
+// pair returns the configuration and country of a request whose languages may differ
+// from the flags. country is the country of the request, if any. Requests for another
+// language pair than the flags use the defaults of their own pair instead.
+func (f *profileFlags) pair(config ta.AgentConfig, country string, lang languageFlags, sourceLang string, targetLang string) (ta.AgentConfig, string, error) {
+	samePair := strings.EqualFold(sourceLang, lang.sourceLang) && strings.EqualFold(targetLang, lang.targetLang)
+	if f.profile == nil || samePair {
+		if country == "" {
+			country = lang.country
+		}
+		return config, country, nil
+	}
+
+	if !f.explicit["glossary"] {
+		config.Glossary = nil
+	}
+	if !f.explicit["style-guide"] {
+		config.StyleGuide = ""
+	}
+	if country == "" && f.explicit["country"] {
+		country = lang.country
+	}
+	pair := f.profile.Language(sourceLang, targetLang)
+	if pair != nil {
+		if country == "" {
+			country = pair.Country
+		}
+		if pair.Glossary != "" && !f.explicit["glossary"] {
+			glossary, err := ta.LoadGlossary(pair.Glossary)
+			if err != nil {
+				return config, country, err
+			}
+			config.Glossary = glossary
+		}
+		if pair.StyleGuide != "" && !f.explicit["style-guide"] {
+			styleGuide, err := os.ReadFile(pair.StyleGuide)
+			if err != nil {
+				return config, country, err
+			}
+			config.StyleGuide = string(styleGuide)
+		}
+	}
+	if country == "" {
+		country = f.lang.country
+	}
+	return config, country, nil
+}
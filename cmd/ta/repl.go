@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+const replHelp = `Type a text and end it with an empty line to translate it. While a translation is
+shown, the next text is feedback for another improvement round.
+
+Commands:
+  /accept           save the translation to the -save file and start a new text
+  /new              discard the translation and start a new text
+  /show             show the translation again
+  /source <lang>    set the source language
+  /target <lang>    set the target language and translate the text again
+  /country [name]   set or clear the country and translate the text again
+  /help             show this help
+  /quit             leave (or Ctrl-D)
+
+Ctrl-C stops a running translation, discards the text being typed, or leaves at an
+empty prompt.
+`
+
+// repl is the state of "ta repl": the language settings and the text being worked on.
+type repl struct {
+	agent *ta.TranslationAgent
+	lang  languageFlags
+	save  string
+	out   io.Writer
+
+	request ta.TranslationRequest
+	result  *ta.TranslationResult
+	// interrupt cancels the running translation, or the text being typed.
+	interrupt chan os.Signal
+}
+
+func runREPL(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ta repl [flags]\n\nTranslates texts interactively and refines them with feedback.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	var agentOpts agentFlags
+	var lang languageFlags
+	var profile profileFlags
+	agentOpts.register(flags)
+	profile.register(flags)
+	lang.register(flags)
+	save := flags.String("save", "", "file accepted translations are appended to, .csv or .tsv for glossaries, JSONL otherwise")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := profile.apply(flags, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if err := lang.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	config, err := agentOpts.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := config.StyleProfile(lang.style); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: -style: %v\n", err)
+		return exitUsage
+	}
+
+	r := &repl{
+		agent:     ta.NewTranslationAgent(config),
+		lang:      lang,
+		save:      *save,
+		out:       os.Stdout,
+		interrupt: make(chan os.Signal, 1),
+	}
+	signal.Notify(r.interrupt, os.Interrupt)
+	defer signal.Stop(r.interrupt)
+	fmt.Fprintf(r.out, "%s → %s. Type /help for commands.\n", lang.sourceLang, lang.targetLang)
+	r.loop(bufio.NewScanner(os.Stdin))
+	return exitOK
+}
+
+func (r *repl) prompt() string {
+	if r.result != nil {
+		return "feedback> "
+	}
+	return "text> "
+}
+
+// loop reads texts separated by empty lines, and commands, until /quit, the end of the
+// input or Ctrl-C at an empty prompt.
+func (r *repl) loop(scanner *bufio.Scanner) {
+	input := make(chan string)
+	go func() {
+		defer close(input)
+		for scanner.Scan() {
+			input <- scanner.Text()
+		}
+	}()
+	var lines []string
+	fmt.Fprint(r.out, r.prompt())
+	for {
+		var line string
+		select {
+		case <-r.interrupt:
+			fmt.Fprintln(r.out)
+			if len(lines) == 0 {
+				return
+			}
+			lines = nil
+			fmt.Fprint(r.out, r.prompt())
+			continue
+		case next, ok := <-input:
+			if !ok {
+				if len(lines) > 0 {
+					r.input(strings.Join(lines, "\n"))
+				}
+				fmt.Fprintln(r.out)
+				return
+			}
+			line = next
+		}
+		switch {
+		case len(lines) == 0 && strings.HasPrefix(line, "/"):
+			if !r.command(line) {
+				return
+			}
+		case strings.TrimSpace(line) != "":
+			lines = append(lines, line)
+			fmt.Fprint(r.out, "... ")
+			continue
+		case len(lines) > 0:
+			r.input(strings.Join(lines, "\n"))
+			lines = nil
+		}
+		fmt.Fprint(r.out, r.prompt())
+	}
+}
+
+// input translates a new text, or refines the current translation with feedback.
+func (r *repl) input(text string) {
+	if r.result == nil {
+		r.request = ta.TranslationRequest{
+			SourceLang: r.lang.sourceLang,
+			TargetLang: r.lang.targetLang,
+			SourceText: text,
+			Country:    r.lang.country,
+			PivotLang:  r.lang.pivotLang,
+			Style:      r.lang.style,
+			Formality:  ta.Formality(r.lang.formality),
+		}
+		r.translate()
+		return
+	}
+	result, err := r.run(func(ctx context.Context) (*ta.TranslationResult, error) {
+		return r.agent.Refine(ctx, r.request, r.result, text)
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	r.result = result
+	fmt.Fprintf(r.out, "\nFinal:\n%s\n\n", result.Translation)
+}
+
+// translate runs the three steps on the current request and shows them.
+func (r *repl) translate() {
+	result, err := r.run(func(ctx context.Context) (*ta.TranslationResult, error) {
+		return r.agent.Execute(ctx, r.request)
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	r.result = result
+	r.show()
+}
+
+// run runs a translation that Ctrl-C can stop.
+func (r *repl) run(translate func(ctx context.Context) (*ta.TranslationResult, error)) (*ta.TranslationResult, error) {
+	defer func() {
+		// Ctrl-C pressed again while the translation stopped is not left for the prompt.
+		select {
+		case <-r.interrupt:
+		default:
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.interrupt:
+			cancel()
+		case <-done:
+		}
+	}()
+	return translate(ctx)
+}
+
+func (r *repl) show() {
+	if r.result == nil {
+		fmt.Fprintln(r.out, "no translation")
+		return
+	}
+	for i, chunk := range r.result.Chunks {
+		if len(r.result.Chunks) > 1 {
+			fmt.Fprintf(r.out, "\n[chunk %d/%d]", i+1, len(r.result.Chunks))
+		}
+		fmt.Fprintf(r.out, "\nDraft:\n%s\n\nReflection:\n%s\n", chunk.Translation1, chunk.Reflection)
+	}
+	fmt.Fprintf(r.out, "\nFinal:\n%s\n\n", r.result.Translation)
+	usage := r.agent.Usage()
+	fmt.Fprintf(r.out, "(%d tokens so far)\n", usage.TotalTokens())
+}
+
+// command runs a command line and reports whether the REPL goes on.
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/quit", "/exit":
+		return false
+	case "/help":
+		fmt.Fprint(r.out, replHelp)
+	case "/show":
+		r.show()
+	case "/new":
+		r.result = nil
+	case "/accept":
+		if r.result == nil {
+			fmt.Fprintln(r.out, "no translation to accept")
+			break
+		}
+		if r.save == "" {
+			fmt.Fprintln(r.out, "no -save file, translation not saved")
+		} else if err := r.appendAccepted(); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+			break
+		} else {
+			fmt.Fprintf(r.out, "saved to %s\n", r.save)
+		}
+		r.result = nil
+	case "/source":
+		if arg == "" {
+			fmt.Fprintln(r.out, "usage: /source <language>")
+			break
+		}
+		r.lang.sourceLang = arg
+		r.result = nil
+	case "/target":
+		if arg == "" {
+			fmt.Fprintln(r.out, "usage: /target <language>")
+			break
+		}
+		r.lang.targetLang = arg
+		r.retranslate()
+	case "/country":
+		r.lang.country = arg
+		r.retranslate()
+	default:
+		fmt.Fprintf(r.out, "unknown command %s, type /help\n", name)
+	}
+	return true
+}
+
+// retranslate translates the current text again after the target or country changed.
+func (r *repl) retranslate() {
+	if r.result == nil {
+		return
+	}
+	r.request.TargetLang = r.lang.targetLang
+	r.request.Country = r.lang.country
+	r.result = nil
+	r.translate()
+}
+
+// appendAccepted appends the current text and translation to the save file, as a
+// glossary row in .csv and .tsv files and as a JSON line otherwise.
+func (r *repl) appendAccepted() error {
+	f, err := os.OpenFile(r.save, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(r.save)) {
+	case ".csv", ".tsv":
+		w := csv.NewWriter(f)
+		if strings.EqualFold(filepath.Ext(r.save), ".tsv") {
+			w.Comma = '\t'
+		}
+		w.Write([]string{r.request.SourceText, r.result.Translation})
+		w.Flush()
+		return w.Error()
+	}
+	line, err := json.Marshal(map[string]string{
+		"source_lang": r.request.SourceLang,
+		"target_lang": r.request.TargetLang,
+		"country":     r.request.Country,
+		"source":      r.request.SourceText,
+		"translation": r.result.Translation,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
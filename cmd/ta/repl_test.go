@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+func TestREPL(t *testing.T) {
+	model := useStubModel(t)
+	save := filepath.Join(t.TempDir(), "accepted.csv")
+	var out bytes.Buffer
+	r := &repl{
+		agent: ta.NewTranslationAgent(ta.AgentConfig{BaseURL: model.URL, ApiKey: "test", ModelName: "gpt-4o-mini", MaxTokens: 1000}),
+		lang:  languageFlags{sourceLang: "English", targetLang: "German"},
+		save:  save,
+		out:   &out,
+	}
+	input := "Hello world\n\nSay it warmly\n\n/show\n/unknown\n/accept\n/quit\n"
+	r.loop(bufio.NewScanner(strings.NewReader(input)))
+
+	for _, want := range []string{"Draft:\nHallo Welt", "Final:\nHallo Welt", "unknown command /unknown", "saved to " + save} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, out.String())
+		}
+	}
+	if !model.Asked("Say it warmly") {
+		t.Error("the feedback was not passed to the model")
+	}
+	if got := readFile(t, save); got != "Hello world,Hallo Welt\n" {
+		t.Errorf("saved translations = %q", got)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	ta "github.com/zaigie/translation-agent-go"
+	"github.com/zaigie/translation-agent-go/grpcserver"
+	"github.com/zaigie/translation-agent-go/jobs"
+	"github.com/zaigie/translation-agent-go/server"
+)
+
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ta serve [flags]\n\nServes the translation API over HTTP.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	var agentOpts agentFlags
+	var profile profileFlags
+	agentOpts.register(flags)
+	profile.register(flags)
+	addr := flags.String("addr", envString("TA_ADDR", ":8080"), "address to listen on (env TA_ADDR)")
+	grpcAddr := flags.String("grpc-addr", os.Getenv("TA_GRPC_ADDR"), "address to serve the gRPC API on, none to disable it (env TA_GRPC_ADDR)")
+	keys := flags.String("server-keys", os.Getenv("TA_SERVER_KEYS"), "comma separated API keys clients must send, as key or tenant:key, none for an open API (env TA_SERVER_KEYS)")
+	maxRequest := flags.Int64("max-request-bytes", 1<<20, "maximum body size of /v1/translate")
+	maxJob := flags.Int64("max-job-bytes", 16<<20, "maximum body size of /v1/jobs")
+	maxTexts := flags.Int("max-concurrent-texts", 4, "texts of a DeepL, LibreTranslate or Google request translated at the same time")
+	workers := flags.Int("workers", 4, "jobs run at the same time")
+	maxQueued := flags.Int("max-queued", 1000, "jobs that can wait for a worker")
+	maxPerTenant := flags.Int("max-per-tenant", 0, "jobs of a tenant run at the same time, 0 for no limit")
+	retention := flags.Duration("retention", 24*time.Hour, "how long finished jobs are kept")
+	jobsDir := flags.String("jobs-dir", envString("TA_JOBS_DIR", defaultJobsDir()), "directory keeping the jobs across restarts, empty to keep them in memory (env TA_JOBS_DIR)")
+	webhookSecret := flags.String("webhook-secret", os.Getenv("TA_WEBHOOK_SECRET"), "secret signing the job callbacks, none to send them unsigned (env TA_WEBHOOK_SECRET)")
+	webhookAttempts := flags.Int("webhook-attempts", 5, "times a job callback is sent before it fails")
+	webhookBackoff := flags.Duration("webhook-backoff", 10*time.Second, "delay before retrying a job callback, doubled after each attempt")
+	webhookAllow := flags.String("webhook-allow", os.Getenv("TA_WEBHOOK_ALLOW"), "comma separated host names, IP addresses and CIDR prefixes of internal job callbacks to allow (env TA_WEBHOOK_ALLOW)")
+	glossaryDir := flags.String("glossary-dir", "", "directory of .csv and .tsv glossaries the DeepL API selects by file name as glossary_id")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 30*time.Second, "time given to running requests and jobs on shutdown")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	var lang languageFlags
+	if err := profile.apply(flags, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	config, err := agentOpts.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	glossaries, err := loadGlossaries(*glossaryDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	apiKeys, tenants := parseServerKeys(*keys)
+	jobOpts := jobs.Options{
+		Workers:      *workers,
+		MaxQueued:    *maxQueued,
+		MaxPerTenant: *maxPerTenant,
+		Retention:    *retention,
+		Webhooks: jobs.WebhookOptions{
+			Secret:       *webhookSecret,
+			MaxAttempts:  *webhookAttempts,
+			Backoff:      *webhookBackoff,
+			AllowedHosts: splitList(*webhookAllow),
+		},
+	}
+	if *jobsDir != "" {
+		if jobOpts.Store, err = jobs.NewFileStore(*jobsDir); err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	s, err := server.New(server.Config{
+		Agent:              config,
+		APIKeys:            apiKeys,
+		Tenants:            tenants,
+		MaxRequestBytes:    *maxRequest,
+		MaxJobBytes:        *maxJob,
+		MaxConcurrentTexts: *maxTexts,
+		Glossaries:         glossaries,
+		Jobs:               jobOpts,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: jobs: %v\n", err)
+		return exitFailure
+	}
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if *grpcAddr != "" {
+		grpcListener, err = net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+		grpcServer = grpcserver.NewServer(grpcserver.Config{
+			Agent:   config,
+			APIKeys: apiKeys,
+			Tenants: tenants,
+			Queue:   s.Jobs(),
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 2)
+	go func() {
+		fmt.Fprintf(os.Stderr, "listening on %s\n", *addr)
+		errc <- httpServer.ListenAndServe()
+	}()
+	if grpcServer != nil {
+		go func() {
+			fmt.Fprintf(os.Stderr, "serving gRPC on %s\n", *grpcAddr)
+			errc <- grpcServer.Serve(grpcListener)
+		}()
+	}
+	select {
+	case err := <-errc:
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintln(os.Stderr, "shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	code := exitOK
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		code = exitFailure
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	if err := s.Close(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: jobs: %v\n", err)
+		code = exitFailure
+	}
+	return code
+}
+
+// defaultJobsDir returns the directory of the jobs in the user's cache directory.
+func defaultJobsDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "translation-agent", "jobs")
+}
+
+// parseServerKeys parses a list of keys given as key or tenant:key, and returns the keys
+// and the tenants of the named ones.
+func parseServerKeys(list string) ([]string, map[string]string) {
+	var keys []string
+	tenants := map[string]string{}
+	for _, item := range splitList(list) {
+		if tenant, key, ok := strings.Cut(item, ":"); ok {
+			keys = append(keys, key)
+			tenants[key] = tenant
+		} else {
+			keys = append(keys, item)
+		}
+	}
+	return keys, tenants
+}
+
+// stopGRPC waits for the running calls of a gRPC server, and cancels them when ctx is done
+// first.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// loadGlossaries loads the .csv and .tsv glossaries of a directory by their file name
+// without the extension.
+func loadGlossaries(dir string) (map[string]ta.Glossary, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	glossaries := map[string]ta.Glossary{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || ext != ".csv" && ext != ".tsv" {
+			continue
+		}
+		glossary, err := ta.LoadGlossary(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		glossaries[strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))] = glossary
+	}
+	return glossaries, nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+func runTranslate(args []string) int {
+	fs := flag.NewFlagSet("translate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ta translate [flags] [file]\n\nTranslates file, or stdin when file is missing or -, and writes the result to stdout or -o.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	var agentOpts agentFlags
+	var lang languageFlags
+	var profile profileFlags
+	agentOpts.register(fs)
+	profile.register(fs)
+	lang.register(fs)
+	output := fs.String("o", "", "output file (default stdout)")
+	missingOnly := fs.Bool("missing-only", false, "for resource files, only translate keys missing from the -o file")
+	targets := fs.String("targets", "", "comma separated target languages a text is translated into at once, written as name.<target>.ext after -o or the input file")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "ta: at most one input file")
+		return exitUsage
+	}
+	if err := profile.apply(fs, &agentOpts, &lang); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if *targets == "" {
+		if err := lang.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitUsage
+		}
+	}
+	config, err := agentOpts.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if _, err := config.StyleProfile(lang.style); err != nil {
+		fmt.Fprintf(os.Stderr, "ta: -style: %v\n", err)
+		return exitUsage
+	}
+
+	input := fs.Arg(0)
+	format, err := detectFormat(input, lang.format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitUsage
+	}
+	if *targets != "" && format != "text" {
+		fmt.Fprintln(os.Stderr, "ta: -targets only translates plain text")
+		return exitUsage
+	}
+	if *targets != "" && inputName(input) == "stdin" && (*output == "" || *output == "-") {
+		fmt.Fprintln(os.Stderr, "ta: -targets needs -o or an input file to name the outputs")
+		return exitUsage
+	}
+	data, err := readInput(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	var existing []byte
+	if *missingOnly {
+		if *output == "" {
+			fmt.Fprintln(os.Stderr, "ta: -missing-only needs -o")
+			return exitUsage
+		}
+		existing, err = os.ReadFile(*output)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	agent := ta.NewTranslationAgent(config)
+	if *targets != "" {
+		name := *output
+		if name == "" || name == "-" {
+			name = input
+		}
+		return translateTargets(ctx, agent, data, lang, splitList(*targets), name)
+	}
+	translated, err := translateDocument(ctx, agent, inputName(input), format, data, lang, existing)
+	if translated != nil {
+		if writeErr := writeOutput(*output, translated); writeErr != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", writeErr)
+			return exitFailure
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// translateTargets translates a text into several target languages at once, and writes
+// each translation as name.<target>.ext. The targets that fail are reported without
+// stopping the others.
+func translateTargets(ctx context.Context, agent *ta.TranslationAgent, data []byte, lang languageFlags, targets []string, name string) int {
+	results, err := agent.TranslateMany(ctx, ta.TranslationRequest{
+		SourceLang: lang.sourceLang,
+		SourceText: string(data),
+		Country:    lang.country,
+		PivotLang:  lang.pivotLang,
+		Style:      lang.style,
+		Formality:  ta.Formality(lang.formality),
+	}, targets)
+	var targetErrs ta.TargetErrors
+	if err != nil && !errors.As(err, &targetErrs) {
+		fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+		return exitFailure
+	}
+	code := exitOK
+	ext := filepath.Ext(name)
+	for _, target := range targets {
+		result, ok := results[target]
+		if !ok {
+			continue
+		}
+		translation := result.Translation
+		if strings.HasSuffix(string(data), "\n") && !strings.HasSuffix(translation, "\n") {
+			translation += "\n"
+		}
+		suffix := strings.ToLower(strings.ReplaceAll(target, " ", "-"))
+		if err := writeOutput(strings.TrimSuffix(name, ext)+"."+suffix+ext, []byte(translation)); err != nil {
+			fmt.Fprintf(os.Stderr, "ta: %v\n", err)
+			code = exitFailure
+		}
+	}
+	for _, target := range targets {
+		if err, ok := targetErrs[target]; ok {
+			fmt.Fprintf(os.Stderr, "ta: %s: %v\n", target, err)
+			delete(targetErrs, target)
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+func inputName(name string) string {
+	if name == "" || name == "-" {
+		return "stdin"
+	}
+	return name
+}
+
+func readInput(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func writeOutput(name string, data []byte) error {
+	if name == "" || name == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTranslateTargets(t *testing.T) {
+	model := useStubModel(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "README.md")
+	writeFile(t, input, "Hello world")
+
+	if code := run([]string{"-source", "English", "-targets", "German,pt-BR", input}); code != exitOK {
+		t.Fatalf("ta translate -targets = %d, want %d", code, exitOK)
+	}
+	for _, name := range []string{"README.german.md", "README.pt-br.md"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != "Hallo Welt" {
+			t.Errorf("%s = %q, want %q", name, got, "Hallo Welt")
+		}
+	}
+	if !model.Asked("Brazil") {
+		t.Error("the model was not asked for Brazilian Portuguese")
+	}
+}
+
+func TestRunTranslateFormality(t *testing.T) {
+	model := useStubModel(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "hello.txt")
+	writeFile(t, input, "Hello")
+
+	// English has no formal and informal forms to choose from.
+	if code := run([]string{"-source", "German", "-target", "English", "-formality", "more", "-o", filepath.Join(dir, "out.txt"), input}); code == exitOK {
+		t.Error("ta translate -formality more into English succeeded")
+	}
+	if len(model.Prompts()) != 0 {
+		t.Errorf("the model was asked %d prompts for an unsupported formality", len(model.Prompts()))
+	}
+	if code := run([]string{"-source", "English", "-target", "German", "-formality", "less", "-o", filepath.Join(dir, "out.txt"), input}); code != exitOK {
+		t.Fatalf("ta translate -formality less = %d", code)
+	}
+	if !model.Asked("informal") {
+		t.Error("the model was not asked for an informal translation")
+	}
+}
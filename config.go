@@ -0,0 +1,514 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a configuration file with named profiles, such as one per API endpoint:
+//
+//	default_profile: openai
+//	profiles:
+//	  openai:
+//	    api_key: ${OPENAI_API_KEY}
+//	    model: gpt-4o
+//	  local:
+//	    base_url: http://localhost:8000/v1
+//	    api_key: ${VLLM_KEY:-none}
+//	    model: qwen2.5-72b-instruct
+//	    max_tokens: 2000
+//	languages:
+//	  - source: English
+//	    target: German
+//	    country: Germany
+//	    glossary: glossaries/en-de.csv
+//	    style_guide: style/de.md
+//
+// The same keys can be written in TOML. ${VAR} and ${VAR:-default} in values are
+// replaced with environment variables when a profile is selected. Relative glossary and
+// style guide paths are relative to the configuration file.
+type Config struct {
+	DefaultProfile string
+	Profiles       map[string]*Profile
+	// Languages are the language pair defaults shared by all profiles.
+	Languages []LanguageDefaults
+
+	file string
+	dir  string
+}
+
+// Profile is a named set of agent settings.
+type Profile struct {
+	Name                string
+	BaseURL             string
+	APIKey              string
+	Model               string
+	MaxTokens           int
+	Temperature         *float32
+	MaxRetries          int
+	Placeholders        *bool
+	PlaceholderPatterns []string
+	SourceLang          string
+	TargetLang          string
+	Country             string
+	// Languages are the language pair defaults of the profile, which take precedence over
+	// the shared ones.
+	Languages []LanguageDefaults
+
+	dir string
+}
+
+// LanguageDefaults are the settings used when translating between two languages. An
+// empty SourceLang matches any source language.
+type LanguageDefaults struct {
+	SourceLang string
+	TargetLang string
+	Country    string
+	Glossary   string
+	StyleGuide string
+}
+
+// ConfigError is an invalid value in a configuration file.
+type ConfigError struct {
+	File string
+	// Key is the dotted path of the value, e.g. "profiles.local.temperature".
+	Key     string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Key, e.Message)
+}
+
+// LoadConfig reads a YAML (.yaml, .yml) or TOML (.toml) configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, &ConfigError{File: path, Message: "unknown format, expected .yaml, .yml or .toml"}
+	}
+	if err != nil {
+		return nil, &ConfigError{File: path, Message: err.Error()}
+	}
+	config, err := parseConfig(configValue{value: raw}, filepath.Dir(path))
+	if err != nil {
+		if configErr, ok := err.(*ConfigError); ok {
+			configErr.File = path
+		}
+		return nil, err
+	}
+	config.file = path
+	return config, nil
+}
+
+func parseConfig(root configValue, dir string) (*Config, error) {
+	config := &Config{Profiles: map[string]*Profile{}, dir: dir}
+	if root.value == nil {
+		return config, nil
+	}
+	fields, err := root.object("default_profile", "profiles", "languages")
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultProfile, err = fields["default_profile"].string(); err != nil {
+		return nil, err
+	}
+	if config.Languages, err = parseLanguages(fields["languages"]); err != nil {
+		return nil, err
+	}
+	if v, ok := fields["profiles"]; ok {
+		profiles, err := v.object()
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range profiles {
+			profile, err := parseProfile(v)
+			if err != nil {
+				return nil, err
+			}
+			profile.Name, profile.dir = name, dir
+			config.Profiles[name] = profile
+		}
+	}
+	if config.DefaultProfile != "" && config.Profiles[config.DefaultProfile] == nil {
+		return nil, fields["default_profile"].errorf("no profile named %q", config.DefaultProfile)
+	}
+	return config, nil
+}
+
+func parseProfile(v configValue) (*Profile, error) {
+	fields, err := v.object("base_url", "api_key", "model", "max_tokens", "temperature", "max_retries",
+		"placeholders", "placeholder_patterns", "source_lang", "target_lang", "country", "languages")
+	if err != nil {
+		return nil, err
+	}
+	profile := &Profile{}
+	for key, target := range map[string]*string{
+		"base_url":    &profile.BaseURL,
+		"api_key":     &profile.APIKey,
+		"model":       &profile.Model,
+		"source_lang": &profile.SourceLang,
+		"target_lang": &profile.TargetLang,
+		"country":     &profile.Country,
+	} {
+		if *target, err = fields[key].string(); err != nil {
+			return nil, err
+		}
+	}
+	if profile.MaxTokens, err = fields["max_tokens"].int(); err != nil {
+		return nil, err
+	}
+	if profile.MaxTokens < 0 {
+		return nil, fields["max_tokens"].errorf("must be positive")
+	}
+	if profile.MaxRetries, err = fields["max_retries"].int(); err != nil {
+		return nil, err
+	}
+	if profile.MaxRetries < 0 {
+		return nil, fields["max_retries"].errorf("must not be negative")
+	}
+	if t, ok := fields["temperature"]; ok {
+		temperature, err := t.float()
+		if err != nil {
+			return nil, err
+		}
+		if temperature < 0 || temperature > 2 {
+			return nil, t.errorf("must be between 0 and 2")
+		}
+		value := float32(temperature)
+		profile.Temperature = &value
+	}
+	if p, ok := fields["placeholders"]; ok {
+		placeholders, err := p.bool()
+		if err != nil {
+			return nil, err
+		}
+		profile.Placeholders = &placeholders
+	}
+	if profile.PlaceholderPatterns, err = fields["placeholder_patterns"].strings(); err != nil {
+		return nil, err
+	}
+	if _, err := newPlaceholderProtector(profile.PlaceholderPatterns); err != nil {
+		return nil, fields["placeholder_patterns"].errorf("%v", err)
+	}
+	if profile.Languages, err = parseLanguages(fields["languages"]); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func parseLanguages(v configValue) ([]LanguageDefaults, error) {
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+	languages := make([]LanguageDefaults, len(items))
+	for i, item := range items {
+		fields, err := item.object("source", "target", "country", "glossary", "style_guide")
+		if err != nil {
+			return nil, err
+		}
+		lang := &languages[i]
+		for key, target := range map[string]*string{
+			"source":      &lang.SourceLang,
+			"target":      &lang.TargetLang,
+			"country":     &lang.Country,
+			"glossary":    &lang.Glossary,
+			"style_guide": &lang.StyleGuide,
+		} {
+			if *target, err = fields[key].string(); err != nil {
+				return nil, err
+			}
+		}
+		if lang.TargetLang == "" {
+			return nil, item.errorf("missing target")
+		}
+	}
+	return languages, nil
+}
+
+// Profile returns the profile with the given name, or the default profile when name is
+// empty, with environment variables interpolated. A configuration with a single
+// profile and no default uses that profile.
+func (config *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" && len(config.Profiles) == 1 {
+		for only := range config.Profiles {
+			name = only
+		}
+	}
+	if name == "" {
+		return nil, &ConfigError{File: config.file, Message: "no profile selected and no default_profile"}
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(config.Profiles))
+		for known := range config.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return nil, &ConfigError{File: config.file, Message: fmt.Sprintf("no profile named %q, expected one of %s", name, strings.Join(names, ", "))}
+	}
+
+	resolved := *profile
+	resolved.Languages = append(append([]LanguageDefaults(nil), profile.Languages...), config.Languages...)
+	key := "profiles." + name + "."
+	var err error
+	for field, target := range map[string]*string{
+		"base_url":    &resolved.BaseURL,
+		"api_key":     &resolved.APIKey,
+		"model":       &resolved.Model,
+		"source_lang": &resolved.SourceLang,
+		"target_lang": &resolved.TargetLang,
+		"country":     &resolved.Country,
+	} {
+		if *target, err = config.interpolateEnv(key+field, *target); err != nil {
+			return nil, err
+		}
+	}
+	// Paths are resolved here, so that callers can use them without the configuration.
+	for i := range resolved.Languages {
+		lang, langKey := &resolved.Languages[i], fmt.Sprintf("%slanguages[%d].", key, i)
+		if i >= len(profile.Languages) {
+			langKey = fmt.Sprintf("languages[%d].", i-len(profile.Languages))
+		}
+		for field, target := range map[string]*string{
+			"glossary":    &lang.Glossary,
+			"style_guide": &lang.StyleGuide,
+		} {
+			if *target, err = config.interpolateEnv(langKey+field, *target); err != nil {
+				return nil, err
+			}
+			if *target != "" {
+				*target = profile.path(*target)
+			}
+		}
+	}
+	return &resolved, nil
+}
+
+// envPattern matches ${VAR} and ${VAR:-default}.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+func (config *Config) interpolateEnv(key string, value string) (string, error) {
+	var missing string
+	value = envPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envPattern.FindStringSubmatch(ref)
+		if env, ok := os.LookupEnv(m[1]); ok && env != "" {
+			return env
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		if missing == "" {
+			missing = m[1]
+		}
+		return ""
+	})
+	if missing != "" {
+		return "", &ConfigError{File: config.file, Key: key, Message: fmt.Sprintf("environment variable %s is not set", missing)}
+	}
+	return value, nil
+}
+
+// Language returns the defaults for translating from sourceLang to targetLang, matching
+// languages by name or BCP 47 tag so that "de-DE" finds the defaults of German, or nil
+// when there are none. The glossary and style
+// guide paths of a profile returned by Config.Profile are resolved.
+func (profile *Profile) Language(sourceLang string, targetLang string) *LanguageDefaults {
+	for i, lang := range profile.Languages {
+		if sameLanguage(lang.TargetLang, targetLang) && (lang.SourceLang == "" || sameLanguage(lang.SourceLang, sourceLang)) {
+			return &profile.Languages[i]
+		}
+	}
+	return nil
+}
+
+// AgentConfig returns the agent settings of the profile, with the glossary and style
+// guide of the defaults for sourceLang and targetLang loaded. Zero settings are left for
+// the agent defaults.
+func (profile *Profile) AgentConfig(sourceLang string, targetLang string) (AgentConfig, error) {
+	config := AgentConfig{
+		BaseURL:             profile.BaseURL,
+		ModelName:           profile.Model,
+		MaxTokens:           profile.MaxTokens,
+		ApiKey:              profile.APIKey,
+		PlaceholderPatterns: profile.PlaceholderPatterns,
+		MaxRetries:          profile.MaxRetries,
+	}
+	if profile.Temperature != nil {
+		config.Temperature = *profile.Temperature
+	}
+	if profile.Placeholders != nil && !*profile.Placeholders {
+		config.DisablePlaceholders = true
+	}
+	if lang := profile.Language(sourceLang, targetLang); lang != nil {
+		var err error
+		if lang.Glossary != "" {
+			if config.Glossary, err = LoadGlossary(lang.Glossary); err != nil {
+				return config, err
+			}
+		}
+		if lang.StyleGuide != "" {
+			styleGuide, err := os.ReadFile(lang.StyleGuide)
+			if err != nil {
+				return config, err
+			}
+			config.StyleGuide = string(styleGuide)
+		}
+	}
+	return config, nil
+}
+
+// path resolves a path relative to the configuration file.
+func (profile *Profile) path(name string) string {
+	if filepath.IsAbs(name) || profile.dir == "" {
+		return name
+	}
+	return filepath.Join(profile.dir, name)
+}
+
+// configValue is a decoded YAML or TOML value and its key, for error messages.
+type configValue struct {
+	key   string
+	value interface{}
+}
+
+func (v configValue) errorf(format string, args ...interface{}) *ConfigError {
+	return &ConfigError{Key: v.key, Message: fmt.Sprintf(format, args...)}
+}
+
+func (v configValue) child(key string) string {
+	if v.key == "" {
+		return key
+	}
+	return v.key + "." + key
+}
+
+// object returns the fields of a mapping, rejecting keys other than the given ones
+// unless none are given.
+func (v configValue) object(keys ...string) (map[string]configValue, error) {
+	m, ok := v.value.(map[string]interface{})
+	if !ok {
+		return nil, v.errorf("expected a mapping")
+	}
+	names := make([]string, 0, len(m))
+	for key := range m {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	fields := make(map[string]configValue, len(m))
+	for _, key := range names {
+		if len(keys) > 0 && !containsString(keys, key) {
+			return nil, configValue{key: v.child(key)}.errorf("unknown key, expected one of %s", strings.Join(keys, ", "))
+		}
+		fields[key] = configValue{key: v.child(key), value: m[key]}
+	}
+	return fields, nil
+}
+
+func (v configValue) list() ([]configValue, error) {
+	if v.value == nil {
+		return nil, nil
+	}
+	items, ok := v.value.([]interface{})
+	if !ok {
+		return nil, v.errorf("expected a list")
+	}
+	values := make([]configValue, len(items))
+	for i, item := range items {
+		values[i] = configValue{key: fmt.Sprintf("%s[%d]", v.key, i), value: item}
+	}
+	return values, nil
+}
+
+func (v configValue) string() (string, error) {
+	if v.value == nil {
+		return "", nil
+	}
+	s, ok := v.value.(string)
+	if !ok {
+		return "", v.errorf("expected a string, got %v", v.value)
+	}
+	return s, nil
+}
+
+func (v configValue) strings() ([]string, error) {
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		if values[i], err = item.string(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (v configValue) int() (int, error) {
+	switch n := v.value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case uint64:
+		return int(n), nil
+	}
+	return 0, v.errorf("expected an integer, got %v", v.value)
+}
+
+func (v configValue) float() (float64, error) {
+	switch n := v.value.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	}
+	return 0, v.errorf("expected a number, got %v", v.value)
+}
+
+func (v configValue) bool() (bool, error) {
+	if v.value == nil {
+		return false, nil
+	}
+	b, ok := v.value.(bool)
+	if !ok {
+		return false, v.errorf("expected true or false, got %v", v.value)
+	}
+	return b, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
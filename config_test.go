@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, by path relative to a new temporary directory, and returns
+// the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	files := map[string]string{
+		"ta.yaml": `default_profile: openai
+profiles:
+  openai:
+    api_key: ${TA_TEST_KEY}
+    model: gpt-4o
+    temperature: 0.5
+    placeholders: false
+  local:
+    base_url: ${TA_TEST_URL:-http://localhost:8000/v1}
+    max_tokens: 2000
+    languages:
+      - target: German
+        style_guide: style/local.md
+languages:
+  - source: English
+    target: German
+    country: Germany
+    glossary: glossaries/en-de.csv
+    style_guide: style/de.md
+`,
+		"ta.toml": `default_profile = "openai"
+
+[profiles.openai]
+api_key = "${TA_TEST_KEY}"
+model = "gpt-4o"
+temperature = 0.5
+placeholders = false
+
+[profiles.local]
+base_url = "${TA_TEST_URL:-http://localhost:8000/v1}"
+max_tokens = 2000
+
+[[profiles.local.languages]]
+target = "German"
+style_guide = "style/local.md"
+
+[[languages]]
+source = "English"
+target = "German"
+country = "Germany"
+glossary = "glossaries/en-de.csv"
+style_guide = "style/de.md"
+`,
+		"glossaries/en-de.csv": "# term, translation\nagent, Agent\n",
+		"style/de.md":          "Use the informal du.",
+		"style/local.md":       "Keep it short.",
+	}
+	dir := writeFiles(t, files)
+	t.Setenv("TA_TEST_KEY", "secret")
+	for _, name := range []string{"ta.yaml", "ta.toml"} {
+		t.Run(name, func(t *testing.T) {
+			config, err := LoadConfig(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			profile, err := config.Profile("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.Name != "openai" || profile.APIKey != "secret" || profile.Model != "gpt-4o" || *profile.Temperature != 0.5 {
+				t.Errorf("default profile = %+v", profile)
+			}
+			agentConfig, err := profile.AgentConfig("english", "german")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (Glossary{{Source: "agent", Target: "Agent"}}); !reflect.DeepEqual(agentConfig.Glossary, want) {
+				t.Errorf("glossary = %v, want %v", agentConfig.Glossary, want)
+			}
+			if agentConfig.StyleGuide != "Use the informal du." || agentConfig.Temperature != 0.5 {
+				t.Errorf("agent config = %+v", agentConfig)
+			}
+			if !agentConfig.DisablePlaceholders || agentConfig.ActivePlaceholderPatterns() != nil {
+				t.Errorf("placeholder patterns = %q, want placeholders turned off", agentConfig.ActivePlaceholderPatterns())
+			}
+			if lang := profile.Language("English", "French"); lang != nil {
+				t.Errorf("Language(English, French) = %+v, want nil", lang)
+			}
+			// Tags match the languages named in the config.
+			if lang := profile.Language("en", "de-DE"); lang == nil || lang.Country != "Germany" {
+				t.Errorf("Language(en, de-DE) = %+v, want the defaults of English to German", lang)
+			}
+
+			// The languages of a profile take precedence over the shared ones.
+			local, err := config.Profile("local")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if local.BaseURL != "http://localhost:8000/v1" || local.MaxTokens != 2000 {
+				t.Errorf("local profile = %+v", local)
+			}
+			lang := local.Language("English", "German")
+			if want := filepath.Join(dir, "style/local.md"); lang == nil || lang.StyleGuide != want {
+				t.Errorf("Language(English, German) = %+v, want style guide %s", lang, want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		key     string
+		message string
+	}{
+		{"unknown key", "profiles:\n  a:\n    temprature: 1\n", "profiles.a.temprature", "unknown key, expected one of"},
+		{"temperature", "profiles:\n  a:\n    temperature: 3\n", "profiles.a.temperature", "must be between 0 and 2"},
+		{"max tokens", "profiles:\n  a:\n    max_tokens: many\n", "profiles.a.max_tokens", "expected an integer, got many"},
+		{"max retries", "profiles:\n  a:\n    max_retries: -1\n", "profiles.a.max_retries", "must not be negative"},
+		{"placeholders", "profiles:\n  a:\n    placeholders: yes please\n", "profiles.a.placeholders", "expected true or false"},
+		{"placeholder patterns", "profiles:\n  a:\n    placeholder_patterns: ['(']\n", "profiles.a.placeholder_patterns", "invalid placeholder pattern"},
+		{"profiles", "profiles: [a]\n", "profiles", "expected a mapping"},
+		{"default profile", "default_profile: b\nprofiles:\n  a: {}\n", "default_profile", `no profile named "b"`},
+		{"languages", "languages: {target: German}\n", "languages", "expected a list"},
+		{"missing target", "languages:\n  - source: English\n", "languages[0]", "missing target"},
+		{"language key", "profiles:\n  a:\n    languages:\n      - target: German\n        glosary: x.csv\n", "profiles.a.languages[0].glosary", "unknown key"},
+		{"string", "profiles:\n  a:\n    model: [gpt-4o]\n", "profiles.a.model", "expected a string"},
+		{"syntax", "profiles: [\n", "", "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(writeFiles(t, map[string]string{"ta.yaml": tt.config}), "ta.yaml")
+			_, err := LoadConfig(path)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("LoadConfig = %v, want a ConfigError", err)
+			}
+			if configErr.File != path || configErr.Key != tt.key || !strings.Contains(configErr.Message, tt.message) {
+				t.Errorf("LoadConfig = %#v, want key %q and a message containing %q", configErr, tt.key, tt.message)
+			}
+		})
+	}
+}
+
+func TestConfigProfileErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ta.yaml":  "profiles:\n  a:\n    api_key: ${TA_TEST_UNSET}\n  b: {}\n",
+		"ta.json":  "{}",
+		"one.yaml": "profiles:\n  only:\n    model: gpt-4o\n",
+	})
+	t.Setenv("TA_TEST_UNSET", "")
+	config, err := LoadConfig(filepath.Join(dir, "ta.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile string
+		key     string
+		message string
+	}{
+		{"a", "profiles.a.api_key", "environment variable TA_TEST_UNSET is not set"},
+		{"c", "", `no profile named "c", expected one of a, b`},
+		{"", "", "no profile selected and no default_profile"},
+	}
+	for _, tt := range tests {
+		_, err := config.Profile(tt.profile)
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || configErr.Key != tt.key || configErr.Message != tt.message {
+			t.Errorf("Profile(%q) = %v, want key %q and message %q", tt.profile, err, tt.key, tt.message)
+		}
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "ta.json")); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("LoadConfig of a JSON file = %v, want an unknown format error", err)
+	}
+	// A single profile is selected without a default.
+	one, err := LoadConfig(filepath.Join(dir, "one.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile, err := one.Profile(""); err != nil || profile.Name != "only" {
+		t.Errorf("Profile(\"\") = %v, %v, want the only profile", profile, err)
+	}
+}
+
+func TestConfigErrorString(t *testing.T) {
+	tests := []struct {
+		err  ConfigError
+		want string
+	}{
+		{ConfigError{File: "ta.yaml", Message: "unknown format"}, "ta.yaml: unknown format"},
+		{ConfigError{File: "ta.yaml", Key: "profiles.a.temperature", Message: "must be between 0 and 2"}, "ta.yaml: profiles.a.temperature: must be between 0 and 2"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
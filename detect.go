@@ -0,0 +1,349 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AutoDetect is the source language of requests whose language is detected. An empty
+// source language is detected too.
+const AutoDetect = "auto"
+
+// IsAutoDetect reports whether a source language asks for detection.
+func IsAutoDetect(lang string) bool {
+	lang = strings.TrimSpace(lang)
+	return lang == "" || strings.EqualFold(lang, AutoDetect)
+}
+
+// ErrLanguageNotDetected is returned when the language of a text cannot be detected, as
+// for texts without letters.
+var ErrLanguageNotDetected = errors.New("could not detect the language of the text")
+
+// DetectionMethod is how a language was detected.
+type DetectionMethod string
+
+const (
+	// DetectionScript detects a language from a script only it uses, such as Hangul.
+	DetectionScript DetectionMethod = "script"
+	// DetectionNgram compares the character trigrams of a text with those of the
+	// languages sharing its script.
+	DetectionNgram DetectionMethod = "ngram"
+	// DetectionModel asks the model.
+	DetectionModel DetectionMethod = "model"
+)
+
+// Detection is the detected language of a text.
+type Detection struct {
+	// Code is the language code, such as "fr" or "zh-Hant", and Language its English name.
+	Code     string `json:"code"`
+	Language string `json:"language"`
+	// Confidence is between 0 and 1.
+	Confidence float64         `json:"confidence"`
+	Method     DetectionMethod `json:"method"`
+}
+
+// scriptLanguages are the languages detected from their script alone.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+}
+
+// ngramSamples are texts in the languages sharing the Latin, Cyrillic and Arabic scripts,
+// whose trigrams are compared with those of the text to detect.
+var ngramSamples = map[string]map[string]string{
+	"Latin": {
+		"en": "All human beings are born free and equal in dignity and rights. They are endowed with reason and conscience and should act towards one another in a spirit of brotherhood. This is the text that we want to translate, and it will be ready for you when the work is done. What do you think about it? I have not seen them since they were here last week with their friends.",
+		"fr": "Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont doués de raison et de conscience et doivent agir les uns envers les autres dans un esprit de fraternité. C'est le texte que nous voulons traduire, et il sera prêt pour vous quand le travail sera terminé. Qu'est-ce que vous en pensez ? Je ne les ai pas vus depuis qu'ils étaient ici la semaine dernière avec leurs amis.",
+		"de": "Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen. Das ist der Text, den wir übersetzen wollen, und er wird für Sie fertig sein, wenn die Arbeit getan ist. Was denken Sie darüber? Ich habe sie nicht gesehen, seit sie letzte Woche mit ihren Freunden hier waren.",
+		"es": "Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados como están de razón y conciencia, deben comportarse fraternalmente los unos con los otros. Este es el texto que queremos traducir, y estará listo para usted cuando el trabajo esté terminado. ¿Qué piensa usted de eso? No los he visto desde que estuvieron aquí la semana pasada con sus amigos.",
+		"it": "Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri in spirito di fratellanza. Questo è il testo che vogliamo tradurre, e sarà pronto per lei quando il lavoro sarà finito. Che cosa ne pensa? Non li ho visti da quando erano qui la settimana scorsa con i loro amici.",
+		"pt": "Todos os seres humanos nascem livres e iguais em dignidade e em direitos. Dotados de razão e de consciência, devem agir uns para com os outros em espírito de fraternidade. Este é o texto que queremos traduzir, e ele estará pronto para você quando o trabalho estiver concluído. O que você acha disso? Não os vejo desde que estiveram aqui na semana passada com os seus amigos.",
+		"nl": "Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn begiftigd met verstand en geweten, en behoren zich jegens elkander in een geest van broederschap te gedragen. Dit is de tekst die we willen vertalen, en hij is klaar voor u wanneer het werk gedaan is. Wat vindt u ervan? Ik heb ze niet gezien sinds ze vorige week met hun vrienden hier waren.",
+		"pl": "Wszyscy ludzie rodzą się wolni i równi pod względem swej godności i swych praw. Są oni obdarzeni rozumem i sumieniem i powinni postępować wobec innych w duchu braterstwa. To jest tekst, który chcemy przetłumaczyć, i będzie gotowy dla pana, kiedy praca zostanie skończona. Co pan o tym myśli? Nie widziałem ich, odkąd byli tu w zeszłym tygodniu ze swoimi przyjaciółmi.",
+		"sv": "Alla människor är födda fria och lika i värde och rättigheter. De har utrustats med förnuft och samvete och bör handla gentemot varandra i en anda av broderskap. Det här är texten som vi vill översätta, och den blir klar för dig när arbetet är gjort. Vad tycker du om det? Jag har inte sett dem sedan de var här förra veckan med sina vänner.",
+		"da": "Alle mennesker er født frie og lige i værdighed og rettigheder. De er udstyret med fornuft og samvittighed, og de bør handle mod hverandre i en broderskabets ånd. Dette er teksten, som vi vil oversætte, og den er klar til dig, når arbejdet er gjort. Hvad synes du om det? Jeg har ikke set dem, siden de var her i sidste uge med deres venner.",
+		"nb": "Alle mennesker er født frie og med samme menneskeverd og menneskerettigheter. De er utstyrt med fornuft og samvittighet og bør handle mot hverandre i brorskapets ånd. Dette er teksten som vi vil oversette, og den blir klar for deg når arbeidet er gjort. Hva synes du om det? Jeg har ikke sett dem siden de var her i forrige uke med vennene sine.",
+		"fi": "Kaikki ihmiset syntyvät vapaina ja tasavertaisina arvoltaan ja oikeuksiltaan. Heille on annettu järki ja omatunto, ja heidän on toimittava toisiaan kohtaan veljeyden hengessä. Tämä on teksti, jonka haluamme kääntää, ja se on valmis sinulle, kun työ on tehty. Mitä mieltä olet siitä? En ole nähnyt heitä sen jälkeen, kun he olivat täällä viime viikolla ystäviensä kanssa.",
+		"tr": "Bütün insanlar hür, haysiyet ve haklar bakımından eşit doğarlar. Akıl ve vicdana sahiptirler ve birbirlerine karşı kardeşlik zihniyeti ile hareket etmelidirler. Bu, çevirmek istediğimiz metindir ve iş bittiğinde sizin için hazır olacak. Bunun hakkında ne düşünüyorsunuz? Geçen hafta arkadaşlarıyla burada olduklarından beri onları görmedim.",
+		"id": "Semua orang dilahirkan merdeka dan mempunyai martabat dan hak-hak yang sama. Mereka dikaruniai akal dan hati nurani dan hendaknya bergaul satu sama lain dalam semangat persaudaraan. Ini adalah teks yang ingin kami terjemahkan, dan akan siap untuk Anda ketika pekerjaan selesai. Apa pendapat Anda tentang hal itu? Saya belum melihat mereka sejak mereka ada di sini minggu lalu dengan teman-teman mereka.",
+		"vi": "Tất cả mọi người sinh ra đều được tự do và bình đẳng về nhân phẩm và quyền. Mọi con người đều được tạo hóa ban cho lý trí và lương tâm và cần phải đối xử với nhau trong tình anh em. Đây là văn bản mà chúng tôi muốn dịch, và nó sẽ sẵn sàng cho bạn khi công việc hoàn thành. Bạn nghĩ gì về điều đó? Tôi đã không gặp họ kể từ khi họ ở đây tuần trước với bạn bè của họ.",
+		"ro": "Toate ființele umane se nasc libere și egale în demnitate și în drepturi. Ele sunt înzestrate cu rațiune și conștiință și trebuie să se comporte unele față de altele în spiritul fraternității. Acesta este textul pe care vrem să îl traducem, și va fi gata pentru dumneavoastră când lucrarea va fi terminată. Ce credeți despre asta? Nu i-am văzut de când au fost aici săptămâna trecută cu prietenii lor.",
+		"cs": "Všichni lidé rodí se svobodní a sobě rovní co do důstojnosti a práv. Jsou nadáni rozumem a svědomím a mají spolu jednat v duchu bratrství. To je text, který chceme přeložit, a bude pro vás připraven, až bude práce hotová. Co si o tom myslíte? Neviděl jsem je od doby, kdy tu byli minulý týden se svými přáteli.",
+		"hu": "Minden emberi lény szabadon születik és egyenlő méltósága és joga van. Az emberek, ésszel és lelkiismerettel bírván, egymással szemben testvéri szellemben kell hogy viseltessenek. Ez az a szöveg, amelyet le akarunk fordítani, és készen lesz az ön számára, amikor a munka elkészül. Mit gondol erről? Nem láttam őket, mióta a múlt héten itt voltak a barátaikkal.",
+	},
+	"Cyrillic": {
+		"ru": "Все люди рождаются свободными и равными в своем достоинстве и правах. Они наделены разумом и совестью и должны поступать в отношении друг друга в духе братства. Это текст, который мы хотим перевести, и он будет готов для вас, когда работа будет закончена. Что вы об этом думаете? Я не видел их с тех пор, как они были здесь на прошлой неделе со своими друзьями.",
+		"uk": "Всі люди народжуються вільними і рівними у своїй гідності та правах. Вони наділені розумом і совістю і повинні діяти у відношенні один до одного в дусі братерства. Це текст, який ми хочемо перекласти, і він буде готовий для вас, коли робота буде завершена. Що ви про це думаєте? Я не бачив їх відтоді, як вони були тут минулого тижня зі своїми друзями.",
+		"bg": "Всички хора се раждат свободни и равни по достойнство и права. Те са надарени с разум и съвест и следва да се отнасят помежду си в дух на братство. Това е текстът, който искаме да преведем, и той ще бъде готов за вас, когато работата бъде свършена. Какво мислите за това? Не съм ги виждал, откакто бяха тук миналата седмица с приятелите си.",
+	},
+	"Arabic": {
+		"ar": "يولد جميع الناس أحرارا متساوين في الكرامة والحقوق. وقد وهبوا عقلا وضميرا وعليهم أن يعامل بعضهم بعضا بروح الإخاء. هذا هو النص الذي نريد ترجمته، وسيكون جاهزا لك عندما ينتهي العمل. ما رأيك في ذلك؟ لم أرهم منذ أن كانوا هنا الأسبوع الماضي مع أصدقائهم.",
+		"fa": "تمام افراد بشر آزاد به دنیا می‌آیند و از لحاظ حیثیت و حقوق با هم برابرند. همه دارای عقل و وجدان هستند و باید نسبت به یکدیگر با روح برادری رفتار کنند. این متنی است که می‌خواهیم ترجمه کنیم، و وقتی کار تمام شد برای شما آماده خواهد بود. نظر شما در این باره چیست؟ از وقتی که هفته گذشته با دوستانشان اینجا بودند آنها را ندیده‌ام.",
+	},
+}
+
+// ngramMarkers are letters that are frequent in a language and rare in the other
+// languages of its script, whose occurrences favor the language.
+var ngramMarkers = map[string]string{
+	"bg": "ъ",
+	"cs": "čěřšůťďž",
+	"da": "æø",
+	"de": "ß",
+	"es": "ñ¿¡",
+	"fr": "œêèëûùï",
+	"hu": "őű",
+	"nb": "æø",
+	"pl": "ąęłńśźż",
+	"pt": "ãõ",
+	"ro": "ășțşţ",
+	"ru": "ыэё",
+	"tr": "ğı",
+	"uk": "іїєґ",
+	"vi": "ạảấầẩẫậắằẳẵặẹẻẽếềểễệỉịọỏốồổỗộớờởỡợụủứừửữựỳỵỷỹđơư",
+	"fa": "پچژگکی",
+}
+
+// ngramScripts are the scripts of ngramSamples.
+var ngramScripts = map[string]*unicode.RangeTable{
+	"Latin":    unicode.Latin,
+	"Cyrillic": unicode.Cyrillic,
+	"Arabic":   unicode.Arabic,
+}
+
+// ngramProfiles are the trigram counts of ngramSamples by script and language, and
+// ngramTotals the number of trigrams of each language.
+var ngramProfiles, ngramTotals = buildNgramProfiles()
+
+func buildNgramProfiles() (map[string]map[string]map[string]int, map[string]int) {
+	profiles, totals := map[string]map[string]map[string]int{}, map[string]int{}
+	for script, samples := range ngramSamples {
+		profiles[script] = map[string]map[string]int{}
+		for code, sample := range samples {
+			profiles[script][code] = map[string]int{}
+			for _, gram := range trigrams(sample) {
+				profiles[script][code][gram]++
+				totals[code]++
+			}
+		}
+	}
+	return profiles, totals
+}
+
+// trigrams returns the character trigrams of the words of text, lower cased and padded
+// with a space on each side.
+func trigrams(text string) []string {
+	var grams []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) && r != '\u200c'
+	})
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
+
+// simplifiedOnly and traditionalOnly are common characters written differently in
+// Simplified and Traditional Chinese.
+const (
+	simplifiedOnly  = "这个们说来时会对国为学发经问见现开关长动么过还没让进请语译话电书门车东马鸟气买卖写听认识读边员务业实应该从"
+	traditionalOnly = "這個們說來時會對國為學發經問見現開關長動麼過還沒讓進請語譯話電書門車東馬鳥氣買賣寫聽認識讀邊員務業實應該從"
+)
+
+// DetectLanguage detects the language of text without the model. The confidence is low
+// for short texts, texts mixing scripts and texts without letters, for which the
+// language code is empty.
+func DetectLanguage(text string) Detection {
+	counts := map[string]int{}
+	var letters, han, kana, simplified, traditional int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+			if strings.ContainsRune(simplifiedOnly, r) {
+				simplified++
+			} else if strings.ContainsRune(traditionalOnly, r) {
+				traditional++
+			}
+		}
+		for _, l := range scriptLanguages {
+			if unicode.Is(l.script, r) {
+				counts[l.code]++
+			}
+		}
+		for script, table := range ngramScripts {
+			if unicode.Is(table, r) {
+				counts[script]++
+			}
+		}
+	}
+	if letters == 0 {
+		return Detection{Method: DetectionScript}
+	}
+
+	best, bestCount := "", 0
+	for key, n := range counts {
+		if n > bestCount || n == bestCount && key < best {
+			best, bestCount = key, n
+		}
+	}
+	if han+kana > bestCount {
+		// Japanese mixes kana with kanji; Chinese has no kana.
+		code := "zh-Hans"
+		if kana > 0 && kana*10 >= han+kana {
+			code = "ja"
+		} else if traditional > simplified {
+			code = "zh-Hant"
+		}
+		return scriptDetection(code, han+kana, letters)
+	}
+	if _, ok := ngramProfiles[best]; !ok {
+		return scriptDetection(best, bestCount, letters)
+	}
+
+	code, posterior := classifyNgrams(best, text)
+	length := math.Min(1, float64(bestCount)/25)
+	return newDetection(code, posterior*length*float64(bestCount)/float64(letters), DetectionNgram)
+}
+
+// scriptDetection is the detection of a language from n of the letters of a text being
+// in its script, certain from 4 letters on when the text has no other letters.
+func scriptDetection(code string, n int, letters int) Detection {
+	length := math.Min(1, 0.6+0.1*float64(n))
+	return newDetection(code, length*float64(n)/float64(letters), DetectionScript)
+}
+
+func newDetection(code string, confidence float64, method DetectionMethod) Detection {
+	detection := Detection{Code: code, Confidence: math.Round(confidence*100) / 100, Method: method}
+	if l, err := ParseLanguage(code); err == nil {
+		detection.Language = l.Name
+	}
+	return detection
+}
+
+// classifyNgrams returns the language of script whose trigrams are the most likely to
+// produce the trigrams of text, and its probability among the languages of the script.
+func classifyNgrams(script string, text string) (string, float64) {
+	const alpha, vocabulary = 0.5, 4000
+	grams := trigrams(text)
+	profiles := ngramProfiles[script]
+	codes := make([]string, 0, len(profiles))
+	for code := range profiles {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	scores := make([]float64, len(codes))
+	for i, code := range codes {
+		total := float64(ngramTotals[code]) + alpha*vocabulary
+		for _, gram := range grams {
+			scores[i] += math.Log((float64(profiles[code][gram]) + alpha) / total)
+		}
+	}
+	// The trigrams of a text are not independent: temper the scores so that short texts
+	// do not get overconfident probabilities. The marker letters then favor their
+	// languages.
+	if len(grams) > 0 {
+		temper := math.Min(float64(len(grams)), 12) / float64(len(grams))
+		for i := range scores {
+			scores[i] *= temper
+		}
+	}
+	for i, code := range codes {
+		markers := 0
+		for _, r := range strings.ToLower(text) {
+			if strings.ContainsRune(ngramMarkers[code], r) {
+				markers++
+			}
+		}
+		scores[i] += 2 * math.Min(float64(markers), 3)
+	}
+	best, max := 0, math.Inf(-1)
+	for i, score := range scores {
+		if score > max {
+			best, max = i, score
+		}
+	}
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - max)
+	}
+	return codes[best], 1 / sum
+}
+
+// DetectLanguage detects the language of text, asking the model when the offline
+// detection is less confident than MinDetectionConfidence.
+func (agent *TranslationAgent) DetectLanguage(ctx context.Context, text string) (Detection, error) {
+	detection := DetectLanguage(text)
+	if detection.Code != "" && detection.Confidence >= agent.minDetectionConfidence() {
+		return detection, nil
+	}
+	if agent.MinDetectionConfidence < 0 {
+		if detection.Code == "" {
+			return detection, ErrLanguageNotDetected
+		}
+		return detection, nil
+	}
+	prompt, err := renderTemplate(languageDetectionPrompt, map[string]interface{}{
+		"text": text,
+	})
+	if err != nil {
+		return detection, fmt.Errorf("render language detection prompt: %v", err)
+	}
+	// The completion is not part of the translation: do not report its tokens.
+	completion, err := agent.getCompletion(WithEvents(ctx, nil), prompt, languageDetectionSystemMessage)
+	if err != nil {
+		return detection, fmt.Errorf("language detection: %w", err)
+	}
+	var answer struct {
+		Code       string  `json:"code"`
+		Language   string  `json:"language"`
+		Confidence float64 `json:"confidence"`
+	}
+	start, end := strings.Index(completion, "{"), strings.LastIndex(completion, "}")
+	if start < 0 || end < start || json.Unmarshal([]byte(completion[start:end+1]), &answer) != nil ||
+		answer.Code == "" || strings.EqualFold(answer.Code, "und") {
+		if detection.Code == "" {
+			return detection, ErrLanguageNotDetected
+		}
+		return detection, nil
+	}
+	model := newDetection(answer.Code, math.Max(0, math.Min(1, answer.Confidence)), DetectionModel)
+	if model.Language == "" {
+		model.Language = answer.Language
+	}
+	if model.Language == "" {
+		model.Language = answer.Code
+	}
+	return model, nil
+}
+
+func (agent *TranslationAgent) minDetectionConfidence() float64 {
+	if agent.MinDetectionConfidence == 0 {
+		return 0.7
+	}
+	return agent.MinDetectionConfidence
+}
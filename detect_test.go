@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestChineseScriptSets(t *testing.T) {
+	if utf8.RuneCountInString(simplifiedOnly) != utf8.RuneCountInString(traditionalOnly) {
+		t.Errorf("simplifiedOnly has %d characters and traditionalOnly %d, want pairs", utf8.RuneCountInString(simplifiedOnly), utf8.RuneCountInString(traditionalOnly))
+	}
+	seen := map[rune]string{}
+	for _, set := range []struct{ name, chars string }{{"simplifiedOnly", simplifiedOnly}, {"traditionalOnly", traditionalOnly}} {
+		for _, r := range set.chars {
+			if name, ok := seen[r]; ok {
+				t.Errorf("%c is in %s and %s", r, name, set.name)
+			}
+			seen[r] = set.name
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text   string
+		code   string
+		method DetectionMethod
+	}{
+		{"这个问题我们现在还没有办法回答", "zh-Hans", DetectionScript},
+		{"這個問題我們現在還沒有辦法回答", "zh-Hant", DetectionScript},
+		{"これは日本語の文章です", "ja", DetectionScript},
+		{"Das ist ein Text, den wir übersetzen wollen, und er ist fertig.", "de", DetectionNgram},
+		{"This is the text that we want to translate into German today.", "en", DetectionNgram},
+		{"123 !!", "", DetectionScript},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.text); got.Code != tt.code || got.Method != tt.method {
+			t.Errorf("DetectLanguage(%q) = %+v, want %s by %s", tt.text, got, tt.code, tt.method)
+		}
+	}
+	if got := DetectLanguage("Hi"); got.Confidence >= 0.7 {
+		t.Errorf("DetectLanguage(%q) = %+v, want a low confidence", "Hi", got)
+	}
+}
+
+func TestAgentDetectLanguageOffline(t *testing.T) {
+	agent := NewTranslationAgent(AgentConfig{MaxTokens: 1000, MinDetectionConfidence: -1})
+	if _, err := agent.DetectLanguage(context.Background(), "123 !!"); !errors.Is(err, ErrLanguageNotDetected) {
+		t.Errorf("DetectLanguage of a text without letters = %v, want %v", err, ErrLanguageNotDetected)
+	}
+	// Without the model, an unsure guess is returned as it is.
+	detection, err := agent.DetectLanguage(context.Background(), "Hi")
+	if want := DetectLanguage("Hi"); err != nil || detection != want {
+		t.Errorf("DetectLanguage of a short text = %+v, %v, want %+v", detection, err, want)
+	}
+}
+
+func TestAgentDetectLanguageModel(t *testing.T) {
+	model := stubmodel.New(t, toGerman)
+	agent := NewTranslationAgent(stubConfig(model))
+	if _, err := agent.DetectLanguage(context.Background(), "123 !!"); !errors.Is(err, ErrLanguageNotDetected) {
+		t.Errorf("DetectLanguage of a text the model cannot tell = %v, want %v", err, ErrLanguageNotDetected)
+	}
+
+	model.Language = "de"
+	detection, err := agent.DetectLanguage(context.Background(), "Hi")
+	if err != nil || detection.Code != "de" || detection.Method != DetectionModel {
+		t.Errorf("DetectLanguage of a short text = %+v, %v, want de by the model", detection, err)
+	}
+	if usage := agent.Usage(); usage.Requests != 2 {
+		t.Errorf("DetectLanguage made %d requests, want 2", usage.Requests)
+	}
+
+	// A sure guess does not ask the model.
+	detection, err = agent.DetectLanguage(context.Background(), "This is the text that we want to translate into German today.")
+	if err != nil || detection.Code != "en" || agent.Usage().Requests != 2 {
+		t.Errorf("DetectLanguage of an English text = %+v, %v after %d requests", detection, err, agent.Usage().Requests)
+	}
+
+	result, err := agent.Execute(context.Background(), TranslationRequest{SourceLang: AutoDetect, TargetLang: "German", SourceText: "Hello world, this is the text that we translate."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DetectedSourceLang == nil || result.DetectedSourceLang.Code != "en" {
+		t.Errorf("detected source language = %+v, want en", result.DetectedSourceLang)
+	}
+}
@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// EPUBOptions controls how an EPUB book is translated.
+type EPUBOptions struct {
+	SourceLang string
+	TargetLang string
+	Country    string
+	// Formality selects the formal or informal form of address, as for TranslationRequest.
+	Formality Formality
+	// Style names one of the StyleProfiles of the agent, as for TranslationRequest.
+	Style string
+
+	// TargetLocale is written to dc:language and to the lang attributes of the documents,
+	// e.g. "de". They are left unchanged when it is empty.
+	TargetLocale string
+
+	// Progress, when set, is called after each chapter has been translated.
+	Progress func(EPUBProgress)
+}
+
+// EPUBProgress reports the translation of one chapter of a book.
+type EPUBProgress struct {
+	Chapter  int // 1-based position in reading order
+	Chapters int
+	Href     string
+	Err      error // set when some of the chapter's text could not be translated
+}
+
+// epubContextRunes is how much text of the previous and the next chapter is shown to the
+// model as context for a chapter.
+const epubContextRunes = 2000
+
+// epubBlockElements are the elements whose text is translated as one segment. Inline
+// markup inside them is kept as protected placeholders.
+var epubBlockElements = map[string]bool{
+	"title": true, "p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "dt": true, "dd": true, "th": true, "td": true, "caption": true, "figcaption": true,
+	"blockquote": true, "div": true, "section": true, "article": true, "aside": true, "header": true,
+	"footer": true, "nav": true, "address": true, "summary": true, "body": true, "main": true,
+	"figure": true, "ol": true, "ul": true, "dl": true, "table": true, "thead": true, "tbody": true,
+	"tfoot": true, "tr": true, "hr": true,
+	"text": true, // NCX navLabel and docTitle
+}
+
+// TranslateEPUB translates an EPUB book and returns the repackaged book. The XHTML
+// documents of the spine are translated in reading order, each with the end of the
+// previous chapter and the start of the next one as context. The navigation document,
+// the NCX table of contents and dc:language are updated as well. Text that could not be
+// translated is kept in the source language and reported in the returned error.
+func (agent *TranslationAgent) TranslateEPUB(ctx context.Context, data []byte, opts EPUBOptions) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open epub: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = content
+	}
+
+	opfPath, err := epubRootFile(files["META-INF/container.xml"])
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := parseOPF(files[opfPath])
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(href string) string {
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		return path.Join(path.Dir(opfPath), strings.SplitN(href, "#", 2)[0])
+	}
+
+	// chapters in reading order, followed by navigation documents outside the spine
+	var chapters []string
+	inSpine := map[string]bool{}
+	items := map[string]opfItem{}
+	for _, item := range pkg.Manifest {
+		items[item.ID] = item
+	}
+	for _, ref := range pkg.Spine.ItemRefs {
+		item, ok := items[ref.IDRef]
+		if ok && strings.Contains(item.MediaType, "html") {
+			chapters = append(chapters, resolve(item.Href))
+			inSpine[resolve(item.Href)] = true
+		}
+	}
+	for _, item := range pkg.Manifest {
+		isNav := strings.Contains(" "+item.Properties+" ", " nav ")
+		isNCX := item.MediaType == "application/x-dtbncx+xml" || item.ID == pkg.Spine.Toc
+		if (isNav || isNCX) && !inSpine[resolve(item.Href)] {
+			chapters = append(chapters, resolve(item.Href))
+		}
+	}
+
+	docs := make([]*spliceDocument, len(chapters))
+	texts := make([]string, len(chapters))
+	for i, name := range chapters {
+		content, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("epub: missing %s", name)
+		}
+		docs[i], err = parseXHTMLBlocks(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		texts[i] = docs[i].plainText()
+	}
+
+	var errs []error
+	for i, name := range chapters {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var segments []Segment
+		for j, s := range docs[i].strings() {
+			segments = append(segments, Segment{ID: fmt.Sprintf("p%d", j+1), Text: s.value})
+		}
+		var chapterErr error
+		if len(segments) > 0 {
+			var surrounding []string
+			if i > 0 && inSpine[name] {
+				surrounding = append(surrounding, "End of the previous chapter:\n"+lastRunes(texts[i-1], epubContextRunes))
+			}
+			if i+1 < len(chapters) && inSpine[name] && inSpine[chapters[i+1]] {
+				surrounding = append(surrounding, "Start of the next chapter:\n"+firstRunes(texts[i+1], epubContextRunes))
+			}
+
+			translations, err := agent.translateSegments(ctx, TranslationRequest{
+				SourceLang: opts.SourceLang,
+				TargetLang: opts.TargetLang,
+				Country:    opts.Country,
+				Formality:  opts.Formality,
+				Style:      opts.Style,
+			}, segments, strings.Join(surrounding, "\n\n"))
+			for j, s := range docs[i].strings() {
+				if translation, ok := translations[fmt.Sprintf("p%d", j+1)]; ok {
+					s.set(translation)
+				}
+			}
+			if err != nil {
+				chapterErr = fmt.Errorf("%s: %w", name, err)
+				errs = append(errs, chapterErr)
+			}
+		}
+		content, err := docs[i].encode()
+		if err != nil {
+			return nil, err
+		}
+		files[name] = setDocumentLanguage(content, opts.TargetLocale)
+		if opts.Progress != nil {
+			opts.Progress(EPUBProgress{Chapter: i + 1, Chapters: len(chapters), Href: name, Err: chapterErr})
+		}
+	}
+	if opts.TargetLocale != "" {
+		files[opfPath] = dcLanguagePattern.ReplaceAll(files[opfPath], []byte("${1}"+escapeXMLText(opts.TargetLocale)+"${2}"))
+	}
+
+	output, err := writeEPUB(archive.File, files)
+	if err != nil {
+		return nil, err
+	}
+	return output, errors.Join(errs...)
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %v", f.Name, err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeEPUB writes the files in their original order, with the uncompressed mimetype
+// entry first as the EPUB container format requires.
+func writeEPUB(entries []*zip.File, files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	write := func(f *zip.File, method uint16) error {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: f.Name, Method: method, Modified: f.Modified})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(files[f.Name])
+		return err
+	}
+	for _, f := range entries {
+		if f.Name == "mimetype" {
+			if err := write(f, zip.Store); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range entries {
+		if f.Name != "mimetype" && !strings.HasSuffix(f.Name, "/") {
+			if err := write(f, zip.Deflate); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type opfPackage struct {
+	Manifest []opfItem `xml:"manifest>item"`
+	Spine    struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+func epubRootFile(container []byte) (string, error) {
+	var c struct {
+		RootFiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(container, &c); err != nil {
+		return "", fmt.Errorf("parse META-INF/container.xml: %v", err)
+	}
+	if len(c.RootFiles) == 0 {
+		return "", fmt.Errorf("epub: no rootfile in META-INF/container.xml")
+	}
+	return c.RootFiles[0].FullPath, nil
+}
+
+func parseOPF(data []byte) (*opfPackage, error) {
+	var pkg opfPackage
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("parse package document: %v", err)
+	}
+	return &pkg, nil
+}
+
+var (
+	dcLanguagePattern   = regexp.MustCompile(`(<dc:language[^>]*>)[^<]*(</dc:language>)`)
+	htmlStartTagPattern = regexp.MustCompile(`<html\b[^>]*>`)
+	langAttrPattern     = regexp.MustCompile(`\b((?:xml:)?lang)="[^"]*"`)
+	tagPattern          = regexp.MustCompile(`<[^>]*>`)
+	entityPattern       = regexp.MustCompile(`^&(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#x[0-9A-Fa-f]+);`)
+)
+
+// setDocumentLanguage sets the lang and xml:lang attributes of the <html> element.
+func setDocumentLanguage(content []byte, locale string) []byte {
+	if locale == "" {
+		return content
+	}
+	loc := htmlStartTagPattern.FindIndex(content)
+	if loc == nil {
+		return content
+	}
+	tag := langAttrPattern.ReplaceAll(content[loc[0]:loc[1]], []byte(`${1}="`+escapeXMLText(locale)+`"`))
+	return append(append(append([]byte{}, content[:loc[0]]...), tag...), content[loc[1]:]...)
+}
+
+// parseXHTMLBlocks finds the text of the block elements of an XHTML or NCX document. Each
+// run of inline content inside a block, up to the next nested block, becomes one value
+// with its inline markup; script and style elements are skipped.
+func parseXHTMLBlocks(data []byte) (*spliceDocument, error) {
+	doc := &spliceDocument{data: data, escape: escapeXHTMLFragment}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	type frame struct {
+		name     string
+		block    bool
+		skip     bool
+		boundary bool // ends the inline run of the enclosing block
+		runStart int
+	}
+	var stack []*frame
+	nearestBlock := func() *frame {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].block {
+				return stack[i]
+			}
+		}
+		return nil
+	}
+	addRun := func(start int, end int) {
+		for start < end && strings.ContainsRune(" \t\r\n", rune(data[start])) {
+			start++
+		}
+		for end > start && strings.ContainsRune(" \t\r\n", rune(data[end-1])) {
+			end--
+		}
+		value := string(data[start:end])
+		if hasTranslatableText(tagPattern.ReplaceAllString(value, " ")) {
+			doc.ranges = append(doc.ranges, spliceRange{start: start, end: end, path: fmt.Sprint(len(doc.ranges) + 1), value: value})
+		}
+	}
+
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			parent := nearestBlock()
+			parentSkip := len(stack) > 0 && stack[len(stack)-1].skip
+			f := &frame{name: name, skip: name == "script" || name == "style" || parentSkip}
+			f.block = epubBlockElements[name] && !f.skip
+			f.boundary = f.block || (f.skip && !parentSkip)
+			if f.boundary && parent != nil {
+				addRun(parent.runStart, offset)
+			}
+			f.runStart = int(decoder.InputOffset())
+			stack = append(stack, f)
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			for len(stack) > 0 {
+				f := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if f.block {
+					addRun(f.runStart, offset)
+				}
+				if parent := nearestBlock(); f.boundary && parent != nil {
+					parent.runStart = int(decoder.InputOffset())
+				}
+				if f.name == name {
+					break
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// plainText returns the values of the document without markup, one per line.
+func (doc *spliceDocument) plainText() string {
+	var lines []string
+	for _, r := range doc.ranges {
+		lines = append(lines, strings.Join(strings.Fields(tagPattern.ReplaceAllString(r.value, " ")), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeXHTMLFragment escapes ampersands that do not start an entity, the one character
+// models tend to introduce into markup unescaped.
+func escapeXHTMLFragment(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '&' && !entityPattern.MatchString(s[i:]) {
+			sb.WriteString("&amp;")
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func firstRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+func lastRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[len(r)-n:])
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseXHTMLBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		xhtml string
+		want  []string
+	}{
+		{
+			name:  "paragraphs",
+			xhtml: `<html><head><title>Book</title></head><body><h1>Chapter 1</h1><p>Hello, <em>world</em>!</p></body></html>`,
+			want:  []string{"Book", "Chapter 1", "Hello, <em>world</em>!"},
+		},
+		{
+			name:  "nested blocks",
+			xhtml: `<body><div>Intro <b>text</b><p>Inner</p>Outro</div></body>`,
+			want:  []string{"Intro <b>text</b>", "Inner", "Outro"},
+		},
+		{
+			name:  "skipped",
+			xhtml: `<body><p>Kept</p><script>var a = "text";</script><style>p { color: red }</style><p>  </p><p>1984</p></body>`,
+			want:  []string{"Kept"},
+		},
+		{
+			name:  "entities",
+			xhtml: `<body><p>Fish &amp; chips&nbsp;today</p></body>`,
+			want:  []string{"Fish &amp; chips&nbsp;today"},
+		},
+		{
+			name:  "ncx",
+			xhtml: `<ncx><docTitle><text>Book</text></docTitle><navMap><navPoint><navLabel><text>Chapter 1</text></navLabel></navPoint></navMap></ncx>`,
+			want:  []string{"Book", "Chapter 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseXHTMLBlocks([]byte(tt.xhtml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range doc.strings() {
+				got = append(got, s.value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseXHTMLBlocks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeXHTMLFragment(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Fish & chips", "Fish &amp; chips"},
+		{"Fish &amp; chips &#38; &#x26; &nbsp;", "Fish &amp; chips &#38; &#x26; &nbsp;"},
+		{"<b>A&B</b>", "<b>A&amp;B</b>"},
+	}
+	for _, tt := range tests {
+		if got := escapeXHTMLFragment(tt.in); got != tt.want {
+			t.Errorf("escapeXHTMLFragment(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSetDocumentLanguage(t *testing.T) {
+	tests := []struct {
+		in, locale, want string
+	}{
+		{`<html xmlns="x" lang="en" xml:lang="en"><body/></html>`, "de", `<html xmlns="x" lang="de" xml:lang="de"><body/></html>`},
+		{`<html lang="en">`, "", `<html lang="en">`},
+		{`<ncx><text lang="en"/></ncx>`, "de", `<ncx><text lang="en"/></ncx>`},
+	}
+	for _, tt := range tests {
+		if got := string(setDocumentLanguage([]byte(tt.in), tt.locale)); got != tt.want {
+			t.Errorf("setDocumentLanguage(%q, %q) = %q, want %q", tt.in, tt.locale, got, tt.want)
+		}
+	}
+}
+
+// epubFiles are the files of a small book, in the order they are zipped.
+var epubFiles = []struct {
+	name, content string
+}{
+	{"mimetype", "application/epub+zip"},
+	{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+	{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:language>en</dc:language></metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`},
+	{"OEBPS/nav.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml" lang="en"><body><nav><ol><li><a href="text/chapter%201.xhtml">Chapter 1</a></li></ol></nav></body></html>`},
+	{"OEBPS/text/chapter 1.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml" lang="en" xml:lang="en"><body><h1>Chapter 1</h1><p>Hello, <em>world</em>!</p></body></html>`},
+	{"OEBPS/text/chapter2.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml" lang="en"><body><p>The end</p></body></html>`},
+	{"OEBPS/style.css", `p { margin: 0 }`},
+}
+
+func TestTranslateEPUB(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range epubFiles {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(f.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := newStubAgent(t, toGerman)
+	var progress []string
+	book, err := agent.TranslateEPUB(context.Background(), buf.Bytes(), EPUBOptions{
+		SourceLang:   "English",
+		TargetLang:   "German",
+		TargetLocale: "de",
+		Progress: func(p EPUBProgress) {
+			if p.Chapters != 3 || p.Err != nil {
+				t.Errorf("progress %+v", p)
+			}
+			progress = append(progress, p.Href)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"OEBPS/text/chapter 1.xhtml", "OEBPS/text/chapter2.xhtml", "OEBPS/nav.xhtml"}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress = %q, want %q", progress, want)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(book), int64(len(book)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := archive.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry is %s with method %d, want an uncompressed mimetype", first.Name, first.Method)
+	}
+	got := map[string]string{}
+	for _, f := range archive.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[f.Name] = string(content)
+	}
+	want := map[string]string{
+		"OEBPS/text/chapter 1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml" lang="de" xml:lang="de"><body><h1>Kapitel 1</h1><p>Hallo, <em>world</em>!</p></body></html>`,
+		"OEBPS/text/chapter2.xhtml":  `<html xmlns="http://www.w3.org/1999/xhtml" lang="de"><body><p>Das Ende</p></body></html>`,
+		"OEBPS/nav.xhtml":            `<html xmlns="http://www.w3.org/1999/xhtml" lang="de"><body><nav><ol><li><a href="text/chapter%201.xhtml">Kapitel 1</a></li></ol></nav></body></html>`,
+		"OEBPS/style.css":            `p { margin: 0 }`,
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got[name], content)
+		}
+	}
+	if !strings.Contains(got["OEBPS/content.opf"], "<dc:language>de</dc:language>") {
+		t.Errorf("content.opf does not set dc:language to de:\n%s", got["OEBPS/content.opf"])
+	}
+}
+
+func TestTranslateEPUBInvalid(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	if _, err := agent.TranslateEPUB(context.Background(), []byte("not a zip"), EPUBOptions{SourceLang: "English", TargetLang: "German"}); err == nil {
+		t.Error("TranslateEPUB of a file that is not a zip archive did not fail")
+	}
+}
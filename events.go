@@ -0,0 +1,125 @@
+package internal
+
+import "context"
+
+// Stage is a step of the translation of a chunk.
+type Stage string
+
+const (
+	StageInitialTranslation Stage = "initial_translation"
+	StageReflection         Stage = "reflection"
+	StageImprovement        Stage = "improvement"
+)
+
+// EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventSplit reports the number of chunks the text was split into.
+	EventSplit EventType = "split"
+	// EventStageStarted reports that a stage starts on a chunk.
+	EventStageStarted EventType = "stage_started"
+	// EventToken carries a piece of a completion as the model streams it. The text may
+	// hold placeholder tokens such as <ph_1/>.
+	EventToken EventType = "token"
+	// EventRetry reports that a completion lost placeholders and is requested again, so
+	// its tokens are to be discarded.
+	EventRetry EventType = "retry"
+	// EventDraft, EventReflection and EventFinal carry the output of the stages of a chunk.
+	EventDraft      EventType = "draft"
+	EventReflection EventType = "reflection"
+	EventFinal      EventType = "final"
+	// EventDone and EventError end the events of ExecuteStream, with the result or the
+	// error of the translation.
+	EventDone  EventType = "done"
+	EventError EventType = "error"
+)
+
+// Event reports the progress of a translation.
+type Event struct {
+	Type  EventType `json:"type"`
+	Stage Stage     `json:"stage,omitempty"`
+	// Chunk is the number of the chunk, starting at 1, and Chunks their count.
+	Chunk  int                `json:"chunk,omitempty"`
+	Chunks int                `json:"chunks,omitempty"`
+	Text   string             `json:"text,omitempty"`
+	Result *TranslationResult `json:"result,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	// TargetLang is the target language, as given, of the events of TranslateMany, or
+	// the pivot language of the events of the first leg of a pivot translation.
+	TargetLang string `json:"target_lang,omitempty"`
+}
+
+type eventsKey struct{}
+
+type stepKey struct{}
+
+type targetKey struct{}
+
+type stepInfo struct {
+	stage  Stage
+	chunk  int
+	chunks int
+}
+
+// WithEvents returns a context that makes the translations run with it call fn with
+// their progress, and stream the completions of the model as EventToken events. fn is
+// called from the translating goroutine and should return quickly.
+func WithEvents(ctx context.Context, fn func(Event)) context.Context {
+	return context.WithValue(ctx, eventsKey{}, fn)
+}
+
+func emitEvent(ctx context.Context, event Event) {
+	if fn, ok := ctx.Value(eventsKey{}).(func(Event)); ok && fn != nil {
+		if step, ok := ctx.Value(stepKey{}).(stepInfo); ok {
+			if event.Stage == "" {
+				event.Stage = step.stage
+			}
+			if event.Chunk == 0 {
+				event.Chunk, event.Chunks = step.chunk, step.chunks
+			}
+		}
+		if targetLang, ok := ctx.Value(targetKey{}).(string); ok {
+			event.TargetLang = targetLang
+		}
+		fn(event)
+	}
+}
+
+func hasEvents(ctx context.Context) bool {
+	fn, ok := ctx.Value(eventsKey{}).(func(Event))
+	return ok && fn != nil
+}
+
+// withStep returns a context whose events belong to a stage of chunk i of n.
+func withStep(ctx context.Context, stage Stage, i int, n int) context.Context {
+	return context.WithValue(ctx, stepKey{}, stepInfo{stage: stage, chunk: i + 1, chunks: n})
+}
+
+// withTarget returns a context whose events belong to the translation into targetLang.
+func withTarget(ctx context.Context, targetLang string) context.Context {
+	return context.WithValue(ctx, targetKey{}, targetLang)
+}
+
+// ExecuteStream runs Execute in the background and returns its events. The channel is
+// closed after a final EventDone or EventError event. The caller must read the channel
+// until it is closed, or cancel ctx.
+func (agent *TranslationAgent) ExecuteStream(ctx context.Context, req TranslationRequest) <-chan Event {
+	events := make(chan Event, 64)
+	send := func(event Event) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		result, err := agent.Execute(WithEvents(ctx, send), req)
+		if err != nil {
+			send(Event{Type: EventError, Error: err.Error()})
+			return
+		}
+		send(Event{Type: EventDone, Result: result})
+	}()
+	return events
+}
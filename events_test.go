@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestExecuteStream(t *testing.T) {
+	agent := NewTranslationAgent(stubConfig(stubmodel.New(t, toGerman)))
+	req := TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"}
+
+	var types []string
+	var tokens strings.Builder
+	var last Event
+	for event := range agent.ExecuteStream(context.Background(), req) {
+		if event.Type == EventToken {
+			if event.Stage == StageImprovement {
+				tokens.WriteString(event.Text)
+			}
+			if types[len(types)-1] == string(EventToken) {
+				continue
+			}
+		}
+		name := string(event.Type)
+		if event.Type == EventStageStarted {
+			name += " " + string(event.Stage)
+		}
+		types = append(types, name)
+		last = event
+	}
+	want := []string{
+		"split",
+		"stage_started initial_translation", "token", "draft",
+		"stage_started reflection", "token", "reflection",
+		"stage_started improvement", "token", "final",
+		"done",
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("events = %q, want %q", types, want)
+	}
+	if got := tokens.String(); got != "Hallo" {
+		t.Errorf("tokens of the improvement = %q, want Hallo", got)
+	}
+	if last.Result == nil || last.Result.Translation != "Hallo" {
+		t.Errorf("done event = %+v, want the result", last)
+	}
+}
+
+func TestExecuteStreamError(t *testing.T) {
+	agent := NewTranslationAgent(stubConfig(stubmodel.New(t, toGerman)))
+	var last Event
+	for event := range agent.ExecuteStream(context.Background(), TranslationRequest{TargetLang: "German"}) {
+		last = event
+	}
+	if last.Type != EventError || last.Error == "" {
+		t.Errorf("last event of a failed translation = %+v, want an error", last)
+	}
+}
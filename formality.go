@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Formality is the form of address a translation uses, as in the DeepL API.
+type Formality string
+
+const (
+	// FormalityDefault leaves the form of address to the model, which usually follows the
+	// source text.
+	FormalityDefault Formality = "default"
+	// FormalityMore and FormalityLess ask for the formal or the informal form of address,
+	// and fail for target languages that do not have both.
+	FormalityMore Formality = "more"
+	FormalityLess Formality = "less"
+	// FormalityPreferMore and FormalityPreferLess ask for the same, and are ignored for
+	// target languages that do not have both.
+	FormalityPreferMore Formality = "prefer_more"
+	FormalityPreferLess Formality = "prefer_less"
+)
+
+// ErrFormalityNotSupported is returned for a request asking for FormalityMore or
+// FormalityLess in a target language without formal and informal forms of address.
+var ErrFormalityNotSupported = errors.New("formality is not supported for the target language")
+
+// formalAddress are the formal and informal forms of address of the languages that
+// support Formality, by base language.
+var formalAddress = map[string][2]string{
+	"de": {"Sie", "du"},
+	"es": {"usted", "tú"},
+	"fr": {"vous", "tu"},
+	"it": {"Lei", "tu"},
+	"ja": {"丁寧語 such as です and ます, with 敬語 where appropriate", "plain form such as だ and だよ"},
+	"ko": {"존댓말 such as 합니다 and 해요", "반말"},
+	"nl": {"u", "je and jij"},
+	"pl": {"Pan and Pani", "ty"},
+	"pt": {"o senhor and a senhora", "você or tu"},
+	"ru": {"Вы", "ты"},
+}
+
+// SupportsFormality reports whether a language, given as for TranslationRequest, has
+// formal and informal forms of address that Formality selects.
+func SupportsFormality(lang string) bool {
+	l, err := ParseLanguage(lang)
+	if err != nil {
+		return false
+	}
+	base, _ := l.Tag.Base()
+	_, ok := formalAddress[base.String()]
+	return ok
+}
+
+// validateFormality checks the formality of req against its target language.
+func validateFormality(req TranslationRequest) error {
+	switch req.Formality {
+	case "", FormalityDefault, FormalityPreferMore, FormalityPreferLess:
+		return nil
+	case FormalityMore, FormalityLess:
+		if !SupportsFormality(req.TargetLang) {
+			return fmt.Errorf("%w %s", ErrFormalityNotSupported, req.TargetLang)
+		}
+		return nil
+	}
+	return checkFormality(req.Formality)
+}
+
+// checkFormality checks that f is empty or one of the Formality values.
+func checkFormality(f Formality) error {
+	switch f {
+	case "", FormalityDefault, FormalityMore, FormalityLess, FormalityPreferMore, FormalityPreferLess:
+		return nil
+	}
+	return fmt.Errorf("unknown formality %q, expected default, more, less, prefer_more or prefer_less", f)
+}
+
+// formalityInstruction renders the form of address req asks for, for the initial
+// translation and improvement steps, or for the reflection step, which checks that the
+// translation keeps to it. It returns an empty string when req leaves it to the model or
+// the target language does not have formal and informal forms.
+func formalityInstruction(req TranslationRequest, reflection bool) (string, error) {
+	var formal bool
+	switch req.Formality {
+	case FormalityMore, FormalityPreferMore:
+		formal = true
+	case FormalityLess, FormalityPreferLess:
+	default:
+		return "", nil
+	}
+	l, err := ParseLanguage(req.TargetLang)
+	if err != nil {
+		return "", nil
+	}
+	base, _ := l.Tag.Base()
+	forms, ok := formalAddress[base.String()]
+	if !ok {
+		return "", nil
+	}
+	address := forms[1]
+	if formal {
+		address = forms[0]
+	}
+	instruction, err := renderTemplate(formalityPrompt, map[string]interface{}{
+		"targetLang": req.TargetLang,
+		"formal":     formal,
+		"address":    address,
+		"reflection": reflection,
+	})
+	if err != nil {
+		return "", fmt.Errorf("render formality: %v", err)
+	}
+	return instruction, nil
+}
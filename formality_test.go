@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestSupportsFormality(t *testing.T) {
+	tests := []struct {
+		lang string
+		want bool
+	}{
+		{"German", true},
+		{"de-AT", true},
+		{"pt-BR", true},
+		{"Japanese", true},
+		{"English", false},
+		{"zh-Hans", false},
+		{"not a language", false},
+	}
+	for _, tt := range tests {
+		if got := SupportsFormality(tt.lang); got != tt.want {
+			t.Errorf("SupportsFormality(%q) = %v, want %v", tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestFormality(t *testing.T) {
+	model := stubmodel.New(t, toGerman)
+	agent := NewTranslationAgent(stubConfig(model))
+	req := TranslationRequest{SourceLang: "German", TargetLang: "English", SourceText: "Hallo", Formality: FormalityMore}
+	if _, err := agent.Execute(context.Background(), req); !errors.Is(err, ErrFormalityNotSupported) {
+		t.Errorf("Execute with formality more into English = %v, want %v", err, ErrFormalityNotSupported)
+	}
+	if len(model.Prompts()) != 0 {
+		t.Errorf("the model was asked %d prompts for an unsupported formality", len(model.Prompts()))
+	}
+
+	// The preferences are ignored where they do not apply.
+	req.Formality = FormalityPreferMore
+	if _, err := agent.Execute(context.Background(), req); err != nil {
+		t.Errorf("Execute with formality prefer_more into English: %v", err)
+	}
+	if model.Asked("formal") {
+		t.Error("the model was asked for a form of address English does not have")
+	}
+
+	req = TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello", Formality: FormalityMore}
+	if _, err := agent.Execute(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if !model.Asked("Sie") {
+		t.Error("the model was not asked for the formal form of address")
+	}
+
+	req.Formality = "very"
+	if _, err := agent.Execute(context.Background(), req); err == nil || errors.Is(err, ErrFormalityNotSupported) {
+		t.Errorf("Execute with an unknown formality = %v, want an invalid formality", err)
+	}
+}
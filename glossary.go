@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GlossaryEntry is a term and the translation it must be given.
+type GlossaryEntry struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Glossary is a list of terms with fixed translations. Only the entries whose source term
+// occurs in a chunk are added to its prompts.
+type Glossary []GlossaryEntry
+
+// LoadGlossary reads a glossary file with a source term and its translation on each
+// line, separated by a tab in .tsv files and by a comma otherwise. Empty lines and lines
+// starting with # are skipped.
+func LoadGlossary(path string) (Glossary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	glossary, err := ParseGlossary(f, strings.EqualFold(filepath.Ext(path), ".tsv"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return glossary, nil
+}
+
+// ParseGlossary reads a glossary in the format of LoadGlossary, with tab separated
+// columns when tsv is set.
+func ParseGlossary(r io.Reader, tsv bool) (Glossary, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	if tsv {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+	var glossary Glossary
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return glossary, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != 2 {
+			return nil, fmt.Errorf("line %d: expected a term and its translation, got %d fields", line, len(record))
+		}
+		source, target := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if source == "" || target == "" {
+			return nil, fmt.Errorf("line %d: empty term", line)
+		}
+		glossary = append(glossary, GlossaryEntry{Source: source, Target: target})
+	}
+}
+
+// matching returns the entries whose source term occurs in text, ignoring case.
+func (glossary Glossary) matching(text string) Glossary {
+	var matches Glossary
+	lower := strings.ToLower(text)
+	for _, entry := range glossary {
+		if strings.Contains(lower, strings.ToLower(entry.Source)) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
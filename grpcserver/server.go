@@ -0,0 +1,364 @@
+// Package grpcserver serves the translation agent over gRPC with the TranslationService
+// of proto/translation/v1/translation.proto.
+package grpcserver
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=github.com/zaigie/translation-agent-go --go-grpc_out=.. --go-grpc_opt=module=github.com/zaigie/translation-agent-go translation/v1/translation.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	ta "github.com/zaigie/translation-agent-go"
+	"github.com/zaigie/translation-agent-go/jobs"
+	pb "github.com/zaigie/translation-agent-go/translationpb"
+)
+
+// Config configures a Service.
+type Config struct {
+	// Agent is the configuration of the agents translating the requests.
+	Agent ta.AgentConfig
+	// APIKeys are the keys clients must send in the "authorization" metadata as
+	// "Bearer <key>" or in "x-api-key". The service is open when there are none.
+	APIKeys []string
+	// Tenants maps API keys to the tenant owning the jobs created with them, as in
+	// server.Config.
+	Tenants map[string]string
+	// Queue runs the jobs. Pass the queue of the HTTP server to share the jobs with it.
+	Queue *jobs.Queue
+}
+
+// Service implements TranslationService with the agent.
+type Service struct {
+	pb.UnimplementedTranslationServiceServer
+	config Config
+}
+
+// NewService returns the service of config.
+func NewService(config Config) *Service {
+	return &Service{config: config}
+}
+
+// NewServer returns a gRPC server with the service registered and, when there are API
+// keys, interceptors checking them.
+func NewServer(config Config, opts ...grpc.ServerOption) *grpc.Server {
+	service := NewService(config)
+	if len(config.APIKeys) > 0 {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(service.authenticateUnary),
+			grpc.ChainStreamInterceptor(service.authenticateStream))
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterTranslationServiceServer(server, service)
+	return server
+}
+
+func (s *Service) Translate(ctx context.Context, in *pb.TranslateRequest) (*pb.TranslateResponse, error) {
+	req, err := s.translationRequest(in)
+	if err != nil {
+		return nil, err
+	}
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	result, err := agent.Execute(ctx, req)
+	if err != nil {
+		return nil, translationError(err)
+	}
+	return &pb.TranslateResponse{Result: protoResult(result), Usage: protoUsage(agent.Usage())}, nil
+}
+
+func (s *Service) TranslateStream(in *pb.TranslateRequest, stream grpc.ServerStreamingServer[pb.TranslationEvent]) error {
+	req, err := s.translationRequest(in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	for event := range agent.ExecuteStream(ctx, req) {
+		if event.Type == ta.EventError {
+			// The event only carries the message, so a canceled or expired stream is
+			// told by its context.
+			if err := stream.Context().Err(); err != nil {
+				return translationError(err)
+			}
+			return translationError(errors.New(event.Error))
+		}
+		out := &pb.TranslationEvent{
+			Type:       eventTypes[event.Type],
+			Stage:      stages[event.Stage],
+			Chunk:      int32(event.Chunk),
+			Chunks:     int32(event.Chunks),
+			Text:       event.Text,
+			TargetLang: event.TargetLang,
+		}
+		if event.Type == ta.EventDone {
+			out.Result, out.Usage = protoResult(event.Result), protoUsage(agent.Usage())
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return translationError(err)
+	}
+	return nil
+}
+
+func (s *Service) CreateJob(ctx context.Context, in *pb.CreateJobRequest) (*pb.Job, error) {
+	req, err := s.translationRequest(in.GetRequest())
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.config.Queue.Submit(req, jobs.SubmitOptions{
+		Tenant:      s.tenant(ctx),
+		Priority:    int(in.GetPriority()),
+		CallbackURL: in.GetCallbackUrl(),
+	})
+	switch {
+	case errors.Is(err, jobs.ErrInvalidCallback):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, jobs.ErrQueueFull):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, jobs.ErrClosed):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return protoJob(job), nil
+}
+
+func (s *Service) GetJob(ctx context.Context, in *pb.GetJobRequest) (*pb.Job, error) {
+	job, ok := s.config.Queue.Get(in.GetId())
+	if !ok || job.Tenant != s.tenant(ctx) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+	return protoJob(job), nil
+}
+
+func (s *Service) ListJobs(ctx context.Context, in *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	var out pb.ListJobsResponse
+	tenant := s.tenant(ctx)
+	for _, job := range s.config.Queue.List() {
+		if job.Tenant == tenant {
+			out.Jobs = append(out.Jobs, protoJob(job))
+		}
+	}
+	return &out, nil
+}
+
+func (s *Service) CancelJob(ctx context.Context, in *pb.CancelJobRequest) (*pb.Job, error) {
+	job, ok := s.config.Queue.Get(in.GetId())
+	if !ok || job.Tenant != s.tenant(ctx) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+	job, err := s.config.Queue.Cancel(job.ID)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, jobs.ErrFinished):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return protoJob(job), nil
+}
+
+func (s *Service) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Service) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authenticate checks that the metadata of a call holds one of the API keys.
+func (s *Service) authenticate(ctx context.Context) error {
+	key := requestKey(ctx)
+	valid := false
+	for _, apiKey := range s.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			valid = true
+		}
+	}
+	if key == "" || !valid {
+		return status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+	return nil
+}
+
+// requestKey returns the API key of a call, sent in the x-api-key metadata or in
+// authorization as a bearer token.
+func requestKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return keys[0]
+	}
+	if auth := md.Get("authorization"); len(auth) > 0 && strings.HasPrefix(auth[0], "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth[0], "Bearer "))
+	}
+	return ""
+}
+
+// tenant returns the tenant of the API key of a call.
+func (s *Service) tenant(ctx context.Context) string {
+	return s.config.Tenants[requestKey(ctx)]
+}
+
+// translationError returns the status of a failed translation: the context error when
+// the call was canceled, and Unavailable when the model failed.
+func translationError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func (s *Service) translationRequest(in *pb.TranslateRequest) (ta.TranslationRequest, error) {
+	req := ta.TranslationRequest{
+		SourceLang: in.GetSourceLang(),
+		TargetLang: in.GetTargetLang(),
+		SourceText: in.GetSourceText(),
+		Country:    in.GetCountry(),
+		PivotLang:  in.GetPivotLang(),
+		Style:      in.GetStyle(),
+		Formality:  ta.Formality(in.GetFormality()),
+	}
+	switch {
+	case req.TargetLang == "":
+		return req, status.Error(codes.InvalidArgument, "missing target_lang")
+	case strings.TrimSpace(req.SourceText) == "":
+		return req, status.Error(codes.InvalidArgument, "missing source_text")
+	}
+	if err := ta.ValidateLanguages(req); err != nil {
+		return req, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := s.config.Agent.StyleProfile(req.Style); err != nil {
+		return req, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return req, nil
+}
+
+var eventTypes = map[ta.EventType]pb.TranslationEvent_Type{
+	ta.EventSplit:        pb.TranslationEvent_TYPE_SPLIT,
+	ta.EventStageStarted: pb.TranslationEvent_TYPE_STAGE_STARTED,
+	ta.EventToken:        pb.TranslationEvent_TYPE_TOKEN,
+	ta.EventRetry:        pb.TranslationEvent_TYPE_RETRY,
+	ta.EventDraft:        pb.TranslationEvent_TYPE_DRAFT,
+	ta.EventReflection:   pb.TranslationEvent_TYPE_REFLECTION,
+	ta.EventFinal:        pb.TranslationEvent_TYPE_FINAL,
+	ta.EventDone:         pb.TranslationEvent_TYPE_DONE,
+}
+
+var stages = map[ta.Stage]pb.Stage{
+	ta.StageInitialTranslation: pb.Stage_STAGE_INITIAL_TRANSLATION,
+	ta.StageReflection:         pb.Stage_STAGE_REFLECTION,
+	ta.StageImprovement:        pb.Stage_STAGE_IMPROVEMENT,
+}
+
+var jobStatuses = map[jobs.Status]pb.JobStatus{
+	jobs.StatusQueued:    pb.JobStatus_JOB_STATUS_QUEUED,
+	jobs.StatusRunning:   pb.JobStatus_JOB_STATUS_RUNNING,
+	jobs.StatusSucceeded: pb.JobStatus_JOB_STATUS_SUCCEEDED,
+	jobs.StatusFailed:    pb.JobStatus_JOB_STATUS_FAILED,
+	jobs.StatusCanceled:  pb.JobStatus_JOB_STATUS_CANCELED,
+}
+
+func protoResult(result *ta.TranslationResult) *pb.TranslationResult {
+	if result == nil {
+		return nil
+	}
+	out := &pb.TranslationResult{
+		Translation: result.Translation,
+		Skipped:     result.Skipped,
+		Pivot:       protoResult(result.Pivot),
+		PivotLang:   result.PivotLang,
+	}
+	if detection := result.DetectedSourceLang; detection != nil {
+		out.DetectedSourceLang = &pb.Detection{
+			Code:       detection.Code,
+			Language:   detection.Language,
+			Confidence: detection.Confidence,
+			Method:     string(detection.Method),
+		}
+	}
+	for _, chunk := range result.Chunks {
+		out.Chunks = append(out.Chunks, &pb.ChunkResult{
+			SourceText:   chunk.SourceText,
+			Translation1: chunk.Translation1,
+			Reflection:   chunk.Reflection,
+			Translation2: chunk.Translation2,
+		})
+	}
+	return out
+}
+
+func protoUsage(usage ta.Usage) *pb.Usage {
+	return &pb.Usage{
+		Requests:         int64(usage.Requests),
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+	}
+}
+
+func protoJob(job jobs.Job) *pb.Job {
+	return &pb.Job{
+		Id:     job.ID,
+		Status: jobStatuses[job.Status],
+		Request: &pb.TranslateRequest{
+			SourceLang: job.Request.SourceLang,
+			TargetLang: job.Request.TargetLang,
+			SourceText: job.Request.SourceText,
+			Country:    job.Request.Country,
+			PivotLang:  job.Request.PivotLang,
+			Style:      job.Request.Style,
+			Formality:  string(job.Request.Formality),
+		},
+		Result:         protoResult(job.Result),
+		Usage:          protoUsage(job.Usage),
+		Error:          job.Error,
+		CreatedAt:      timestamppb.New(job.CreatedAt),
+		StartedAt:      protoTime(job.StartedAt),
+		FinishedAt:     protoTime(job.FinishedAt),
+		Tenant:         job.Tenant,
+		Priority:       int32(job.Priority),
+		CallbackUrl:    job.CallbackURL,
+		CallbackStatus: string(job.CallbackStatus),
+		Deliveries:     protoDeliveries(job.Deliveries),
+	}
+}
+
+func protoDeliveries(deliveries []jobs.Delivery) []*pb.Delivery {
+	var out []*pb.Delivery
+	for _, delivery := range deliveries {
+		out = append(out, &pb.Delivery{
+			Attempt:    int32(delivery.Attempt),
+			Time:       timestamppb.New(delivery.Time),
+			StatusCode: int32(delivery.StatusCode),
+			Error:      delivery.Error,
+			Duration:   durationpb.New(time.Duration(delivery.Duration * float64(time.Second))),
+		})
+	}
+	return out
+}
+
+func protoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
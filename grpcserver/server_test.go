@@ -0,0 +1,160 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	ta "github.com/zaigie/translation-agent-go"
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+	pb "github.com/zaigie/translation-agent-go/translationpb"
+)
+
+// dial serves config over an in-memory connection and returns a client calling it with
+// the API key "secret".
+func dial(t *testing.T, config Config, opts ...grpc.ServerOption) pb.TranslationServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(config, opts...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret"), method, req, reply, cc, opts...)
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret"), desc, cc, method, opts...)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewTranslationServiceClient(conn)
+}
+
+func agentConfig(url string) ta.AgentConfig {
+	return ta.AgentConfig{BaseURL: url, ApiKey: "test", ModelName: "gpt-4o-mini", MaxTokens: 1000}
+}
+
+func TestTranslate(t *testing.T) {
+	model := stubmodel.New(t, strings.NewReplacer("Hello", "Hallo").Replace)
+	client := dial(t, Config{Agent: agentConfig(model.URL), APIKeys: []string{"secret"}})
+	in := &pb.TranslateRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"}
+
+	response, err := client.Translate(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result.Translation != "Hallo" || response.Usage.Requests != 3 {
+		t.Errorf("Translate = %v, want Hallo after 3 requests", response)
+	}
+	if _, err := client.Translate(context.Background(), &pb.TranslateRequest{SourceText: "Hello"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Translate without a target language = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	stream, err := client.TranslateStream(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *pb.TranslationEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = event
+	}
+	if last.GetType() != pb.TranslationEvent_TYPE_DONE || last.Result.Translation != "Hallo" {
+		t.Errorf("last event = %v, want done with Hallo", last)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	client := dial(t, Config{APIKeys: []string{"other"}})
+	if _, err := client.Translate(context.Background(), &pb.TranslateRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Translate with a wrong key = %v, want %v", err, codes.Unauthenticated)
+	}
+}
+
+func TestTranslateStreamCanceled(t *testing.T) {
+	// The model does not answer. Its request is canceled once the body is read, when the
+	// client closes the connection.
+	asked := make(chan struct{}, 10)
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		asked <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer model.Close()
+	returned := make(chan error, 1)
+	record := func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, stream)
+		returned <- err
+		return err
+	}
+	client := dial(t, Config{Agent: agentConfig(model.URL)}, grpc.ChainStreamInterceptor(record))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.TranslateStream(ctx, &pb.TranslateRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-asked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the model was not asked")
+	}
+	cancel()
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if status.Code(err) != codes.Canceled {
+				t.Errorf("Recv of a canceled stream = %v, want %v", err, codes.Canceled)
+			}
+			break
+		}
+	}
+	select {
+	case err := <-returned:
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("TranslateStream of a canceled call returned %v, want %v", err, codes.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TranslateStream did not return")
+	}
+}
+
+func TestTranslationError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{context.Canceled, codes.Canceled},
+		{fmt.Errorf("language detection: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{errors.New("model unavailable"), codes.Unavailable},
+	}
+	for _, tt := range tests {
+		if got := status.Code(translationError(tt.err)); got != tt.code {
+			t.Errorf("translationError(%v) = %v, want %v", tt.err, got, tt.code)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// I18nFormat is the syntax of a locale resource file.
+type I18nFormat int
+
+const (
+	I18nJSON         I18nFormat = iota // nested JSON (i18next, vue-i18n)
+	I18nYAML                           // nested YAML (Rails, vue-i18n)
+	I18nAndroidXML                     // Android res/values/strings.xml
+	I18nAppleStrings                   // Apple Localizable.strings
+	I18nStringsDict                    // Apple .stringsdict plural rules
+	I18nXCStrings                      // Apple String Catalog (.xcstrings)
+)
+
+// DetectI18nFormat returns the resource format for a file name based on its extension.
+func DetectI18nFormat(filename string) (I18nFormat, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return I18nJSON, nil
+	case ".yaml", ".yml":
+		return I18nYAML, nil
+	case ".xml":
+		return I18nAndroidXML, nil
+	case ".strings":
+		return I18nAppleStrings, nil
+	case ".stringsdict":
+		return I18nStringsDict, nil
+	case ".xcstrings":
+		return I18nXCStrings, nil
+	}
+	return 0, fmt.Errorf("unsupported locale file %q", filename)
+}
+
+// I18nOptions controls how a locale resource file is translated.
+type I18nOptions struct {
+	SourceLang string
+	TargetLang string
+	Country    string
+	// Formality selects the formal or informal form of address, as for TranslationRequest.
+	Formality Formality
+	// Style names one of the StyleProfiles of the agent, as for TranslationRequest.
+	Style string
+
+	// Existing is the current content of the target locale file. When set, only keys
+	// missing from it (or empty in it) are translated and the other values are kept.
+	Existing []byte
+
+	// SourceLocale and TargetLocale are locale codes such as "en" and "de". They rename a
+	// single top-level locale key in Rails style files (en: → de:) and select the
+	// localization written to a String Catalog, which requires TargetLocale. TargetLocale
+	// also selects the plural categories of ICU messages, those of TargetLang otherwise.
+	SourceLocale string
+	TargetLocale string
+}
+
+// i18nString is a translatable string value found in a resource tree.
+type i18nString struct {
+	path    string
+	value   string
+	context string
+	set     func(string)
+}
+
+// TranslateI18n translates the string values of a locale resource file and returns the
+// translated file. Keys, key order, comments and non-string values are preserved.
+// Strings are translated in batches with TranslateSegments, so placeholders such as
+// {{name}} or %{count} are protected. Values that fail to translate keep their
+// source text and are reported in the returned error together with the output.
+func (agent *TranslationAgent) TranslateI18n(ctx context.Context, data []byte, format I18nFormat, opts I18nOptions) ([]byte, error) {
+	doc, err := parseI18n(data, format, opts)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]string{}
+	if len(bytes.TrimSpace(opts.Existing)) > 0 {
+		existingDoc, err := parseI18n(opts.Existing, format, opts)
+		if err != nil {
+			return nil, fmt.Errorf("parse existing translation: %v", err)
+		}
+		existingDoc.renameRoot(opts.TargetLocale, opts.SourceLocale)
+		for _, s := range existingDoc.strings() {
+			existing[s.path] = s.value
+		}
+	}
+	var segments []Segment
+	pending := map[string]i18nString{}
+	messages := map[string]func(map[string]string) (string, error){}
+	for _, s := range doc.strings() {
+		if translation, ok := existing[s.path]; ok && translation != "" {
+			s.set(translation)
+			continue
+		}
+		if strings.TrimSpace(s.value) == "" {
+			continue
+		}
+		note := "key " + s.path
+		if s.context != "" {
+			note += ", " + s.context
+		}
+		if isICUMessage(s.value) {
+			// Plural and select messages are translated branch by branch.
+			icu, build, err := icuSegments(s.path, s.value, pluralLocale(opts.TargetLocale, opts.TargetLang))
+			if err == nil {
+				for i := range icu {
+					icu[i].Context = note + ", " + icu[i].Context
+				}
+				segments = append(segments, icu...)
+				messages[s.path] = build
+				pending[s.path] = s
+				continue
+			}
+		}
+		segments = append(segments, Segment{ID: s.path, Text: s.value, Context: note})
+		pending[s.path] = s
+	}
+	// Paths above are relative to the source root, so it is renamed only once they are collected.
+	doc.renameRoot(opts.SourceLocale, opts.TargetLocale)
+
+	var errs []error
+	if len(segments) > 0 {
+		translations, err := agent.translateSegments(ctx, TranslationRequest{
+			SourceLang: opts.SourceLang,
+			TargetLang: opts.TargetLang,
+			Country:    opts.Country,
+			Formality:  opts.Formality,
+			Style:      opts.Style,
+		}, segments, "")
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for path, s := range pending {
+			if build, ok := messages[path]; ok {
+				message, err := build(translations)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %v", path, err))
+					continue
+				}
+				s.set(message)
+			} else if translation, ok := translations[path]; ok {
+				s.set(translation)
+			}
+		}
+	}
+	translateErr := errors.Join(errs...)
+
+	output, err := doc.encode()
+	if err != nil {
+		return nil, err
+	}
+	return output, translateErr
+}
+
+// i18nDocument is a parsed locale file that can be walked and written back.
+type i18nDocument interface {
+	strings() []i18nString
+	renameRoot(from string, to string)
+	encode() ([]byte, error)
+}
+
+func parseI18n(data []byte, format I18nFormat, opts I18nOptions) (i18nDocument, error) {
+	switch format {
+	case I18nJSON:
+		return parseJSONDocument(data)
+	case I18nYAML:
+		return parseYAMLDocument(data)
+	case I18nAndroidXML:
+		return parseAndroidDocument(data)
+	case I18nAppleStrings:
+		return parseAppleStringsDocument(data)
+	case I18nStringsDict:
+		return parseStringsDictDocument(data)
+	case I18nXCStrings:
+		return parseXCStringsDocument(data, opts.TargetLocale)
+	}
+	return nil, fmt.Errorf("unknown locale file format %d", format)
+}
+
+func joinKeyPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// yamlDocument keeps the yaml.v3 node tree, which already preserves order and comments.
+type yamlDocument struct {
+	root *yaml.Node
+}
+
+func parseYAMLDocument(data []byte) (*yamlDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse yaml: %v", err)
+	}
+	return &yamlDocument{root: &root}, nil
+}
+
+func (doc *yamlDocument) strings() []i18nString {
+	var result []i18nString
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], joinKeyPath(path, node.Content[i].Value))
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, joinKeyPath(path, fmt.Sprint(i)))
+			}
+		case yaml.ScalarNode:
+			if node.Tag == "!!str" {
+				result = append(result, i18nString{path: path, value: node.Value, set: func(s string) { node.Value = s }})
+			}
+		}
+	}
+	walk(doc.root, "")
+	return result
+}
+
+func (doc *yamlDocument) renameRoot(from string, to string) {
+	if from == "" || to == "" || len(doc.root.Content) == 0 {
+		return
+	}
+	mapping := doc.root.Content[0]
+	if mapping.Kind == yaml.MappingNode && len(mapping.Content) == 2 && mapping.Content[0].Value == from {
+		mapping.Content[0].Value = to
+	}
+}
+
+func (doc *yamlDocument) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonNode is an order preserving JSON value. Exactly one of the fields is used,
+// depending on whether the value is an object, an array, a string or another literal.
+type jsonNode struct {
+	object  []jsonMember
+	array   []*jsonNode
+	isObj   bool
+	isArr   bool
+	isStr   bool
+	str     string
+	literal json.RawMessage
+}
+
+type jsonMember struct {
+	key   string
+	value *jsonNode
+}
+
+// get returns the value of an object member, or nil.
+func (node *jsonNode) get(key string) *jsonNode {
+	if node == nil || !node.isObj {
+		return nil
+	}
+	for _, member := range node.object {
+		if member.key == key {
+			return member.value
+		}
+	}
+	return nil
+}
+
+// set replaces the value of an object member, appending it when missing.
+func (node *jsonNode) set(key string, value *jsonNode) {
+	for i, member := range node.object {
+		if member.key == key {
+			node.object[i].value = value
+			return
+		}
+	}
+	node.object = append(node.object, jsonMember{key: key, value: value})
+}
+
+func (node *jsonNode) copy() *jsonNode {
+	c := *node
+	c.object = nil
+	for _, member := range node.object {
+		c.object = append(c.object, jsonMember{key: member.key, value: member.value.copy()})
+	}
+	c.array = nil
+	for _, child := range node.array {
+		c.array = append(c.array, child.copy())
+	}
+	return &c
+}
+
+type jsonDocument struct {
+	root   *jsonNode
+	indent string
+	colon  string // ": ", or " : " as written by Xcode
+}
+
+func parseJSONDocument(data []byte) (*jsonDocument, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := decodeJSONNode(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("parse json: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("parse json: unexpected data after top-level value")
+	}
+	colon := ": "
+	if bytes.Contains(data, []byte(`" : `)) {
+		colon = " : "
+	}
+	return &jsonDocument{root: root, indent: detectJSONIndent(data), colon: colon}, nil
+}
+
+func decodeJSONNode(decoder *json.Decoder) (*jsonNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node := &jsonNode{isObj: true}
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSONNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.object = append(node.object, jsonMember{key: keyToken.(string), value: value})
+			}
+			_, err := decoder.Token()
+			return node, err
+		case '[':
+			node := &jsonNode{isArr: true}
+			for decoder.More() {
+				value, err := decodeJSONNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.array = append(node.array, value)
+			}
+			_, err := decoder.Token()
+			return node, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	case string:
+		return &jsonNode{isStr: true, str: t}, nil
+	default:
+		literal, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{literal: literal}, nil
+	}
+}
+
+// detectJSONIndent returns the indentation of the first indented line, defaulting to two spaces.
+func detectJSONIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+func (doc *jsonDocument) strings() []i18nString {
+	var result []i18nString
+	var walk func(node *jsonNode, path string)
+	walk = func(node *jsonNode, path string) {
+		switch {
+		case node.isObj:
+			for _, member := range node.object {
+				walk(member.value, joinKeyPath(path, member.key))
+			}
+		case node.isArr:
+			for i, child := range node.array {
+				walk(child, joinKeyPath(path, fmt.Sprint(i)))
+			}
+		case node.isStr:
+			result = append(result, i18nString{path: path, value: node.str, set: func(s string) { node.str = s }})
+		}
+	}
+	walk(doc.root, "")
+	return result
+}
+
+func (doc *jsonDocument) renameRoot(from string, to string) {
+	if from == "" || to == "" || !doc.root.isObj || len(doc.root.object) != 1 {
+		return
+	}
+	if doc.root.object[0].key == from {
+		doc.root.object[0].key = to
+	}
+}
+
+func (doc *jsonDocument) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := doc.writeNode(&buf, doc.root, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func (doc *jsonDocument) writeNode(buf *bytes.Buffer, node *jsonNode, prefix string) error {
+	indent := doc.indent
+	switch {
+	case node.isObj:
+		if len(node.object) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, member := range node.object {
+			buf.WriteString(prefix + indent)
+			if err := writeJSONString(buf, member.key); err != nil {
+				return err
+			}
+			buf.WriteString(doc.colon)
+			if err := doc.writeNode(buf, member.value, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(node.object)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(prefix + "}")
+	case node.isArr:
+		if len(node.array) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, child := range node.array {
+			buf.WriteString(prefix + indent)
+			if err := doc.writeNode(buf, child, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(node.array)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(prefix + "]")
+	case node.isStr:
+		return writeJSONString(buf, node.str)
+	default:
+		buf.Write(node.literal)
+	}
+	return nil
+}
+
+// writeJSONString writes s as a JSON string without escaping <, > and &, which
+// are common in translated markup.
+func writeJSONString(buf *bytes.Buffer, s string) error {
+	var tmp bytes.Buffer
+	encoder := json.NewEncoder(&tmp)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimRight(tmp.Bytes(), "\n"))
+	return nil
+}
+
+// spliceDocument is used for formats that are easier to edit in place than to re-encode.
+// Translatable values are byte ranges of the original file, everything around them
+// (comments, attributes, whitespace) is written back untouched.
+type spliceDocument struct {
+	data   []byte
+	ranges []spliceRange
+	escape func(string) string // encodes a translated value for the file syntax
+	output func([]byte) []byte // optional, converts the UTF-8 result back to the file encoding
+}
+
+type spliceRange struct {
+	start       int
+	end         int
+	path        string
+	value       string
+	context     string
+	translation *string
+}
+
+func (doc *spliceDocument) strings() []i18nString {
+	result := make([]i18nString, 0, len(doc.ranges))
+	for i := range doc.ranges {
+		r := &doc.ranges[i]
+		result = append(result, i18nString{path: r.path, value: r.value, context: r.context, set: func(s string) { r.translation = &s }})
+	}
+	return result
+}
+
+func (doc *spliceDocument) renameRoot(from string, to string) {}
+
+func (doc *spliceDocument) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	last := 0
+	for _, r := range doc.ranges {
+		if r.translation == nil {
+			continue
+		}
+		buf.Write(doc.data[last:r.start])
+		buf.WriteString(doc.escape(*r.translation))
+		last = r.end
+	}
+	buf.Write(doc.data[last:])
+	if doc.output != nil {
+		return doc.output(buf.Bytes()), nil
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+// toGerman stands in for the model in the tests, translating the words they use.
+var toGerman = strings.NewReplacer(
+	"Hello", "Hallo",
+	"Save", "Speichern",
+	"Cancel", "Abbrechen",
+	"Welcome", "Willkommen",
+	"files", "Dateien",
+	"file", "Datei",
+	"Chapter", "Kapitel",
+	"The end", "Das Ende",
+).Replace
+
+// newStubAgent returns an agent whose completions come from a stub model translating
+// with translate.
+func newStubAgent(t *testing.T, translate func(string) string) *TranslationAgent {
+	t.Helper()
+	return NewTranslationAgent(stubConfig(stubmodel.New(t, translate)))
+}
+
+// stubConfig returns the configuration of an agent using model.
+func stubConfig(model *stubmodel.Model) AgentConfig {
+	return AgentConfig{
+		BaseURL:   model.URL,
+		ApiKey:    "test",
+		ModelName: "gpt-4o-mini",
+		MaxTokens: 1000,
+	}
+}
+
+func TestTranslateI18n(t *testing.T) {
+	tests := []struct {
+		name   string
+		format I18nFormat
+		opts   I18nOptions
+		input  string
+		want   string
+	}{
+		{
+			name:   "json",
+			format: I18nJSON,
+			input: `{
+  "greeting": "Hello, {{name}}!",
+  "menu": {
+    "save": "Save",
+    "cancel": "Cancel"
+  },
+  "retries": 3,
+  "empty": ""
+}
+`,
+			want: `{
+  "greeting": "Hallo, {{name}}!",
+  "menu": {
+    "save": "Speichern",
+    "cancel": "Abbrechen"
+  },
+  "retries": 3,
+  "empty": ""
+}
+`,
+		},
+		{
+			name:   "json existing",
+			format: I18nJSON,
+			opts:   I18nOptions{Existing: []byte(`{"menu": {"save": "Sichern", "cancel": ""}}`)},
+			input:  `{"menu": {"save": "Save", "cancel": "Cancel"}}`,
+			want: `{
+  "menu": {
+    "save": "Sichern",
+    "cancel": "Abbrechen"
+  }
+}
+`,
+		},
+		{
+			name:   "yaml rails",
+			format: I18nYAML,
+			opts:   I18nOptions{SourceLocale: "en", TargetLocale: "de"},
+			input: `# Buttons
+en:
+  save: Save # short
+  welcome: "Welcome, %{user}"
+  limit: 10
+`,
+			want: `# Buttons
+de:
+  save: Speichern # short
+  welcome: "Willkommen, %{user}"
+  limit: 10
+`,
+		},
+	}
+	agent := newStubAgent(t, toGerman)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.SourceLang, tt.opts.TargetLang = "English", "German"
+			got, err := agent.TranslateI18n(context.Background(), []byte(tt.input), tt.format, tt.opts)
+			if err != nil {
+				t.Fatalf("TranslateI18n: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("TranslateI18n =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectI18nFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     I18nFormat
+	}{
+		{"en.json", I18nJSON},
+		{"config/locales/en.yml", I18nYAML},
+		{"de.YAML", I18nYAML},
+		{"res/values/strings.xml", I18nAndroidXML},
+		{"Localizable.strings", I18nAppleStrings},
+		{"Localizable.stringsdict", I18nStringsDict},
+		{"Localizable.xcstrings", I18nXCStrings},
+	}
+	for _, tt := range tests {
+		got, err := DetectI18nFormat(tt.filename)
+		if err != nil || got != tt.want {
+			t.Errorf("DetectI18nFormat(%q) = %v, %v, want %v", tt.filename, got, err, tt.want)
+		}
+	}
+	if _, err := DetectI18nFormat("en.po"); err == nil {
+		t.Error("DetectI18nFormat(\"en.po\") did not fail")
+	}
+}
@@ -0,0 +1,543 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// icuMessage is a parsed ICU MessageFormat message: literal text, # and arguments.
+type icuMessage []*icuPart
+
+type icuPart struct {
+	text     string // literal text, when arg and pound are not set
+	pound    bool   // # inside a plural branch
+	arg      string
+	argType  string // "", number, date, time, plural, selectordinal, select, ...
+	style    string // style of simple arguments, e.g. "percent" or "::currency/EUR"
+	offset   string // offset of plural arguments
+	branches []*icuBranch
+}
+
+type icuBranch struct {
+	selector string // plural category, =N or select value
+	message  icuMessage
+	note     string // context for the translator when the branch was added for the target locale
+}
+
+func (part *icuPart) complex() bool {
+	return part.argType == "plural" || part.argType == "selectordinal" || part.argType == "select"
+}
+
+// parseICU parses message, following ICU's apostrophe quoting rules.
+func parseICU(message string) (icuMessage, error) {
+	p := &icuParser{input: []rune(message)}
+	parsed, err := p.parseMessage(false, 0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.input[p.pos], p.pos)
+	}
+	return parsed, nil
+}
+
+type icuParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *icuParser) parseMessage(inPlural bool, depth int) (icuMessage, error) {
+	var message icuMessage
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			message = append(message, &icuPart{text: text.String()})
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch {
+		case r == '\'':
+			p.pos++
+			if p.pos < len(p.input) && p.input[p.pos] == '\'' {
+				text.WriteRune('\'')
+				p.pos++
+			} else if p.pos < len(p.input) && (strings.ContainsRune("{}|", p.input[p.pos]) || (inPlural && p.input[p.pos] == '#')) {
+				// quoted literal up to the next single apostrophe
+				for p.pos < len(p.input) {
+					if p.input[p.pos] == '\'' {
+						if p.pos+1 < len(p.input) && p.input[p.pos+1] == '\'' {
+							text.WriteRune('\'')
+							p.pos += 2
+							continue
+						}
+						p.pos++
+						break
+					}
+					text.WriteRune(p.input[p.pos])
+					p.pos++
+				}
+			} else {
+				text.WriteRune('\'')
+			}
+		case r == '{':
+			flush()
+			part, err := p.parseArgument(inPlural, depth)
+			if err != nil {
+				return nil, err
+			}
+			message = append(message, part)
+		case r == '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unmatched } at offset %d", p.pos)
+			}
+			flush()
+			return message, nil
+		case r == '#' && inPlural:
+			flush()
+			message = append(message, &icuPart{pound: true})
+			p.pos++
+		default:
+			text.WriteRune(r)
+			p.pos++
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unterminated message")
+	}
+	flush()
+	return message, nil
+}
+
+func (p *icuParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *icuParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) && !unicode.IsSpace(p.input[p.pos]) && !strings.ContainsRune("{},", p.input[p.pos]) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *icuParser) expect(r rune) error {
+	p.skipSpace()
+	if p.pos >= len(p.input) || p.input[p.pos] != r {
+		return fmt.Errorf("expected %q at offset %d", r, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *icuParser) parseArgument(inPlural bool, depth int) (*icuPart, error) {
+	p.pos++ // {
+	p.skipSpace()
+	part := &icuPart{arg: p.word()}
+	if part.arg == "" {
+		return nil, fmt.Errorf("missing argument name at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '}' {
+		p.pos++
+		return part, nil
+	}
+	if err := p.expect(','); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	part.argType = p.word()
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '}' {
+		p.pos++
+		return part, nil
+	}
+	if err := p.expect(','); err != nil {
+		return nil, err
+	}
+
+	if !part.complex() {
+		// simple argument style, kept verbatim up to the closing brace
+		start, nested := p.pos, 0
+		for ; p.pos < len(p.input); p.pos++ {
+			if p.input[p.pos] == '{' {
+				nested++
+			} else if p.input[p.pos] == '}' {
+				if nested == 0 {
+					break
+				}
+				nested--
+			}
+		}
+		part.style = strings.TrimSpace(string(p.input[start:p.pos]))
+		return part, p.expect('}')
+	}
+
+	branchInPlural := inPlural || part.argType != "select"
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("unterminated %s argument %q", part.argType, part.arg)
+		}
+		if p.input[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		selector := p.word()
+		if strings.HasPrefix(selector, "offset:") && part.argType != "select" {
+			part.offset = strings.TrimPrefix(selector, "offset:")
+			continue
+		}
+		if selector == "" {
+			return nil, fmt.Errorf("missing selector at offset %d", p.pos)
+		}
+		if err := p.expect('{'); err != nil {
+			return nil, err
+		}
+		message, err := p.parseMessage(branchInPlural, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++ // }
+		part.branches = append(part.branches, &icuBranch{selector: selector, message: message})
+	}
+	if part.branch("other") == nil {
+		return nil, fmt.Errorf("%s argument %q has no other branch", part.argType, part.arg)
+	}
+	return part, nil
+}
+
+func (part *icuPart) branch(selector string) *icuBranch {
+	for _, branch := range part.branches {
+		if branch.selector == selector {
+			return branch
+		}
+	}
+	return nil
+}
+
+// hasComplexArgument reports whether the message has a plural, selectordinal or select argument.
+func (message icuMessage) hasComplexArgument() bool {
+	for _, part := range message {
+		if part.complex() {
+			return true
+		}
+	}
+	return false
+}
+
+func (message icuMessage) String() string {
+	var sb strings.Builder
+	message.write(&sb, false)
+	return sb.String()
+}
+
+func (message icuMessage) write(sb *strings.Builder, inPlural bool) {
+	for _, part := range message {
+		switch {
+		case part.pound:
+			sb.WriteString("#")
+		case part.arg == "":
+			sb.WriteString(escapeICUText(part.text, inPlural))
+		default:
+			sb.WriteString("{" + part.arg)
+			if part.argType != "" {
+				sb.WriteString(", " + part.argType)
+			}
+			if part.style != "" {
+				sb.WriteString(", " + part.style)
+			}
+			if part.complex() {
+				sb.WriteString(",")
+				if part.offset != "" {
+					sb.WriteString(" offset:" + part.offset)
+				}
+				for _, branch := range part.branches {
+					sb.WriteString(" " + branch.selector + " {")
+					branch.message.write(sb, inPlural || part.argType != "select")
+					sb.WriteString("}")
+				}
+			}
+			sb.WriteString("}")
+		}
+	}
+}
+
+func escapeICUText(text string, inPlural bool) string {
+	text = strings.ReplaceAll(text, "'", "''")
+	text = strings.ReplaceAll(text, "{", "'{'")
+	text = strings.ReplaceAll(text, "}", "'}'")
+	if inPlural {
+		text = strings.ReplaceAll(text, "#", "'#'")
+	}
+	return text
+}
+
+// cldrCardinalCategories lists the plural categories of the CLDR cardinal rules by language.
+// Languages not listed only use "other".
+var cldrCardinalCategories = map[string][]string{
+	"af": {"one", "other"}, "bg": {"one", "other"}, "da": {"one", "other"}, "de": {"one", "other"},
+	"el": {"one", "other"}, "en": {"one", "other"}, "et": {"one", "other"}, "fi": {"one", "other"},
+	"hu": {"one", "other"}, "hi": {"one", "other"}, "bn": {"one", "other"}, "fa": {"one", "other"},
+	"nl": {"one", "other"}, "nb": {"one", "other"}, "nn": {"one", "other"}, "no": {"one", "other"},
+	"sv": {"one", "other"}, "tr": {"one", "other"}, "ur": {"one", "other"}, "sw": {"one", "other"},
+	"ka": {"one", "other"}, "az": {"one", "other"}, "kk": {"one", "other"}, "uz": {"one", "other"},
+	"fr": {"one", "many", "other"}, "es": {"one", "many", "other"}, "it": {"one", "many", "other"},
+	"pt": {"one", "many", "other"}, "ca": {"one", "many", "other"},
+	"pl": {"one", "few", "many", "other"}, "ru": {"one", "few", "many", "other"},
+	"uk": {"one", "few", "many", "other"}, "be": {"one", "few", "many", "other"},
+	"lt": {"one", "few", "many", "other"}, "cs": {"one", "few", "many", "other"},
+	"sk": {"one", "few", "many", "other"},
+	"hr": {"one", "few", "other"}, "sr": {"one", "few", "other"}, "bs": {"one", "few", "other"},
+	"ro": {"one", "few", "other"},
+	"sl": {"one", "two", "few", "other"},
+	"he": {"one", "two", "other"},
+	"lv": {"zero", "one", "other"},
+	"ga": {"one", "two", "few", "many", "other"},
+	"ar": {"zero", "one", "two", "few", "many", "other"},
+	"cy": {"zero", "one", "two", "few", "many", "other"},
+}
+
+// cldrOrdinalCategories lists the plural categories of the CLDR ordinal rules by language.
+// Languages not listed only use "other".
+var cldrOrdinalCategories = map[string][]string{
+	"en": {"one", "two", "few", "other"},
+	"fr": {"one", "other"}, "hu": {"one", "other"}, "ro": {"one", "other"}, "ms": {"one", "other"},
+	"vi": {"one", "other"}, "fil": {"one", "other"}, "tl": {"one", "other"}, "hy": {"one", "other"},
+	"ga": {"one", "other"}, "sv": {"one", "other"}, "lo": {"one", "other"}, "ne": {"one", "other"},
+	"uk": {"few", "other"}, "be": {"few", "other"}, "tk": {"few", "other"},
+	"it": {"many", "other"}, "kk": {"many", "other"},
+	"ka": {"one", "many", "other"}, "sq": {"one", "many", "other"}, "kw": {"one", "many", "other"},
+	"az": {"one", "few", "many", "other"},
+	"mk": {"one", "two", "many", "other"},
+	"ca": {"one", "two", "few", "other"}, "mr": {"one", "two", "few", "other"},
+	"gd": {"one", "two", "few", "other"},
+	"hi": {"one", "two", "few", "many", "other"}, "bn": {"one", "two", "few", "many", "other"},
+	"gu": {"one", "two", "few", "many", "other"}, "as": {"one", "two", "few", "many", "other"},
+	"or": {"one", "two", "few", "many", "other"},
+	"cy": {"zero", "one", "two", "few", "many", "other"},
+}
+
+// pluralLocale returns the locale whose plural rules a translation into targetLang
+// follows: targetLocale, or else the base language of targetLang, such as "pl" for
+// "Polish", or an empty string when targetLang is not known.
+func pluralLocale(targetLocale string, targetLang string) string {
+	if targetLocale != "" {
+		return targetLocale
+	}
+	language, err := ParseLanguage(targetLang)
+	if err != nil {
+		return ""
+	}
+	base, _ := language.Tag.Base()
+	return base.String()
+}
+
+// pluralCategories returns the CLDR plural categories of a locale such as "pl" or "pt-BR",
+// or nil when locale is empty.
+func pluralCategories(locale string, ordinal bool) []string {
+	if locale == "" {
+		return nil
+	}
+	language := strings.ToLower(strings.FieldsFunc(locale, func(r rune) bool { return r == '-' || r == '_' })[0])
+	table := cldrCardinalCategories
+	if ordinal {
+		table = cldrOrdinalCategories
+	}
+	if categories, ok := table[language]; ok {
+		return categories
+	}
+	return []string{"other"}
+}
+
+// adaptPluralBranches changes the branches of every plural and selectordinal argument to
+// the categories of targetLocale. Explicit =N branches are kept, categories the target
+// does not use are dropped and missing ones are added as copies of the "other" branch,
+// to be rewritten by the translator.
+func (message icuMessage) adaptPluralBranches(targetLocale string) {
+	for _, part := range message {
+		for _, branch := range part.branches {
+			branch.message.adaptPluralBranches(targetLocale)
+		}
+		if part.argType != "plural" && part.argType != "selectordinal" {
+			continue
+		}
+		categories := pluralCategories(targetLocale, part.argType == "selectordinal")
+		if categories == nil {
+			continue
+		}
+		var branches []*icuBranch
+		for _, branch := range part.branches {
+			if strings.HasPrefix(branch.selector, "=") {
+				branches = append(branches, branch)
+			}
+		}
+		for _, category := range categories {
+			if branch := part.branch(category); branch != nil {
+				branches = append(branches, branch)
+				continue
+			}
+			branches = append(branches, &icuBranch{
+				selector: category,
+				message:  part.branch("other").message.copy(),
+				note:     fmt.Sprintf("this branch is the %q plural form required by %s, translate the text so that it fits that form", category, targetLocale),
+			})
+		}
+		part.branches = branches
+	}
+}
+
+func (message icuMessage) copy() icuMessage {
+	c := make(icuMessage, len(message))
+	for i, part := range message {
+		p := *part
+		p.branches = make([]*icuBranch, len(part.branches))
+		for j, branch := range part.branches {
+			b := *branch
+			b.message = branch.message.copy()
+			p.branches[j] = &b
+		}
+		c[i] = &p
+	}
+	return c
+}
+
+// icuLevel is the literal text of one message or branch, with every argument and #
+// replaced by an {icu_N} token that the placeholder protection keeps intact.
+type icuLevel struct {
+	id      string
+	message *icuMessage
+	text    string
+	parts   []*icuPart // parts by token number
+	context string
+}
+
+func (message *icuMessage) levels(id string, context string) []icuLevel {
+	level := icuLevel{id: id, message: message, context: context}
+	var sb strings.Builder
+	var nested []icuLevel
+	for _, part := range *message {
+		if part.arg == "" && !part.pound {
+			sb.WriteString(part.text)
+			continue
+		}
+		fmt.Fprintf(&sb, "{icu_%d}", len(level.parts))
+		level.parts = append(level.parts, part)
+		for _, branch := range part.branches {
+			branchContext := fmt.Sprintf("branch %q of the %s argument {%s}", branch.selector, part.argType, part.arg)
+			if part.argType != "select" {
+				branchContext += ", # stands for the number"
+			}
+			if branch.note != "" {
+				branchContext += ", " + branch.note
+			}
+			nested = append(nested, branch.message.levels(id+"/"+part.arg+"."+branch.selector, branchContext)...)
+		}
+	}
+	level.text = sb.String()
+	if level.context == "" {
+		level.context = "ICU message, the {icu_N} tokens are arguments"
+	}
+	return append([]icuLevel{level}, nested...)
+}
+
+// icuToken matches the tokens arguments are replaced with in icuLevel.text.
+var icuToken = regexp.MustCompile(`\{icu_(\d+)\}`)
+
+// rebuild replaces the literal text of the level with translation, keeping its parts.
+func (level icuLevel) rebuild(translation string) error {
+	var message icuMessage
+	used := make([]bool, len(level.parts))
+	last := 0
+	for _, loc := range icuToken.FindAllStringSubmatchIndex(translation, -1) {
+		n, _ := strconv.Atoi(translation[loc[2]:loc[3]])
+		if n >= len(level.parts) || used[n] {
+			return fmt.Errorf("unexpected argument token %s in %q", translation[loc[0]:loc[1]], translation)
+		}
+		if loc[0] > last {
+			message = append(message, &icuPart{text: translation[last:loc[0]]})
+		}
+		message = append(message, level.parts[n])
+		used[n] = true
+		last = loc[1]
+	}
+	if last < len(translation) {
+		message = append(message, &icuPart{text: translation[last:]})
+	}
+	for n := range used {
+		if !used[n] {
+			return fmt.Errorf("argument token {icu_%d} lost in %q", n, translation)
+		}
+	}
+	*level.message = message
+	return nil
+}
+
+// icuSegments prepares an ICU message for translation with TranslateSegments. It returns
+// the segments to translate and a function that assembles and validates the translated
+// message from their translations.
+func icuSegments(id string, source string, targetLocale string) ([]Segment, func(map[string]string) (string, error), error) {
+	message, err := parseICU(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	message.adaptPluralBranches(targetLocale)
+	levels := message.levels(id, "")
+
+	var segments []Segment
+	for _, level := range levels {
+		if hasTranslatableText(level.text) {
+			segments = append(segments, Segment{ID: level.id, Text: level.text, Context: level.context})
+		}
+	}
+	build := func(translations map[string]string) (string, error) {
+		for _, level := range levels {
+			if !hasTranslatableText(level.text) {
+				continue
+			}
+			translation, ok := translations[level.id]
+			if !ok {
+				return "", fmt.Errorf("no translation for %s", level.id)
+			}
+			if err := level.rebuild(translation); err != nil {
+				return "", err
+			}
+		}
+		result := message.String()
+		if _, err := parseICU(result); err != nil {
+			return "", fmt.Errorf("translated message does not parse: %v", err)
+		}
+		return result, nil
+	}
+	return segments, build, nil
+}
+
+// isICUMessage reports whether s is an ICU message with plural, selectordinal or select arguments.
+func isICUMessage(s string) bool {
+	message, err := parseICU(s)
+	return err == nil && message.hasComplexArgument()
+}
+
+// TranslateICU translates an ICU MessageFormat message. Only the literal text of the message
+// and of each branch is translated, plural branches are adapted to the CLDR plural
+// categories of targetLocale (e.g. "pl" adds few and many) and the result is checked to
+// parse. Without targetLocale, the categories are those of targetLang. Arguments,
+// selectors and formats are kept unchanged.
+func (agent *TranslationAgent) TranslateICU(ctx context.Context, sourceLang string, targetLang string, targetLocale string, message string, country string) (string, error) {
+	segments, build, err := icuSegments("message", message, pluralLocale(targetLocale, targetLang))
+	if err != nil {
+		return "", fmt.Errorf("parse ICU message: %v", err)
+	}
+	translations, err := agent.TranslateSegments(ctx, sourceLang, targetLang, segments, country)
+	if err != nil {
+		return "", err
+	}
+	return build(translations)
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseICU(t *testing.T) {
+	tests := []struct {
+		message string
+		// want is the message printed again, the same message when empty.
+		want string
+	}{
+		{message: "Hello, {name}!"},
+		{message: "{count, number} of {total, number, integer}"},
+		{message: "{amount, number, ::currency/EUR}"},
+		{message: "{count, plural, one {# file} other {# files}}"},
+		{message: "{count, plural, offset:1 =0 {nobody} one {you and # other} other {you and # others}}"},
+		{message: "{gender, select, female {{count, plural, one {her file} other {her # files}}} other {their files}}"},
+		{message: "{place, selectordinal, one {#st} two {#nd} few {#rd} other {#th}}"},
+		{message: "It's '{literal}' and '#'", want: "It''s '{'literal'}' and ''#''"},
+		{message: "{count,plural,one{# file}other{# files}}", want: "{count, plural, one {# file} other {# files}}"},
+		{message: "{count, plural, other {'#' is # and '{'x'}'}}"},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want == "" {
+			want = tt.message
+		}
+		parsed, err := parseICU(tt.message)
+		if err != nil {
+			t.Errorf("parseICU(%q): %v", tt.message, err)
+			continue
+		}
+		if got := parsed.String(); got != want {
+			t.Errorf("parseICU(%q).String() = %q, want %q", tt.message, got, want)
+		}
+		reparsed, err := parseICU(want)
+		if err != nil || reparsed.String() != want {
+			t.Errorf("parseICU(%q) did not print the same message again: %q, %v", want, reparsed.String(), err)
+		}
+	}
+}
+
+func TestParseICUInvalid(t *testing.T) {
+	for _, message := range []string{
+		"{count, plural, one {# file}}",
+		"{count, plural, one {# file} other {# files}",
+		"unmatched }",
+		"{}",
+		"{count plural}",
+		"{count, plural, other # files}",
+	} {
+		if _, err := parseICU(message); err == nil {
+			t.Errorf("parseICU(%q) did not fail", message)
+		}
+	}
+}
+
+func TestAdaptPluralBranches(t *testing.T) {
+	tests := []struct {
+		message string
+		locale  string
+		want    string
+	}{
+		{
+			message: "{n, plural, =0 {no files} one {# file} other {# files}}",
+			locale:  "pl",
+			want:    "{n, plural, =0 {no files} one {# file} few {# files} many {# files} other {# files}}",
+		},
+		{
+			message: "{n, plural, one {# file} other {# files}}",
+			locale:  "ja",
+			want:    "{n, plural, other {# files}}",
+		},
+		{
+			message: "{n, plural, one {# file} other {# files}}",
+			locale:  "",
+			want:    "{n, plural, one {# file} other {# files}}",
+		},
+		{
+			message: "{n, selectordinal, one {#st} other {#th}}",
+			locale:  "en-GB",
+			want:    "{n, selectordinal, one {#st} two {#th} few {#th} other {#th}}",
+		},
+		{
+			message: "{g, select, male {{n, plural, other {his # files}}} other {{n, plural, other {# files}}}}",
+			locale:  "ru",
+			want:    "{g, select, male {{n, plural, one {his # files} few {his # files} many {his # files} other {his # files}}} other {{n, plural, one {# files} few {# files} many {# files} other {# files}}}}",
+		},
+	}
+	for _, tt := range tests {
+		message, err := parseICU(tt.message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message.adaptPluralBranches(tt.locale)
+		if got := message.String(); got != tt.want {
+			t.Errorf("adaptPluralBranches(%q, %q) = %q, want %q", tt.message, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestPluralCategories(t *testing.T) {
+	tests := []struct {
+		locale  string
+		ordinal bool
+		want    []string
+	}{
+		{"en", false, []string{"one", "other"}},
+		{"pt_BR", false, []string{"one", "many", "other"}},
+		{"ar", false, []string{"zero", "one", "two", "few", "many", "other"}},
+		{"ja", false, []string{"other"}},
+		{"en-US", true, []string{"one", "two", "few", "other"}},
+		{"uk", true, []string{"few", "other"}},
+		{"az", true, []string{"one", "few", "many", "other"}},
+		{"de", true, []string{"other"}},
+		{"", false, nil},
+	}
+	for _, tt := range tests {
+		if got := pluralCategories(tt.locale, tt.ordinal); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pluralCategories(%q, %v) = %q, want %q", tt.locale, tt.ordinal, got, tt.want)
+		}
+	}
+}
+
+func TestPluralLocale(t *testing.T) {
+	tests := []struct {
+		targetLocale, targetLang, want string
+	}{
+		{"pt-BR", "German", "pt-BR"},
+		{"", "Polish", "pl"},
+		{"", "pt-BR", "pt"},
+		{"", "Serbian (Latin script)", "sr"},
+		{"", "Klingonese", ""},
+	}
+	for _, tt := range tests {
+		if got := pluralLocale(tt.targetLocale, tt.targetLang); got != tt.want {
+			t.Errorf("pluralLocale(%q, %q) = %q, want %q", tt.targetLocale, tt.targetLang, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateICU(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	tests := []struct {
+		targetLocale string
+		message      string
+		want         string
+	}{
+		{
+			message: "{count, plural, =0 {Cancel} one {# file} other {# files}}",
+			want:    "{count, plural, =0 {Abbrechen} one {# Datei} other {# Dateien}}",
+		},
+		{
+			targetLocale: "pl",
+			message:      "Hello {name}, {count, plural, one {# file} other {# files}}",
+			want:         "Hallo {name}, {count, plural, one {# Datei} few {# Dateien} many {# Dateien} other {# Dateien}}",
+		},
+	}
+	for _, tt := range tests {
+		got, err := agent.TranslateICU(context.Background(), "English", "German", tt.targetLocale, tt.message, "")
+		if err != nil {
+			t.Errorf("TranslateICU(%q): %v", tt.message, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("TranslateICU(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+	if _, err := agent.TranslateICU(context.Background(), "English", "German", "", "{count, plural, one {# file}}", ""); err == nil {
+		t.Error("TranslateICU of a message without an other branch did not fail")
+	}
+}
@@ -0,0 +1,164 @@
+// Package stubmodel serves a stand-in for the OpenAI chat completions API in tests. It
+// answers the prompts of the translation agent by passing the text inside their XML
+// tags through a function, so tests do not depend on the wording of the prompts.
+//
+// Importing the package replaces the token encodings of tiktoken with one token per
+// byte, so that tests never download the encodings.
+package stubmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+func init() {
+	tiktoken.SetBpeLoader(byteEncoding{})
+}
+
+// byteEncoding loads every encoding as one token per byte.
+type byteEncoding struct{}
+
+func (byteEncoding) LoadTiktokenBpe(string) (map[string]int, error) {
+	ranks := make(map[string]int, 256)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	return ranks, nil
+}
+
+// Model answers chat completions, streamed or not, for the prompts of the agent:
+//
+//   - <TEXT>, a language detection, with Language;
+//   - <SOURCE_SEGMENTS>, a JSON object of segments, with the segments translated;
+//   - <TRANSLATE_THIS>, a chunk of a longer text, with the chunk translated;
+//   - <SOURCE_TEXT>, a text, with the text translated.
+//
+// The last occurrence of a tag is used, as the prompts name their tags before using
+// them. Other prompts are answered with 400 Bad Request.
+type Model struct {
+	// URL is the base URL of the API, to be used as the BaseURL of the agent.
+	URL string
+	// Language is the code answered to language detection prompts, "und" when empty.
+	// It is set before the model is asked.
+	Language string
+
+	translate func(string) string
+	mu        sync.Mutex
+	prompts   []string
+}
+
+// New starts a model translating with translate, which is stopped at the end of the test.
+func New(t testing.TB, translate func(string) string) *Model {
+	t.Helper()
+	m := &Model{translate: translate}
+	server := httptest.NewServer(m)
+	t.Cleanup(server.Close)
+	m.URL = server.URL + "/v1"
+	return m
+}
+
+func (m *Model) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Stream   bool `json:"stream"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Messages) == 0 {
+		http.Error(w, "invalid chat completion request", http.StatusBadRequest)
+		return
+	}
+	prompt := body.Messages[len(body.Messages)-1].Content
+	m.mu.Lock()
+	m.prompts = append(m.prompts, prompt)
+	m.mu.Unlock()
+
+	content, err := m.answer(prompt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	usage := map[string]int{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+	if !body.Stream {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message": map[string]string{"role": "assistant", "content": content},
+			}},
+			"usage": usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	chunks := []interface{}{
+		map[string]interface{}{"choices": []interface{}{map[string]interface{}{"delta": map[string]string{"content": content}}}},
+		map[string]interface{}{"choices": []interface{}{}, "usage": usage},
+	}
+	for _, chunk := range chunks {
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (m *Model) answer(prompt string) (string, error) {
+	if _, ok := between(prompt, "<TEXT>", "</TEXT>"); ok {
+		code := m.Language
+		if code == "" {
+			code = "und"
+		}
+		return fmt.Sprintf(`{"code": %q, "confidence": 0.9}`, code), nil
+	}
+	if segments, ok := between(prompt, "<SOURCE_SEGMENTS>", "</SOURCE_SEGMENTS>"); ok {
+		var source map[string]string
+		if err := json.Unmarshal([]byte(segments), &source); err != nil {
+			return "", err
+		}
+		for id, text := range source {
+			source[id] = m.translate(text)
+		}
+		data, err := json.Marshal(source)
+		return string(data), err
+	}
+	if chunk, ok := between(prompt, "<TRANSLATE_THIS>", "</TRANSLATE_THIS>"); ok {
+		return m.translate(chunk), nil
+	}
+	if text, ok := between(prompt, "<SOURCE_TEXT>", "</SOURCE_TEXT>"); ok {
+		return m.translate(text), nil
+	}
+	return "", fmt.Errorf("unexpected prompt %q", prompt)
+}
+
+// Prompts returns the prompts the model was asked, in order.
+func (m *Model) Prompts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.prompts...)
+}
+
+// Asked reports whether one of the prompts contains s.
+func (m *Model) Asked(s string) bool {
+	for _, prompt := range m.Prompts() {
+		if strings.Contains(prompt, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// between returns the text of s inside the last start tag and the end tag after it.
+func between(s string, start string, end string) (string, bool) {
+	i := strings.LastIndex(s, start)
+	if i < 0 {
+		return "", false
+	}
+	text, _, ok := strings.Cut(s[i+len(start):], end)
+	return strings.TrimSpace(text), ok
+}
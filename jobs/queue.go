@@ -0,0 +1,461 @@
+// Package jobs runs translations in the background for the HTTP and gRPC servers, and
+// keeps them across restarts in a Store.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// Status is the state of a job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Job is a translation request run in the background, and its outcome.
+type Job struct {
+	ID         string                `json:"id"`
+	Status     Status                `json:"status"`
+	Tenant     string                `json:"tenant,omitempty"`
+	Priority   int                   `json:"priority"`
+	Request    ta.TranslationRequest `json:"request"`
+	Result     *ta.TranslationResult `json:"result,omitempty"`
+	Usage      ta.Usage              `json:"usage"`
+	Error      string                `json:"error,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	StartedAt  *time.Time            `json:"started_at,omitempty"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+	// CallbackURL receives the job once it finished, and Deliveries logs the attempts.
+	CallbackURL    string         `json:"callback_url,omitempty"`
+	CallbackStatus CallbackStatus `json:"callback_status,omitempty"`
+	Deliveries     []Delivery     `json:"deliveries,omitempty"`
+}
+
+// Finished reports whether the job succeeded, failed or was canceled.
+func (job *Job) Finished() bool {
+	return job.Status == StatusSucceeded || job.Status == StatusFailed || job.Status == StatusCanceled
+}
+
+// Runner translates the request of a job and returns its result and usage.
+type Runner func(ctx context.Context, req ta.TranslationRequest) (*ta.TranslationResult, ta.Usage, error)
+
+// ErrQueueFull is returned by Submit when MaxQueued jobs are waiting.
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrClosed is returned by Submit after Close.
+var ErrClosed = errors.New("job queue is closed")
+
+// ErrNotFound is returned by Cancel for an unknown job.
+var ErrNotFound = errors.New("job not found")
+
+// ErrFinished is returned by Cancel for a job that already finished.
+var ErrFinished = errors.New("job already finished")
+
+// Options configure a Queue.
+type Options struct {
+	// Workers is the number of jobs run at the same time, 4 by default.
+	Workers int
+	// MaxQueued is the number of jobs that can wait for a worker, 1000 by default.
+	MaxQueued int
+	// MaxPerTenant is the number of jobs of a tenant run at the same time, unlimited by
+	// default.
+	MaxPerTenant int
+	// Retention is how long finished jobs are kept, 24 hours by default.
+	Retention time.Duration
+	// Store keeps the jobs across restarts. Without a store the jobs are only kept in
+	// memory.
+	Store Store
+	// ErrorLog logs the errors of the store. The log package's standard logger is used
+	// when it is nil.
+	ErrorLog *log.Logger
+	// Webhooks configure the delivery of the callbacks of the jobs.
+	Webhooks WebhookOptions
+}
+
+// SubmitOptions are the scheduling settings of a job.
+type SubmitOptions struct {
+	// Tenant is the owner of the job, whose running jobs are limited by MaxPerTenant.
+	Tenant string
+	// Priority orders the queued jobs, higher first.
+	Priority int
+	// CallbackURL is posted the job once it finished.
+	CallbackURL string
+}
+
+// Queue keeps jobs and runs them with a pool of workers, highest priority first.
+type Queue struct {
+	run  Runner
+	opts Options
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	jobs    map[string]*Job
+	pending []*Job
+	// running holds the cancel functions of the running jobs, and tenants their number
+	// by tenant.
+	running map[string]context.CancelFunc
+	tenants map[string]int
+	// canceled marks the running jobs canceled with Cancel.
+	canceled map[string]bool
+	closed   bool
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	deliveries sync.WaitGroup
+}
+
+// NewQueue loads the jobs of the store and starts the workers of a queue running jobs with
+// run. Jobs that were queued or running when the queue last stopped are queued again.
+func NewQueue(run Runner, opts Options) (*Queue, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = 1000
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 24 * time.Hour
+	}
+	if opts.Webhooks.MaxAttempts <= 0 {
+		opts.Webhooks.MaxAttempts = 5
+	}
+	if opts.Webhooks.Backoff <= 0 {
+		opts.Webhooks.Backoff = 10 * time.Second
+	}
+	if opts.Webhooks.Timeout <= 0 {
+		opts.Webhooks.Timeout = 10 * time.Second
+	}
+	if opts.Webhooks.Client == nil {
+		opts.Webhooks.Client = opts.Webhooks.client()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		run:      run,
+		opts:     opts,
+		jobs:     map[string]*Job{},
+		running:  map[string]context.CancelFunc{},
+		tenants:  map[string]int{},
+		canceled: map[string]bool{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	q.changed = sync.NewCond(&q.mu)
+	if opts.Store != nil {
+		stored, err := opts.Store.Load()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		q.mu.Lock()
+		for _, job := range stored {
+			if !job.Finished() {
+				job.Status, job.StartedAt = StatusQueued, nil
+				q.pending = append(q.pending, job)
+			}
+			q.jobs[job.ID] = job
+		}
+		q.prune()
+		// The callbacks are resumed once every job is loaded, as deliver reads q.jobs.
+		var callbacks []*Job
+		for _, job := range q.jobs {
+			if job.CallbackStatus == CallbackPending {
+				callbacks = append(callbacks, job)
+			}
+		}
+		q.mu.Unlock()
+		for _, job := range callbacks {
+			q.deliveries.Add(1)
+			go q.deliver(job)
+		}
+	}
+	for i := 0; i < opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	go q.pruneEvery(time.Minute)
+	return q, nil
+}
+
+// Submit queues a job for req and returns a copy of it.
+func (q *Queue) Submit(req ta.TranslationRequest, opts SubmitOptions) (Job, error) {
+	if opts.CallbackURL != "" {
+		if err := q.opts.Webhooks.validateCallbackURL(opts.CallbackURL); err != nil {
+			return Job{}, err
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, ErrClosed
+	}
+	q.prune()
+	if len(q.pending) >= q.opts.MaxQueued {
+		return Job{}, ErrQueueFull
+	}
+	job := &Job{
+		ID:          newID(),
+		Status:      StatusQueued,
+		Tenant:      opts.Tenant,
+		Priority:    opts.Priority,
+		Request:     req,
+		CreatedAt:   time.Now().UTC(),
+		CallbackURL: opts.CallbackURL,
+	}
+	if q.opts.Store != nil {
+		if err := q.opts.Store.Save(job); err != nil {
+			return Job{}, err
+		}
+	}
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job)
+	q.changed.Signal()
+	return *job, nil
+}
+
+// Get returns a copy of the job with the given id.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns copies of the jobs, oldest first.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// Cancel cancels a queued or running job and returns a copy of it. A running job is
+// canceled once its translation returns.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	switch {
+	case !ok:
+		return Job{}, ErrNotFound
+	case job.Finished():
+		return *job, ErrFinished
+	case job.Status == StatusRunning:
+		q.canceled[id] = true
+		q.running[id]()
+		return *job, nil
+	}
+	for i, pending := range q.pending {
+		if pending == job {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	now := time.Now().UTC()
+	job.Status, job.FinishedAt = StatusCanceled, &now
+	q.notify(job)
+	q.save(job)
+	return *job, nil
+}
+
+// Close stops accepting jobs and waits for the queued and running ones to finish. When
+// ctx is done first, the running jobs are canceled: they fail, or stay queued for the
+// next start when the queue has a store. Callbacks still being delivered are stopped,
+// and delivered again on the next start when the queue has a store.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.changed.Broadcast()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		q.deliveries.Wait()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		q.mu.Lock()
+		q.changed.Broadcast()
+		q.mu.Unlock()
+		<-done
+		q.deliveries.Wait()
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		job, ctx, ok := q.next()
+		if !ok {
+			return
+		}
+		result, usage, err := q.run(ctx, job.Request)
+		q.finish(job, result, usage, err)
+	}
+}
+
+// next waits for a job a worker can run and marks it running. It returns false when the
+// queue is closed and no job is left, or when the queue is canceled.
+func (q *Queue) next() (*Job, context.Context, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.ctx.Err() != nil {
+			return nil, nil, false
+		}
+		if i := q.runnable(); i >= 0 {
+			job := q.pending[i]
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			now := time.Now().UTC()
+			job.Status, job.StartedAt = StatusRunning, &now
+			q.save(job)
+			ctx, cancel := context.WithCancel(q.ctx)
+			q.running[job.ID] = cancel
+			q.tenants[job.Tenant]++
+			return job, ctx, true
+		}
+		if q.closed && len(q.pending) == 0 {
+			return nil, nil, false
+		}
+		q.changed.Wait()
+	}
+}
+
+// runnable returns the index of the pending job to run next: the one with the highest
+// priority, then the oldest, whose tenant is under MaxPerTenant, or -1. The caller holds
+// q.mu.
+func (q *Queue) runnable() int {
+	best := -1
+	for i, job := range q.pending {
+		if q.opts.MaxPerTenant > 0 && q.tenants[job.Tenant] >= q.opts.MaxPerTenant {
+			continue
+		}
+		if best < 0 || job.Priority > q.pending[best].Priority ||
+			job.Priority == q.pending[best].Priority && job.CreatedAt.Before(q.pending[best].CreatedAt) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (q *Queue) finish(job *Job, result *ta.TranslationResult, usage ta.Usage, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running[job.ID]()
+	delete(q.running, job.ID)
+	q.tenants[job.Tenant]--
+	canceled := q.canceled[job.ID]
+	delete(q.canceled, job.ID)
+	q.changed.Broadcast()
+
+	if err != nil && !canceled && q.ctx.Err() != nil && q.opts.Store != nil {
+		// The queue was closed: run the job again on the next start.
+		job.Status, job.StartedAt = StatusQueued, nil
+		q.save(job)
+		return
+	}
+	now := time.Now().UTC()
+	job.Result, job.Usage, job.FinishedAt = result, usage, &now
+	switch {
+	case canceled:
+		job.Status, job.Result = StatusCanceled, nil
+	case err != nil:
+		job.Status, job.Error = StatusFailed, err.Error()
+	default:
+		job.Status = StatusSucceeded
+	}
+	q.notify(job)
+	q.save(job)
+}
+
+// notify starts the delivery of the callback of a finished job. The caller holds q.mu.
+func (q *Queue) notify(job *Job) {
+	if job.CallbackURL == "" {
+		return
+	}
+	job.CallbackStatus = CallbackPending
+	q.deliveries.Add(1)
+	go q.deliver(job)
+}
+
+// save stores a job, logging the errors. The caller holds q.mu.
+func (q *Queue) save(job *Job) {
+	if q.opts.Store == nil {
+		return
+	}
+	if err := q.opts.Store.Save(job); err != nil {
+		q.logf("jobs: saving %s: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) logf(format string, args ...interface{}) {
+	if q.opts.ErrorLog != nil {
+		q.opts.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (q *Queue) pruneEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			q.prune()
+			q.mu.Unlock()
+		}
+	}
+}
+
+// prune forgets the jobs finished longer than the retention ago. The caller holds q.mu.
+func (q *Queue) prune() {
+	cutoff := time.Now().Add(-q.opts.Retention)
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+			if q.opts.Store != nil {
+				if err := q.opts.Store.Delete(id); err != nil {
+					q.logf("jobs: deleting %s: %v", id, err)
+				}
+			}
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,290 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// gatedRunner runs jobs once they are released, translating a text into itself. It
+// reports the texts of the jobs it starts on started.
+type gatedRunner struct {
+	started chan string
+	release chan struct{}
+}
+
+func newGatedRunner() *gatedRunner {
+	return &gatedRunner{started: make(chan string, 100), release: make(chan struct{})}
+}
+
+func (r *gatedRunner) run(ctx context.Context, req ta.TranslationRequest) (*ta.TranslationResult, ta.Usage, error) {
+	r.started <- req.SourceText
+	select {
+	case <-r.release:
+		return &ta.TranslationResult{Translation: req.SourceText}, ta.Usage{Requests: 1}, nil
+	case <-ctx.Done():
+		return nil, ta.Usage{}, ctx.Err()
+	}
+}
+
+func newTestQueue(t *testing.T, run Runner, opts Options) *Queue {
+	t.Helper()
+	q, err := NewQueue(run, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		q.Close(ctx)
+	})
+	return q
+}
+
+func submit(t *testing.T, q *Queue, text string, opts SubmitOptions) Job {
+	t.Helper()
+	job, err := q.Submit(ta.TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: text}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// waitStarted returns the text of the next job started by r.
+func waitStarted(t *testing.T, r *gatedRunner) string {
+	t.Helper()
+	select {
+	case text := <-r.started:
+		return text
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job started")
+		return ""
+	}
+}
+
+// waitJob waits until the job with the given id satisfies done and returns it.
+func waitJob(t *testing.T, q *Queue, id string, done func(Job) bool) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := q.Get(id)
+		if ok && done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s = %+v, still waiting", id, job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func finished(job Job) bool { return job.Finished() }
+
+func TestQueuePriority(t *testing.T) {
+	runner := newGatedRunner()
+	q := newTestQueue(t, runner.run, Options{Workers: 1})
+	first := submit(t, q, "first", SubmitOptions{})
+	waitStarted(t, runner)
+	submit(t, q, "low", SubmitOptions{})
+	submit(t, q, "high", SubmitOptions{Priority: 5})
+	submit(t, q, "medium", SubmitOptions{Priority: 1})
+	submit(t, q, "low again", SubmitOptions{})
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		runner.release <- struct{}{}
+		order = append(order, waitStarted(t, runner))
+	}
+	close(runner.release)
+	if want := []string{"high", "medium", "low", "low again"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("jobs ran in the order %q, want %q", order, want)
+	}
+	if job := waitJob(t, q, first.ID, finished); job.Status != StatusSucceeded || job.Result.Translation != "first" || job.Usage.Requests != 1 {
+		t.Errorf("first job = %+v", job)
+	}
+}
+
+func TestQueueTenantLimit(t *testing.T) {
+	runner := newGatedRunner()
+	q := newTestQueue(t, runner.run, Options{Workers: 2, MaxPerTenant: 1})
+	submit(t, q, "a1", SubmitOptions{Tenant: "a"})
+	waitStarted(t, runner)
+	a2 := submit(t, q, "a2", SubmitOptions{Tenant: "a", Priority: 10})
+	submit(t, q, "b1", SubmitOptions{Tenant: "b"})
+
+	// The free worker skips the second job of a, although it comes first.
+	if text := waitStarted(t, runner); text != "b1" {
+		t.Errorf("the second worker ran %s, want b1", text)
+	}
+	if job, _ := q.Get(a2.ID); job.Status != StatusQueued {
+		t.Errorf("second job of a is %s while the first runs, want queued", job.Status)
+	}
+	close(runner.release)
+	if text := waitStarted(t, runner); text != "a2" {
+		t.Errorf("the next job run is %s, want a2", text)
+	}
+	waitJob(t, q, a2.ID, finished)
+}
+
+func TestQueueFull(t *testing.T) {
+	runner := newGatedRunner()
+	q := newTestQueue(t, runner.run, Options{Workers: 1, MaxQueued: 1})
+	submit(t, q, "running", SubmitOptions{})
+	waitStarted(t, runner)
+	submit(t, q, "queued", SubmitOptions{})
+	if _, err := q.Submit(ta.TranslationRequest{SourceText: "too many"}, SubmitOptions{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit to a full queue = %v, want %v", err, ErrQueueFull)
+	}
+	close(runner.release)
+}
+
+func TestQueueCancel(t *testing.T) {
+	runner := newGatedRunner()
+	q := newTestQueue(t, runner.run, Options{Workers: 1})
+	running := submit(t, q, "running", SubmitOptions{})
+	waitStarted(t, runner)
+	queued := submit(t, q, "queued", SubmitOptions{})
+
+	job, err := q.Cancel(queued.ID)
+	if err != nil || job.Status != StatusCanceled || job.FinishedAt == nil {
+		t.Errorf("Cancel of a queued job = %+v, %v", job, err)
+	}
+	if _, err := q.Cancel(queued.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel of a canceled job = %v, want %v", err, ErrFinished)
+	}
+	if _, err := q.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel of an unknown job = %v, want %v", err, ErrNotFound)
+	}
+
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitJob(t, q, running.ID, finished); job.Status != StatusCanceled || job.Result != nil {
+		t.Errorf("canceled running job = %+v", job)
+	}
+}
+
+func TestQueueRequeuesOnRestart(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := newGatedRunner()
+	q, err := NewQueue(runner.run, Options{Workers: 1, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := submit(t, q, "running", SubmitOptions{})
+	waitStarted(t, runner)
+	queued := submit(t, q, "queued", SubmitOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Close = %v, want %v", err, context.Canceled)
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("store holds %d jobs, want 2", len(stored))
+	}
+	for _, job := range stored {
+		if job.Status != StatusQueued || job.StartedAt != nil {
+			t.Errorf("stored job %s = %s, want queued", job.Request.SourceText, job.Status)
+		}
+	}
+
+	restarted := newGatedRunner()
+	close(restarted.release)
+	q = newTestQueue(t, restarted.run, Options{Workers: 1, Store: store})
+	for _, id := range []string{running.ID, queued.ID} {
+		if job := waitJob(t, q, id, finished); job.Status != StatusSucceeded {
+			t.Errorf("job %s after the restart = %+v", job.Request.SourceText, job)
+		}
+	}
+}
+
+func TestQueuePrunesFinishedJobs(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := store.Save(&Job{ID: "old", Status: StatusSucceeded, FinishedAt: &old}); err != nil {
+		t.Fatal(err)
+	}
+	q := newTestQueue(t, newGatedRunner().run, Options{Store: store})
+	if _, ok := q.Get("old"); ok {
+		t.Error("a job finished longer than the retention ago was loaded")
+	}
+	if stored, _ := store.Load(); len(stored) != 0 {
+		t.Errorf("store holds %d jobs, want the old one deleted", len(stored))
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{ID: "abc123", Status: StatusQueued, Request: ta.TranslationRequest{SourceText: "Hello"}}
+	if err := store.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Load()
+	if err != nil || len(stored) != 1 || stored[0].ID != "abc123" || stored[0].Request.SourceText != "Hello" {
+		t.Fatalf("Load = %+v, %v", stored, err)
+	}
+	if err := store.Delete("abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("abc123"); err != nil {
+		t.Errorf("Delete of a deleted job = %v, want nil", err)
+	}
+
+	for _, id := range []string{"", "../escape", `a\b`, "a.b"} {
+		if err := store.Save(&Job{ID: id}); err == nil {
+			t.Errorf("Save with id %q did not fail", id)
+		}
+		if err := store.Delete(id); err == nil {
+			t.Errorf("Delete with id %q did not fail", id)
+		}
+	}
+}
+
+// TestQueueConcurrency runs many jobs from many goroutines, for the race detector.
+func TestQueueConcurrency(t *testing.T) {
+	run := func(ctx context.Context, req ta.TranslationRequest) (*ta.TranslationResult, ta.Usage, error) {
+		return &ta.TranslationResult{Translation: req.SourceText}, ta.Usage{}, nil
+	}
+	q := newTestQueue(t, run, Options{Workers: 4, MaxPerTenant: 2})
+	var wg sync.WaitGroup
+	ids := make(chan string, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(tenant string) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				job, err := q.Submit(ta.TranslationRequest{SourceText: "Hello"}, SubmitOptions{Tenant: tenant, Priority: j % 3})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids <- job.ID
+				q.List()
+			}
+		}(string(rune('a' + i%3)))
+	}
+	wg.Wait()
+	close(ids)
+	for id := range ids {
+		waitJob(t, q, id, finished)
+	}
+}
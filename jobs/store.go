@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps jobs across restarts of the queue.
+type Store interface {
+	// Load returns the stored jobs.
+	Load() ([]*Job, error)
+	// Save stores a job, replacing the stored job with its id.
+	Save(job *Job) error
+	// Delete removes the job with the given id.
+	Delete(id string) error
+}
+
+// FileStore stores each job as a JSON file in a directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store in dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Load() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Join(s.dir, entry.Name()), err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Save writes the job to a temporary file first, so that an interrupted save does not
+// lose the job.
+func (s *FileStore) Save(job *Job) error {
+	name, err := s.path(job.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *FileStore) Delete(id string) error {
+	name, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", fmt.Errorf("invalid job id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
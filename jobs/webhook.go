@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CallbackStatus is the state of the delivery of a job's callback.
+type CallbackStatus string
+
+const (
+	CallbackPending   CallbackStatus = "pending"
+	CallbackDelivered CallbackStatus = "delivered"
+	CallbackFailed    CallbackStatus = "failed"
+)
+
+// Delivery is an attempt to deliver the callback of a job.
+type Delivery struct {
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duration   float64   `json:"duration_seconds"`
+}
+
+// WebhookOptions configure the delivery of callbacks.
+type WebhookOptions struct {
+	// Secret signs the callbacks. They are not signed when it is empty.
+	Secret string
+	// MaxAttempts is the number of times a callback is sent before it fails, 5 by default.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled after each attempt up to
+	// an hour, 10 seconds by default.
+	Backoff time.Duration
+	// Timeout limits each attempt, 10 seconds by default.
+	Timeout time.Duration
+	// AllowedHosts are the host names, IP addresses and CIDR prefixes such as 10.0.0.0/8
+	// that callbacks may reach although they are loopback, private or link-local
+	// addresses. Callbacks to other internal addresses are refused.
+	AllowedHosts []string
+	// Client sends the callbacks. By default it is a client without proxy that refuses to
+	// connect to the internal addresses not in AllowedHosts. A client set here is used
+	// as it is.
+	Client *http.Client
+}
+
+// Webhook headers of the callbacks. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret.
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookPayload is the body of a callback.
+type WebhookPayload struct {
+	// Event is "job.succeeded", "job.failed" or "job.canceled".
+	Event string `json:"event"`
+	Job   Job    `json:"job"`
+}
+
+// SignWebhook returns the signature of a callback body sent at timestamp, in Unix seconds.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of a callback received with header and body, and
+// that it was sent less than tolerance ago.
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid webhook timestamp")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook timestamp is too old")
+	}
+	if !hmac.Equal([]byte(header.Get(WebhookSignatureHeader)), []byte(SignWebhook(secret, timestamp, body))) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+// ErrInvalidCallback is returned by Submit for a callback URL that is not an absolute
+// http or https URL, or that points to an internal address not in AllowedHosts.
+var ErrInvalidCallback = errors.New("invalid callback URL")
+
+func (opts WebhookOptions) validateCallbackURL(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w %q, it must be an http or https URL", ErrInvalidCallback, callback)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if opts.allowedHost(host) {
+		return nil
+	}
+	ip, err := netip.ParseAddr(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (err == nil && internalAddress(ip)) {
+		return fmt.Errorf("%w %q, it points to an internal address", ErrInvalidCallback, callback)
+	}
+	return nil
+}
+
+// internalAddress reports whether ip is a loopback, private, link-local or unspecified
+// address, such as the 169.254.169.254 of cloud metadata services.
+func internalAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// allowedHost reports whether host, a host name or an IP address, is in AllowedHosts.
+func (opts WebhookOptions) allowedHost(host string) bool {
+	ip, ipErr := netip.ParseAddr(host)
+	for _, allowed := range opts.AllowedHosts {
+		if prefix, err := netip.ParsePrefix(allowed); err == nil {
+			if ipErr == nil && prefix.Contains(ip.Unmap()) {
+				return true
+			}
+			continue
+		}
+		if addr, err := netip.ParseAddr(allowed); err == nil {
+			if ipErr == nil && addr.Unmap() == ip.Unmap() {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "."), strings.TrimSuffix(host, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the default client of the callbacks. It checks the address it connects
+// to rather than the URL, so that host names resolving to internal addresses are refused
+// too, also after a redirect or a change of their DNS records.
+func (opts WebhookOptions) client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := *dialer
+	guarded.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return err
+		}
+		if internalAddress(ip) && !opts.allowedHost(host) {
+			return fmt.Errorf("callback to internal address %s refused", host)
+		}
+		return nil
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && opts.allowedHost(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// deliver sends the callback of a finished job until it is accepted, fails MaxAttempts
+// times or the queue stops. An interrupted delivery stays pending for the next start.
+func (q *Queue) deliver(job *Job) {
+	defer q.deliveries.Done()
+	opts := q.opts.Webhooks
+	for {
+		q.mu.Lock()
+		payload := WebhookPayload{Event: "job." + string(job.Status), Job: *job}
+		payload.Job.CallbackStatus, payload.Job.Deliveries = "", nil
+		attempt := len(job.Deliveries) + 1
+		q.mu.Unlock()
+
+		delivery := q.send(job.ID, job.CallbackURL, payload, attempt)
+		if q.ctx.Err() != nil {
+			return
+		}
+		q.mu.Lock()
+		if q.jobs[job.ID] != job {
+			// The job was pruned.
+			q.mu.Unlock()
+			return
+		}
+		job.Deliveries = append(job.Deliveries, delivery)
+		switch {
+		case delivery.Error == "":
+			job.CallbackStatus = CallbackDelivered
+		case attempt >= opts.MaxAttempts:
+			job.CallbackStatus = CallbackFailed
+		}
+		q.save(job)
+		status := job.CallbackStatus
+		q.mu.Unlock()
+		if status != CallbackPending {
+			return
+		}
+
+		backoff := opts.Backoff << (attempt - 1)
+		if backoff > time.Hour || backoff <= 0 {
+			backoff = time.Hour
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-q.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// send posts a callback once and returns the delivery attempt.
+func (q *Queue) send(id string, callback string, payload WebhookPayload, attempt int) (delivery Delivery) {
+	opts := q.opts.Webhooks
+	delivery = Delivery{Attempt: attempt, Time: time.Now().UTC()}
+	defer func() { delivery.Duration = time.Since(delivery.Time).Seconds() }()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	ctx, cancel := context.WithTimeout(q.ctx, opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "translation-agent-go")
+	req.Header.Set(WebhookIDHeader, id)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	if opts.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(opts.Secret, timestamp, body))
+	}
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.Error = resp.Status
+	}
+	return delivery
+}
@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"event":"job.succeeded"}`)
+	header := func(secret string, sent time.Time) http.Header {
+		h := http.Header{}
+		h.Set(WebhookTimestampHeader, strconv.FormatInt(sent.Unix(), 10))
+		h.Set(WebhookSignatureHeader, SignWebhook(secret, sent.Unix(), body))
+		return h
+	}
+	now := time.Now()
+	if err := VerifyWebhook("secret", header("secret", now), body, time.Minute); err != nil {
+		t.Errorf("VerifyWebhook of a fresh callback: %v", err)
+	}
+	if err := VerifyWebhook("secret", header("secret", now.Add(-30*time.Second)), body, time.Minute); err != nil {
+		t.Errorf("VerifyWebhook of a callback within the tolerance: %v", err)
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+	}{
+		{"secret", header("other", now), body},
+		{"body", header("secret", now), []byte(`{"event":"job.failed"}`)},
+		{"old", header("secret", now.Add(-2*time.Minute)), body},
+		{"future", header("secret", now.Add(2*time.Minute)), body},
+		{"timestamp", http.Header{}, body},
+	}
+	for _, tt := range tests {
+		if err := VerifyWebhook("secret", tt.header, tt.body, time.Minute); err == nil {
+			t.Errorf("VerifyWebhook with a wrong %s did not fail", tt.name)
+		}
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	opts := WebhookOptions{AllowedHosts: []string{"10.1.0.0/16", "hooks.internal"}}
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://93.184.216.34/hook", true},
+		{"http://10.1.2.3/hook", true},
+		{"http://hooks.internal/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://localhost/hook", false},
+		{"http://api.localhost./hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://10.2.0.1/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"ftp://example.com/hook", false},
+		{"/hook", false},
+	}
+	for _, tt := range tests {
+		err := opts.validateCallbackURL(tt.url)
+		if tt.ok && err != nil {
+			t.Errorf("validateCallbackURL(%q) = %v, want nil", tt.url, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidCallback) {
+			t.Errorf("validateCallbackURL(%q) = %v, want %v", tt.url, err, ErrInvalidCallback)
+		}
+	}
+
+	q := newTestQueue(t, newGatedRunner().run, Options{})
+	if _, err := q.Submit(ta.TranslationRequest{SourceText: "Hello"}, SubmitOptions{CallbackURL: "http://127.0.0.1/hook"}); !errors.Is(err, ErrInvalidCallback) {
+		t.Errorf("Submit with an internal callback = %v, want %v", err, ErrInvalidCallback)
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	// The client checks the address it dials, whatever the URL says.
+	resp, err := WebhookOptions{}.client().Get(receiver.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("the default client connected to a loopback address")
+	}
+	if !strings.Contains(err.Error(), "refused") {
+		t.Errorf("connecting to a loopback address = %v, want a refusal", err)
+	}
+	resp, err = WebhookOptions{AllowedHosts: []string{"127.0.0.0/8"}}.client().Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("connecting to an allowed address: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// webhookReceiver records the callbacks it is sent, answering the first failures of them
+// with 500 Internal Server Error.
+type webhookReceiver struct {
+	failures int
+
+	mu       sync.Mutex
+	times    []time.Time
+	payloads []WebhookPayload
+	headers  []http.Header
+	errors   []error
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var payload WebhookPayload
+	err := json.Unmarshal(body, &payload)
+	if err == nil {
+		err = VerifyWebhook("secret", r.Header, body, time.Minute)
+	}
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.times = append(rcv.times, time.Now())
+	rcv.payloads = append(rcv.payloads, payload)
+	rcv.headers = append(rcv.headers, r.Header)
+	rcv.errors = append(rcv.errors, err)
+	if len(rcv.times) <= rcv.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// newWebhookQueue returns a queue running jobs at once and allowed to call receivers on
+// the loopback address, and a receiver.
+func newWebhookQueue(t *testing.T, failures int, maxAttempts int) (*Queue, *webhookReceiver, string) {
+	t.Helper()
+	rcv := &webhookReceiver{failures: failures}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+	runner := newGatedRunner()
+	close(runner.release)
+	q := newTestQueue(t, runner.run, Options{Webhooks: WebhookOptions{
+		Secret:       "secret",
+		MaxAttempts:  maxAttempts,
+		Backoff:      20 * time.Millisecond,
+		AllowedHosts: []string{"127.0.0.1"},
+	}})
+	return q, rcv, server.URL + "/hook"
+}
+
+func callbackDone(job Job) bool {
+	return job.CallbackStatus == CallbackDelivered || job.CallbackStatus == CallbackFailed
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	q, rcv, url := newWebhookQueue(t, 0, 5)
+	job := submit(t, q, "Hello", SubmitOptions{CallbackURL: url})
+	job = waitJob(t, q, job.ID, callbackDone)
+	if job.CallbackStatus != CallbackDelivered || len(job.Deliveries) != 1 || job.Deliveries[0].StatusCode != http.StatusOK {
+		t.Fatalf("job = %s with deliveries %+v, want delivered once", job.CallbackStatus, job.Deliveries)
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if rcv.errors[0] != nil {
+		t.Errorf("callback: %v", rcv.errors[0])
+	}
+	payload := rcv.payloads[0]
+	if payload.Event != "job.succeeded" || payload.Job.ID != job.ID || payload.Job.Result.Translation != "Hello" {
+		t.Errorf("callback payload = %+v", payload)
+	}
+	if got := rcv.headers[0].Get(WebhookIDHeader); got != job.ID {
+		t.Errorf("%s = %q, want %q", WebhookIDHeader, got, job.ID)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	q, rcv, url := newWebhookQueue(t, 2, 5)
+	job := submit(t, q, "Hello", SubmitOptions{CallbackURL: url})
+	job = waitJob(t, q, job.ID, callbackDone)
+	if job.CallbackStatus != CallbackDelivered || len(job.Deliveries) != 3 {
+		t.Fatalf("job = %s with deliveries %+v, want delivered at the third attempt", job.CallbackStatus, job.Deliveries)
+	}
+	for i, delivery := range job.Deliveries {
+		want := http.StatusInternalServerError
+		if i == 2 {
+			want = http.StatusOK
+		}
+		if delivery.Attempt != i+1 || delivery.StatusCode != want {
+			t.Errorf("delivery %d = %+v, want attempt %d with status %d", i, delivery, i+1, want)
+		}
+	}
+
+	// The backoff doubles after each attempt.
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	for i, backoff := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := rcv.times[i+1].Sub(rcv.times[i]); gap < backoff {
+			t.Errorf("attempt %d came %v after the previous one, want at least %v", i+2, gap, backoff)
+		}
+	}
+}
+
+func TestWebhookFails(t *testing.T) {
+	q, _, url := newWebhookQueue(t, 10, 2)
+	job := submit(t, q, "Hello", SubmitOptions{CallbackURL: url})
+	job = waitJob(t, q, job.ID, callbackDone)
+	if job.CallbackStatus != CallbackFailed || len(job.Deliveries) != 2 || job.Deliveries[1].Error == "" {
+		t.Errorf("job = %s with deliveries %+v, want failed after two attempts", job.CallbackStatus, job.Deliveries)
+	}
+}
+
+func TestWebhookResumesOnRestart(t *testing.T) {
+	rcv := &webhookReceiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := time.Now().UTC()
+	job := &Job{ID: "pending", Status: StatusSucceeded, FinishedAt: &finished, CallbackURL: server.URL, CallbackStatus: CallbackPending}
+	if err := store.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	q := newTestQueue(t, newGatedRunner().run, Options{Store: store, Webhooks: WebhookOptions{
+		Secret:       "secret",
+		AllowedHosts: []string{"127.0.0.1"},
+	}})
+	if got := waitJob(t, q, "pending", callbackDone); got.CallbackStatus != CallbackDelivered {
+		t.Errorf("resumed callback = %s, want delivered", got.CallbackStatus)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Load()
+	if err != nil || len(stored) != 1 || stored[0].CallbackStatus != CallbackDelivered {
+		t.Errorf("stored jobs = %+v, %v, want the callback delivered", stored, err)
+	}
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Language is a language parsed from a BCP 47 tag such as "zh-Hant-TW" or from an English
+// name such as "Brazilian Portuguese", with the names the prompts use.
+type Language struct {
+	Tag language.Tag
+	// Name is the English name of the language, with its script when the language is
+	// written in several, such as "Traditional Chinese" or "Serbian (Latin script)".
+	Name string
+	// Country is the English name of the region of the tag, such as "Brazil", or empty
+	// when the tag has no region.
+	Country string
+}
+
+// Code returns the BCP 47 tag of the language.
+func (l Language) Code() string {
+	return l.Tag.String()
+}
+
+// ParseLanguage parses a BCP 47 tag, with - or _ as separator, an English language name
+// such as "Chinese" or "British English", or a name with a region or script such as
+// "Portuguese (Brazil)" or "Chinese (Traditional)".
+func ParseLanguage(s string) (Language, error) {
+	s = strings.TrimSpace(s)
+	if tag, ok := lookupLanguageName(s); ok {
+		return newLanguage(tag), nil
+	}
+	if name, qualifier, ok := strings.Cut(s, "("); ok && strings.HasSuffix(qualifier, ")") {
+		base, ok := lookupLanguageName(strings.TrimSpace(name))
+		qualifier = strings.TrimSpace(strings.TrimSuffix(qualifier, ")"))
+		if ok {
+			if script, ok := lookupScriptName(qualifier); ok {
+				if tag, err := language.Compose(base, script); err == nil {
+					return newLanguage(tag), nil
+				}
+			}
+			if region, ok := lookupRegion(qualifier); ok {
+				if tag, err := language.Compose(base, region); err == nil {
+					return newLanguage(tag), nil
+				}
+			}
+		}
+	}
+	tag, err := language.Parse(strings.ReplaceAll(s, "_", "-"))
+	if err != nil || tag == language.Und {
+		return Language{}, fmt.Errorf("unknown language %q, use a BCP 47 tag such as zh-Hant or an English name such as Chinese", s)
+	}
+	return newLanguage(tag), nil
+}
+
+// RegionName returns the English name of an ISO 3166 region code such as "BR", or the
+// country as it is when it is not a code.
+func RegionName(country string) string {
+	country = strings.TrimSpace(country)
+	if len(country) != 2 && len(country) != 3 {
+		return country
+	}
+	if strings.EqualFold(country, "UK") {
+		country = "GB"
+	}
+	region, err := language.ParseRegion(country)
+	if err != nil {
+		return country
+	}
+	return display.English.Regions().Name(region)
+}
+
+// newLanguage returns the language of a tag, with its script in the name when it differs
+// from the script the language is usually written in, or when the language is Chinese.
+func newLanguage(tag language.Tag) Language {
+	base, _ := tag.Base()
+	script, _ := tag.Script()
+	l := Language{Tag: tag, Name: display.English.Languages().Name(base)}
+	defaultScript, _ := language.Make(base.String()).Script()
+	switch {
+	case base.String() == "zh":
+		zh, _ := language.Compose(base, script)
+		l.Name = display.English.Tags().Name(zh)
+	case script != defaultScript:
+		l.Name = fmt.Sprintf("%s (%s script)", l.Name, display.English.Scripts().Name(script))
+	}
+	if region, confidence := tag.Region(); confidence == language.Exact {
+		l.Country = display.English.Regions().Name(region)
+	}
+	return l
+}
+
+// sameLanguage reports whether two languages are the same language in the same script,
+// whatever their regions. Languages that do not parse are compared by name.
+func sameLanguage(a string, b string) bool {
+	la, errA := ParseLanguage(a)
+	lb, errB := ParseLanguage(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+	baseA, _ := la.Tag.Base()
+	baseB, _ := lb.Tag.Base()
+	scriptA, _ := la.Tag.Script()
+	scriptB, _ := lb.Tag.Script()
+	return baseA == baseB && scriptA == scriptB
+}
+
+// ValidateLanguages checks that the source language of req, unless it is AutoDetect, and
+// its target and pivot languages are BCP 47 tags or language names ParseLanguage knows,
+// and that the target language supports its formality.
+func ValidateLanguages(req TranslationRequest) error {
+	_, err := resolveLanguages(req)
+	return err
+}
+
+// resolveLanguages checks the languages and formality of req and replaces the languages
+// with the names of the prompts. The country defaults to the region of the target language, and a region
+// code is replaced with its name. An AutoDetect source language is kept.
+func resolveLanguages(req TranslationRequest) (TranslationRequest, error) {
+	if !IsAutoDetect(req.SourceLang) {
+		source, err := ParseLanguage(req.SourceLang)
+		if err != nil {
+			return req, fmt.Errorf("source language: %w", err)
+		}
+		req.SourceLang = source.Name
+	}
+	target, err := ParseLanguage(req.TargetLang)
+	if err != nil {
+		return req, fmt.Errorf("target language: %w", err)
+	}
+	req.TargetLang = target.Name
+	if err := validateFormality(req); err != nil {
+		return req, err
+	}
+	if req.PivotLang != "" {
+		pivot, err := ParseLanguage(req.PivotLang)
+		if err != nil {
+			return req, fmt.Errorf("pivot language: %w", err)
+		}
+		req.PivotLang = pivot.Name
+	}
+	if req.Country == "" {
+		req.Country = target.Country
+	} else {
+		req.Country = RegionName(req.Country)
+	}
+	return req, nil
+}
+
+var (
+	languageNamesOnce sync.Once
+	// languageNames are the tags of the lower cased English names of the ISO 639 languages
+	// and of common regional and script variants.
+	languageNames map[string]language.Tag
+	// regionNames are the regions of the lower cased English names of the ISO 3166 regions.
+	regionNames map[string]language.Region
+	// scriptNames are the scripts of the lower cased English names of the ISO 15924
+	// scripts, so that the names newLanguage gives parse again.
+	scriptNames map[string]language.Script
+)
+
+// namedVariants are the regional and script variants with names of their own, such as
+// "Brazilian Portuguese".
+var namedVariants = []string{
+	"en-AU", "en-CA", "en-GB", "en-US", "es-419", "es-ES", "es-MX", "fr-CA", "fr-CH",
+	"de-AT", "de-CH", "nl-BE", "pt-BR", "pt-PT", "zh-Hans", "zh-Hant",
+}
+
+func loadLanguageNames() {
+	languageNames, regionNames, scriptNames = map[string]language.Tag{}, map[string]language.Region{}, map[string]language.Script{}
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	var codes []string
+	for _, a := range letters {
+		for _, b := range letters {
+			codes = append(codes, string(a)+string(b))
+			for _, c := range letters {
+				codes = append(codes, string(a)+string(b)+string(c))
+			}
+		}
+	}
+	for _, code := range codes {
+		if base, err := language.ParseBase(code); err == nil {
+			// The first two letter code wins over the other codes of the same name.
+			name := strings.ToLower(display.English.Languages().Name(base))
+			if existing, ok := languageNames[name]; name != "" && (!ok || len(code) == 2 && len(existing.String()) > 2) {
+				languageNames[name] = language.Make(base.String())
+			}
+		}
+		if len(code) == 2 {
+			if region, err := language.ParseRegion(code); err == nil && region.IsCountry() {
+				regionNames[strings.ToLower(display.English.Regions().Name(region))] = region
+			}
+		}
+		if len(code) == 3 {
+			for _, d := range letters {
+				if script, err := language.ParseScript(code + string(d)); err == nil {
+					scriptNames[strings.ToLower(display.English.Scripts().Name(script))] = script
+				}
+			}
+		}
+	}
+	for _, variant := range namedVariants {
+		tag := language.MustParse(variant)
+		languageNames[strings.ToLower(display.English.Tags().Name(tag))] = tag
+	}
+	// The names of the languages in the APIs the servers are compatible with.
+	languageNames["chinese simplified"] = language.MustParse("zh-Hans")
+	languageNames["chinese traditional"] = language.MustParse("zh-Hant")
+	languageNames["norwegian"] = language.MustParse("nb")
+	languageNames["farsi"] = language.MustParse("fa")
+}
+
+func lookupLanguageName(name string) (language.Tag, bool) {
+	languageNamesOnce.Do(loadLanguageNames)
+	tag, ok := languageNames[strings.ToLower(name)]
+	return tag, ok
+}
+
+// lookupRegion returns the region of an ISO 3166 code or of its English name.
+func lookupRegion(s string) (language.Region, bool) {
+	languageNamesOnce.Do(loadLanguageNames)
+	if region, ok := regionNames[strings.ToLower(s)]; ok {
+		return region, true
+	}
+	if strings.EqualFold(s, "UK") {
+		s = "GB"
+	}
+	region, err := language.ParseRegion(s)
+	return region, err == nil
+}
+
+// lookupScriptName returns the script of an ISO 15924 code or of its English name, such as
+// "Latin" or "Latin script", or of the names "Simplified" and "Traditional".
+func lookupScriptName(s string) (language.Script, bool) {
+	languageNamesOnce.Do(loadLanguageNames)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(s), " script"))
+	if script, ok := scriptNames[s]; ok {
+		return script, true
+	}
+	switch s {
+	case "simplified", "simplified chinese", "simplified han":
+		s = "Hans"
+	case "traditional", "traditional chinese", "traditional han":
+		s = "Hant"
+	}
+	if len(s) != 4 {
+		return language.Script{}, false
+	}
+	script, err := language.ParseScript(s)
+	return script, err == nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		in      string
+		code    string
+		name    string
+		country string
+	}{
+		{"en", "en", "English", ""},
+		{"pt_BR", "pt-BR", "Portuguese", "Brazil"},
+		{"zh-Hant-TW", "zh-Hant-TW", "Traditional Chinese", "Taiwan"},
+		{"zh", "zh", "Simplified Chinese", ""},
+		{"sr-Latn", "sr-Latn", "Serbian (Latin script)", ""},
+		{"German", "de", "German", ""},
+		{" french ", "fr", "French", ""},
+		{"Brazilian Portuguese", "pt-BR", "Portuguese", "Brazil"},
+		{"British English", "en-GB", "English", "United Kingdom"},
+		{"Portuguese (Brazil)", "pt-BR", "Portuguese", "Brazil"},
+		{"English (UK)", "en-GB", "English", "United Kingdom"},
+		{"Chinese (Traditional)", "zh-Hant", "Traditional Chinese", ""},
+		{"Chinese Simplified", "zh-Hans", "Simplified Chinese", ""},
+		{"Serbian (Latin script)", "sr-Latn", "Serbian (Latin script)", ""},
+		{"Uzbek (Cyrillic)", "uz-Cyrl", "Uzbek (Cyrillic script)", ""},
+		{"Norwegian", "nb", "Norwegian Bokmål", ""},
+	}
+	for _, tt := range tests {
+		l, err := ParseLanguage(tt.in)
+		if err != nil {
+			t.Errorf("ParseLanguage(%q): %v", tt.in, err)
+			continue
+		}
+		if l.Code() != tt.code || l.Name != tt.name || l.Country != tt.country {
+			t.Errorf("ParseLanguage(%q) = %s, %q, %q, want %s, %q, %q", tt.in, l.Code(), l.Name, l.Country, tt.code, tt.name, tt.country)
+		}
+		// The names of the prompts parse again.
+		if again, err := ParseLanguage(l.Name); err != nil || again.Name != l.Name {
+			t.Errorf("ParseLanguage(%q) = %q, %v, want the same name", l.Name, again.Name, err)
+		}
+	}
+}
+
+func TestParseLanguageUnknown(t *testing.T) {
+	for _, in := range []string{"", "Klingonese", "xx-invalid-tag-", "Portuguese (Atlantis)"} {
+		if l, err := ParseLanguage(in); err == nil {
+			t.Errorf("ParseLanguage(%q) = %+v, want an error", in, l)
+		}
+	}
+}
+
+func TestRegionName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"BR", "Brazil"},
+		{"us", "United States"},
+		{"UK", "United Kingdom"},
+		{"USA", "United States"},
+		{"Bavaria", "Bavaria"},
+		{"Germany", "Germany"},
+		{" ZZ ", "Unknown Region"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := RegionName(tt.in); got != tt.want {
+			t.Errorf("RegionName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"en", "English", true},
+		{"en-US", "British English", true},
+		{"zh-Hans", "Chinese (Traditional)", false},
+		{"sr", "sr-Latn", false},
+		{"German", "French", false},
+		{"Klingonese", " klingonese", true},
+	}
+	for _, tt := range tests {
+		if got := sameLanguage(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameLanguage(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLanguages(t *testing.T) {
+	req, err := resolveLanguages(TranslationRequest{SourceLang: AutoDetect, TargetLang: "pt-BR", PivotLang: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.SourceLang != AutoDetect || req.TargetLang != "Portuguese" || req.PivotLang != "English" || req.Country != "Brazil" {
+		t.Errorf("resolveLanguages = %+v", req)
+	}
+	req, err = resolveLanguages(TranslationRequest{SourceLang: "de", TargetLang: "en-US", Country: "GB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.SourceLang != "German" || req.Country != "United Kingdom" {
+		t.Errorf("resolveLanguages = %+v, want German to English for the United Kingdom", req)
+	}
+
+	for _, req := range []TranslationRequest{
+		{SourceLang: "Klingonese", TargetLang: "en"},
+		{SourceLang: "en", TargetLang: "Klingonese"},
+		{SourceLang: "en", TargetLang: "de", PivotLang: "Klingonese"},
+	} {
+		err := ValidateLanguages(req)
+		if err == nil || !strings.Contains(err.Error(), `unknown language "Klingonese"`) {
+			t.Errorf("ValidateLanguages(%+v) = %v, want an unknown language error", req, err)
+		}
+	}
+	// The formality is checked against the resolved target language.
+	if err := ValidateLanguages(TranslationRequest{SourceLang: "en", TargetLang: "de-AT", Formality: FormalityMore}); err != nil {
+		t.Errorf("ValidateLanguages with a formal German target = %v", err)
+	}
+	if err := ValidateLanguages(TranslationRequest{SourceLang: "de", TargetLang: "en", Formality: FormalityMore}); !errors.Is(err, ErrFormalityNotSupported) {
+		t.Errorf("ValidateLanguages with a formal English target = %v, want %v", err, ErrFormalityNotSupported)
+	}
+	if err := ValidateLanguages(TranslationRequest{SourceLang: "en", TargetLang: "de", Formality: "casual"}); err == nil {
+		t.Error("ValidateLanguages with an unknown formality did not fail")
+	}
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TargetErrors holds the errors of the target languages TranslateMany could not translate
+// into, by target language as given.
+type TargetErrors map[string]error
+
+func (e TargetErrors) Error() string {
+	targets := make([]string, 0, len(e))
+	for target := range e {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	messages := make([]string, len(targets))
+	for i, target := range targets {
+		messages[i] = fmt.Sprintf("%s: %v", target, e[target])
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e TargetErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// TranslateMany translates the source text of req into each of targetLangs concurrently,
+// ignoring req.TargetLang. The source language is detected, and the text split into
+// chunks, once for all the targets, and so is the first leg of a pivot translation. It
+// returns the results by target language as given. A target that fails does not stop
+// the others: its error is reported in the returned TargetErrors, and the results hold
+// the other targets. Events of a context from WithEvents carry their TargetLang and come
+// from several goroutines.
+func (agent *TranslationAgent) TranslateMany(ctx context.Context, req TranslationRequest, targetLangs []string) (map[string]*TranslationResult, error) {
+	if !IsAutoDetect(req.SourceLang) {
+		if _, err := ParseLanguage(req.SourceLang); err != nil {
+			return nil, fmt.Errorf("source language: %w", err)
+		}
+	}
+	if _, err := agent.StyleProfile(req.Style); err != nil {
+		return nil, err
+	}
+	var detection *Detection
+	if IsAutoDetect(req.SourceLang) {
+		detected, err := agent.DetectLanguage(ctx, req.SourceText)
+		if err != nil {
+			return nil, err
+		}
+		detection = &detected
+	}
+	protector, err := newPlaceholderProtector(agent.ActivePlaceholderPatterns())
+	if err != nil {
+		return nil, err
+	}
+	sourceTextChunks, err := agent.splitText(protector.protect(req.SourceText))
+	if err != nil {
+		return nil, err
+	}
+
+	var pivotOnce sync.Once
+	var pivot *TranslationResult
+	var pivotErr error
+	pivotLeg := func(req TranslationRequest) (*TranslationResult, error) {
+		pivotOnce.Do(func() {
+			pivot, pivotErr = agent.translatePivot(ctx, req, protector, sourceTextChunks, detection)
+		})
+		return pivot, pivotErr
+	}
+
+	results := make(map[string]*TranslationResult, len(targetLangs))
+	errs := TargetErrors{}
+	seen := map[string]bool{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, targetLang := range targetLangs {
+		if seen[targetLang] {
+			continue
+		}
+		seen[targetLang] = true
+		wg.Add(1)
+		go func(targetLang string) {
+			defer wg.Done()
+			result, err := agent.translateTarget(withTarget(ctx, targetLang), req, targetLang, protector, sourceTextChunks, detection, pivotLeg)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[targetLang] = err
+				return
+			}
+			results[targetLang] = result
+		}(targetLang)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// translateTarget translates the chunks of the source text of req into targetLang, through
+// the first leg returned by pivotLeg when the target goes through the pivot language.
+func (agent *TranslationAgent) translateTarget(ctx context.Context, req TranslationRequest, targetLang string, protector *placeholderProtector, sourceTextChunks []string, detection *Detection, pivotLeg func(TranslationRequest) (*TranslationResult, error)) (*TranslationResult, error) {
+	req.TargetLang = targetLang
+	req, err := agent.applyStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = resolveLanguages(req); err != nil {
+		return nil, err
+	}
+	if detection != nil {
+		req.SourceLang = detection.Language
+	}
+	if req.Country == "" && sameLanguage(req.SourceLang, req.TargetLang) {
+		return skippedResult(ctx, req.SourceText, detection), nil
+	}
+	if usePivot(req) {
+		pivot, err := pivotLeg(req)
+		if err != nil {
+			return nil, err
+		}
+		return agent.translateFromPivot(ctx, req, protector, sourceTextChunks, pivot)
+	}
+	return agent.translateChunks(ctx, req, protector, sourceTextChunks, nil, detection)
+}
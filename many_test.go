@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestTranslateMany(t *testing.T) {
+	model := stubmodel.New(t, toGerman)
+	agent := NewTranslationAgent(stubConfig(model))
+	req := TranslationRequest{SourceLang: "English", SourceText: "Hello"}
+
+	var mu sync.Mutex
+	targets := map[string]bool{}
+	ctx := WithEvents(context.Background(), func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		targets[event.TargetLang] = true
+	})
+	results, err := agent.TranslateMany(ctx, req, []string{"German", "pt-BR", "English", "German"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("TranslateMany returned %d results, want 3", len(results))
+	}
+	for _, target := range []string{"German", "pt-BR"} {
+		if result := results[target]; result == nil || result.Translation != "Hallo" || result.Skipped {
+			t.Errorf("result for %s = %+v, want Hallo", target, result)
+		}
+	}
+	if result := results["English"]; !result.Skipped || result.Translation != "Hello" {
+		t.Errorf("result for the source language = %+v, want it skipped", result)
+	}
+	if !model.Asked("Brazil") {
+		t.Error("the model was not asked for Brazilian Portuguese")
+	}
+	if !targets["German"] || !targets["pt-BR"] || targets[""] {
+		t.Errorf("events came for the targets %v, want German and pt-BR", targets)
+	}
+
+	results, err = agent.TranslateMany(context.Background(), req, []string{"German", "not a language"})
+	var errs TargetErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs["not a language"] == nil {
+		t.Fatalf("TranslateMany with an unknown target = %v, want its error alone", err)
+	}
+	if results["German"] == nil || results["German"].Translation != "Hallo" {
+		t.Errorf("results with an unknown target = %+v, want German translated", results)
+	}
+}
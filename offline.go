@@ -0,0 +1,415 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OfflineStage is the step of the pipeline an offline batch is at.
+type OfflineStage int
+
+const (
+	OfflineInitialTranslation OfflineStage = iota + 1
+	OfflineReflection
+	OfflineImprovement
+	OfflineDone
+)
+
+func (stage OfflineStage) String() string {
+	switch stage {
+	case OfflineInitialTranslation:
+		return "initial translation"
+	case OfflineReflection:
+		return "reflection"
+	case OfflineImprovement:
+		return "improvement"
+	case OfflineDone:
+		return "done"
+	}
+	return "stage " + strconv.Itoa(int(stage))
+}
+
+// OfflineBatch runs the three steps of the translation of many texts through the
+// OpenAI Batch API instead of live requests. Export writes the requests of the current
+// step as a batch input file, and Import reads the batch output file and moves on to the
+// next step once every chunk of every text has a usable completion. The batch is plain
+// data, so it can be saved as JSON between the steps.
+type OfflineBatch struct {
+	Model               string                  `json:"model"`
+	Temperature         float32                 `json:"temperature"`
+	MaxTokens           int                     `json:"max_tokens"`
+	PlaceholderPatterns []string                `json:"placeholder_patterns,omitempty"`
+	Glossary            Glossary                `json:"glossary,omitempty"`
+	StyleGuide          string                  `json:"style_guide,omitempty"`
+	StyleProfiles       map[string]StyleProfile `json:"style_profiles,omitempty"`
+	Stage               OfflineStage            `json:"stage"`
+	Documents           []*OfflineDocument      `json:"documents"`
+	Usage               Usage                   `json:"usage"`
+}
+
+// OfflineDocument is a text of an offline batch and the completions of its chunks. The
+// chunks and completions hold placeholder tokens, which are restored by Result.
+type OfflineDocument struct {
+	ID           string             `json:"id"`
+	Request      TranslationRequest `json:"request"`
+	Chunks       []string           `json:"chunks"`
+	Translation1 []string           `json:"translation1"`
+	Reflection   []string           `json:"reflection"`
+	Translation2 []string           `json:"translation2"`
+	// Errors holds the last error of each chunk of the current step that failed.
+	Errors map[int]string `json:"errors,omitempty"`
+}
+
+// NewOfflineBatch returns an empty batch using the model, temperature, chunk size,
+// placeholder patterns, glossary and style guide of config.
+func NewOfflineBatch(config AgentConfig) *OfflineBatch {
+	if config.ModelName == "" {
+		config.ModelName = "gpt-4o-mini"
+	}
+	return &OfflineBatch{
+		Model:               config.ModelName,
+		Temperature:         config.Temperature,
+		MaxTokens:           config.MaxTokens,
+		PlaceholderPatterns: config.ActivePlaceholderPatterns(),
+		Glossary:            config.Glossary,
+		StyleGuide:          config.StyleGuide,
+		StyleProfiles:       config.StyleProfiles,
+		Stage:               OfflineInitialTranslation,
+	}
+}
+
+func (batch *OfflineBatch) agent() *TranslationAgent {
+	return NewTranslationAgent(AgentConfig{
+		ModelName:           batch.Model,
+		Temperature:         batch.Temperature,
+		MaxTokens:           batch.MaxTokens,
+		PlaceholderPatterns: batch.PlaceholderPatterns,
+		Glossary:            batch.Glossary,
+		StyleGuide:          batch.StyleGuide,
+		StyleProfiles:       batch.StyleProfiles,
+	})
+}
+
+// protector returns the placeholder protector of a document. Protecting the same text
+// again numbers its placeholders the same way, so it does not have to be saved.
+func (batch *OfflineBatch) protector(doc *OfflineDocument) (*placeholderProtector, error) {
+	protector, err := newPlaceholderProtector(batch.PlaceholderPatterns)
+	if err != nil {
+		return nil, err
+	}
+	protector.protect(doc.Request.SourceText)
+	return protector, nil
+}
+
+// Add splits the text of req into chunks and adds it to the batch under id. Texts can
+// only be added before the first import. An AutoDetect source language is detected
+// without the model.
+func (batch *OfflineBatch) Add(id string, req TranslationRequest) error {
+	if batch.Stage != OfflineInitialTranslation || batch.Usage.Requests > 0 {
+		return errors.New("texts can only be added before the first import")
+	}
+	if batch.document(id) != nil {
+		return fmt.Errorf("duplicate id %q", id)
+	}
+	if req.PivotLang != "" {
+		return errors.New("offline batches do not support pivot translation")
+	}
+	req, err := batch.agent().applyStyle(req)
+	if err != nil {
+		return err
+	}
+	if req, err = resolveLanguages(req); err != nil {
+		return err
+	}
+	if IsAutoDetect(req.SourceLang) {
+		detection := DetectLanguage(req.SourceText)
+		if detection.Code == "" {
+			return fmt.Errorf("could not detect the language of %q", id)
+		}
+		req.SourceLang = detection.Language
+	}
+	protector, err := newPlaceholderProtector(batch.PlaceholderPatterns)
+	if err != nil {
+		return err
+	}
+	chunks, err := batch.agent().splitText(protector.protect(req.SourceText))
+	if err != nil {
+		return err
+	}
+	batch.Documents = append(batch.Documents, &OfflineDocument{
+		ID:           id,
+		Request:      req,
+		Chunks:       chunks,
+		Translation1: make([]string, len(chunks)),
+		Reflection:   make([]string, len(chunks)),
+		Translation2: make([]string, len(chunks)),
+	})
+	return nil
+}
+
+func (batch *OfflineBatch) document(id string) *OfflineDocument {
+	for _, doc := range batch.Documents {
+		if doc.ID == id {
+			return doc
+		}
+	}
+	return nil
+}
+
+// completions returns the completions of the given step of the document.
+func (doc *OfflineDocument) completions(stage OfflineStage) []string {
+	switch stage {
+	case OfflineInitialTranslation:
+		return doc.Translation1
+	case OfflineReflection:
+		return doc.Reflection
+	case OfflineImprovement:
+		return doc.Translation2
+	}
+	return nil
+}
+
+// offlineBatchRequest is a line of a Batch API input file.
+type offlineBatchRequest struct {
+	CustomID string                       `json:"custom_id"`
+	Method   string                       `json:"method"`
+	URL      string                       `json:"url"`
+	Body     openai.ChatCompletionRequest `json:"body"`
+}
+
+// offlineBatchResponse is a line of a Batch API output or error file.
+type offlineBatchResponse struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                           `json:"status_code"`
+		Body       openai.ChatCompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// customID identifies the step and chunk of a document in the batch files.
+func customID(stage OfflineStage, doc *OfflineDocument, i int) string {
+	return fmt.Sprintf("%d:%d:%s", stage, i, doc.ID)
+}
+
+func parseCustomID(id string) (OfflineStage, int, string, error) {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) == 3 {
+		stage, err1 := strconv.Atoi(parts[0])
+		i, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil {
+			return OfflineStage(stage), i, parts[2], nil
+		}
+	}
+	return 0, 0, "", fmt.Errorf("invalid custom_id %q", id)
+}
+
+// Export writes a Batch API input file with a chat completion request for every chunk
+// of the current step that has no completion yet, and returns the number of requests.
+// After a partly failed import, exporting again retries the failed chunks.
+func (batch *OfflineBatch) Export(w io.Writer) (int, error) {
+	if batch.Stage == OfflineDone {
+		return 0, nil
+	}
+	agent := batch.agent()
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	n := 0
+	for _, doc := range batch.Documents {
+		protector, err := batch.protector(doc)
+		if err != nil {
+			return n, err
+		}
+		completions := doc.completions(batch.Stage)
+		for i := range doc.Chunks {
+			if completions[i] != "" {
+				continue
+			}
+			systemMessage, prompt, err := batch.prompt(agent, protector, doc, i)
+			if err != nil {
+				return n, fmt.Errorf("%s: %w", doc.ID, err)
+			}
+			err = encoder.Encode(offlineBatchRequest{
+				CustomID: customID(batch.Stage, doc, i),
+				Method:   "POST",
+				URL:      "/v1/chat/completions",
+				Body: openai.ChatCompletionRequest{
+					Model:       batch.Model,
+					Temperature: batch.Temperature,
+					Messages: []openai.ChatCompletionMessage{
+						{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
+						{Role: openai.ChatMessageRoleUser, Content: prompt},
+					},
+				},
+			})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// prompt renders the prompt of chunk i of the document for the current step.
+func (batch *OfflineBatch) prompt(agent *TranslationAgent, protector *placeholderProtector, doc *OfflineDocument, i int) (string, string, error) {
+	req := doc.Request
+	switch batch.Stage {
+	case OfflineInitialTranslation:
+		return agent.stepPrompt(protector, req, doc.Chunks[i], func() (string, string, error) {
+			return agent.initialTranslationPrompt(req, doc.Chunks, i)
+		})
+	case OfflineReflection:
+		return agent.stepPrompt(nil, req, doc.Chunks[i], func() (string, string, error) {
+			return agent.reflectionPrompt(req, nil, doc.Chunks, doc.Translation1, i)
+		})
+	case OfflineImprovement:
+		return agent.stepPrompt(protector, req, doc.Chunks[i], func() (string, string, error) {
+			return agent.improvementPrompt(req, doc.Chunks, doc.Translation1, doc.Reflection, i)
+		})
+	}
+	return "", "", fmt.Errorf("no prompt for step %s", batch.Stage)
+}
+
+// OfflineImport counts the results of an import.
+type OfflineImport struct {
+	Completed int
+	Failed    int
+	// Ignored counts the lines of other batches or of an earlier step.
+	Ignored int
+}
+
+// Import reads a Batch API output or error file of the current step. Completions of the
+// translation steps must keep the placeholder tokens of their chunk; failed requests and
+// completions are recorded in the Errors of their document and exported again. The
+// batch moves on to the next step when every chunk has a completion. Once the batch is
+// done, every line is ignored.
+func (batch *OfflineBatch) Import(r io.Reader) (OfflineImport, error) {
+	var result OfflineImport
+	protectors := map[string]*placeholderProtector{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var resp offlineBatchResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			return result, fmt.Errorf("line %d: %v", line, err)
+		}
+		stage, i, id, err := parseCustomID(resp.CustomID)
+		if err != nil {
+			return result, fmt.Errorf("line %d: %v", line, err)
+		}
+		doc := batch.document(id)
+		if batch.Stage == OfflineDone || stage != batch.Stage || doc == nil || i < 0 || i >= len(doc.Chunks) {
+			result.Ignored++
+			continue
+		}
+		if _, ok := protectors[id]; !ok {
+			if protectors[id], err = batch.protector(doc); err != nil {
+				return result, err
+			}
+		}
+
+		completion, err := batch.completion(resp)
+		if err == nil && stage != OfflineReflection {
+			err = protectors[id].verify(doc.Chunks[i], completion)
+		}
+		if err != nil {
+			if doc.Errors == nil {
+				doc.Errors = map[int]string{}
+			}
+			doc.Errors[i] = err.Error()
+			result.Failed++
+			continue
+		}
+		doc.completions(stage)[i] = completion
+		delete(doc.Errors, i)
+		result.Completed++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	if batch.Stage != OfflineDone && batch.Pending() == 0 {
+		batch.Stage++
+		for _, doc := range batch.Documents {
+			doc.Errors = nil
+		}
+	}
+	return result, nil
+}
+
+// completion returns the completion of a response line and adds its usage to the batch.
+func (batch *OfflineBatch) completion(resp offlineBatchResponse) (string, error) {
+	if resp.Error != nil {
+		return "", fmt.Errorf("%s: %s", resp.Error.Code, resp.Error.Message)
+	}
+	if resp.Response == nil {
+		return "", errors.New("no response")
+	}
+	body := resp.Response.Body
+	if resp.Response.StatusCode != 200 {
+		return "", fmt.Errorf("status code %d", resp.Response.StatusCode)
+	}
+	batch.Usage = batch.Usage.Add(Usage{
+		Requests:         1,
+		PromptTokens:     body.Usage.PromptTokens,
+		CompletionTokens: body.Usage.CompletionTokens,
+	})
+	if len(body.Choices) == 0 || body.Choices[0].Message.Content == "" {
+		return "", errors.New("no completion choices returned")
+	}
+	return body.Choices[0].Message.Content, nil
+}
+
+// Pending returns the number of chunks of the current step without a completion.
+func (batch *OfflineBatch) Pending() int {
+	n := 0
+	for _, doc := range batch.Documents {
+		for _, completion := range doc.completions(batch.Stage) {
+			if completion == "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Result returns the translation of the document with the given id once the batch is
+// done.
+func (batch *OfflineBatch) Result(id string) (*TranslationResult, error) {
+	doc := batch.document(id)
+	if doc == nil {
+		return nil, fmt.Errorf("unknown id %q", id)
+	}
+	if batch.Stage != OfflineDone {
+		return nil, fmt.Errorf("batch is at the %s step", batch.Stage)
+	}
+	protector, err := batch.protector(doc)
+	if err != nil {
+		return nil, err
+	}
+	result := &TranslationResult{Chunks: make([]ChunkResult, len(doc.Chunks))}
+	for i := range doc.Chunks {
+		result.Chunks[i] = ChunkResult{
+			SourceText:   protector.restore(doc.Chunks[i]),
+			Translation1: protector.restore(doc.Translation1[i]),
+			Reflection:   protector.restore(doc.Reflection[i]),
+			Translation2: protector.restore(doc.Translation2[i]),
+		}
+	}
+	result.Translation = protector.restore(joinTranslationChunks(doc.Translation2))
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// runOfflineStep exports the current step of batch and returns a Batch API output file
+// answering every request with the completion of its step.
+func runOfflineStep(t *testing.T, batch *OfflineBatch, completions map[OfflineStage]string) []byte {
+	t.Helper()
+	var input bytes.Buffer
+	if _, err := batch.Export(&input); err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	for _, line := range strings.Split(strings.TrimSpace(input.String()), "\n") {
+		var req offlineBatchRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatal(err)
+		}
+		const response = `{"custom_id":%q,"response":{"status_code":200,"body":{"choices":[{"message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}}}`
+		fmt.Fprintf(&output, response+"\n", req.CustomID, completions[batch.Stage])
+	}
+	return output.Bytes()
+}
+
+func TestOfflineBatch(t *testing.T) {
+	batch := NewOfflineBatch(AgentConfig{MaxTokens: 1000})
+	if err := batch.Add("greeting", TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Add("greeting", TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"}); err == nil {
+		t.Error("Add with a duplicate id did not fail")
+	}
+	completions := map[OfflineStage]string{
+		OfflineInitialTranslation: "Hallo",
+		OfflineReflection:         "Use a greeting.",
+		OfflineImprovement:        "Hallo!",
+	}
+	var last []byte
+	for stage := OfflineInitialTranslation; stage < OfflineDone; stage++ {
+		if batch.Stage != stage {
+			t.Fatalf("batch is at the %s step, want %s", batch.Stage, stage)
+		}
+		last = runOfflineStep(t, batch, completions)
+		result, err := batch.Import(bytes.NewReader(last))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != (OfflineImport{Completed: 1}) {
+			t.Errorf("Import at the %s step = %+v", stage, result)
+		}
+	}
+	if batch.Stage != OfflineDone || batch.Usage.Requests != 3 {
+		t.Fatalf("batch = %s with %d requests, want done with 3", batch.Stage, batch.Usage.Requests)
+	}
+
+	// Importing the last output again leaves the batch done.
+	result, err := batch.Import(bytes.NewReader(last))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (OfflineImport{Ignored: 1}) || batch.Stage != OfflineDone {
+		t.Errorf("Import of a done batch = %+v at the %s step, want the line ignored and the batch done", result, batch.Stage)
+	}
+	translation, err := batch.Result("greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translation.Translation != "Hallo!" || translation.Chunks[0].Reflection != "Use a greeting." {
+		t.Errorf("Result = %+v", translation)
+	}
+}
+
+func TestOfflineBatchFailedChunks(t *testing.T) {
+	batch := NewOfflineBatch(AgentConfig{MaxTokens: 1000})
+	if err := batch.Add("a", TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	failed := `{"custom_id":"1:0:a","error":{"code":"server_error","message":"try again"}}` + "\n" +
+		`{"custom_id":"9:0:other","response":{"status_code":200}}` + "\n"
+	result, err := batch.Import(strings.NewReader(failed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (OfflineImport{Failed: 1, Ignored: 1}) || batch.Stage != OfflineInitialTranslation || batch.Pending() != 1 {
+		t.Errorf("Import = %+v at the %s step with %d pending", result, batch.Stage, batch.Pending())
+	}
+	if got := batch.Documents[0].Errors[0]; got != "server_error: try again" {
+		t.Errorf("error of the chunk = %q", got)
+	}
+	if _, err := batch.Result("a"); err == nil {
+		t.Error("Result of an unfinished batch did not fail")
+	}
+}
@@ -2,29 +2,36 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
-func (agent *TranslationAgent) getCompletion(prompt string, systemMessage string) (string, error) {
+func (agent *TranslationAgent) getCompletion(ctx context.Context, prompt string, systemMessage string) (string, error) {
 	config := openai.DefaultConfig(agent.ApiKey)
-	config.BaseURL = agent.BaseURL
+	if agent.BaseURL != "" {
+		config.BaseURL = agent.BaseURL
+	}
 	client := openai.NewClientWithConfig(config)
 
 	if systemMessage == "" {
 		systemMessage = "You are a helpful assistant."
 	}
 
-	if agent.ModelName == "" {
-		agent.ModelName = "gpt-4o-mini" // Equivalent to "gpt-4-turbo" if that's what you meant by default
+	// The agent is not written to, as TranslateMany calls this from several goroutines.
+	model := agent.ModelName
+	if model == "" {
+		model = "gpt-4o-mini"
 	}
 
 	// fmt.Printf("System message: %s\n", systemMessage)
 	// fmt.Printf("Prompt: %s\n", prompt)
 
 	request := openai.ChatCompletionRequest{
-		Model:       agent.ModelName,
+		Model:       model,
 		Temperature: agent.Temperature,
 		Messages: []openai.ChatCompletionMessage{
 			{
@@ -38,10 +45,15 @@ func (agent *TranslationAgent) getCompletion(prompt string, systemMessage string
 		},
 	}
 
-	resp, err := client.CreateChatCompletion(context.Background(), request)
+	if hasEvents(ctx) {
+		return agent.streamCompletion(ctx, client, request)
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, request)
 	if err != nil {
 		return "", fmt.Errorf("ChatCompletion error: %v", err)
 	}
+	agent.addUsage(resp.Usage)
 
 	if len(resp.Choices) > 0 {
 		return resp.Choices[0].Message.Content, nil
@@ -49,3 +61,43 @@ func (agent *TranslationAgent) getCompletion(prompt string, systemMessage string
 
 	return "", fmt.Errorf("no completion choices returned")
 }
+
+// streamCompletion gets a completion token by token, reporting every token as an event.
+func (agent *TranslationAgent) streamCompletion(ctx context.Context, client *openai.Client, request openai.ChatCompletionRequest) (string, error) {
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("ChatCompletionStream error: %v", err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	sawUsage := false
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("ChatCompletionStream error: %v", err)
+		}
+		if resp.Usage != nil {
+			agent.addUsage(*resp.Usage)
+			sawUsage = true
+		}
+		if len(resp.Choices) > 0 && resp.Choices[0].Delta.Content != "" {
+			content.WriteString(resp.Choices[0].Delta.Content)
+			emitEvent(ctx, Event{Type: EventToken, Text: resp.Choices[0].Delta.Content})
+		}
+	}
+
+	if !sawUsage {
+		// The API does not report the usage of streams, still count the request.
+		agent.addUsage(openai.Usage{})
+	}
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no completion choices returned")
+	}
+	return content.String(), nil
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestPivot(t *testing.T) {
+	model := stubmodel.New(t, toGerman)
+	agent := NewTranslationAgent(stubConfig(model))
+	req := TranslationRequest{SourceLang: "German", TargetLang: "French", PivotLang: "English", SourceText: "Hallo"}
+	result, err := agent.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pivot == nil || result.PivotLang != "English" {
+		t.Fatalf("result = %+v, want a translation through English", result)
+	}
+	if !model.Asked("<ORIGINAL_TEXT>") {
+		t.Error("the second leg was not given the original text")
+	}
+	if usage := agent.Usage(); usage.Requests != 6 {
+		t.Errorf("pivot translation made %d requests, want 6", usage.Requests)
+	}
+
+	for _, pivotLang := range []string{"German", "French", "fr-FR"} {
+		req.PivotLang = pivotLang
+		result, err := agent.Execute(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Pivot != nil || result.PivotLang != "" {
+			t.Errorf("result with the pivot %s = %+v, want a direct translation", pivotLang, result)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPlaceholderPatterns match the placeholders and markup of common i18n libraries.
+var DefaultPlaceholderPatterns = []string{
+	`\{\{[^{}]*\}\}`,    // {{name}} (i18next, Handlebars)
+	`%\{[^{}]*\}`,       // %{count} (Rails)
+	`%#@[A-Za-z0-9_]+@`, // %#@items@ (stringsdict)
+	`%(?:\d+\$)?[-+#0]*\d*(?:\.\d+)?(?:l|ll|h)?[sdifuxXeEgGcp@]`, // %s, %1$d, %@ (printf)
+	`\{\s*[A-Za-z0-9_]+\s*(?:\}|,\s*[a-z]+\s*,?)`,                // {name}, {0}, {count, plural, (ICU)
+	markupTagPattern, // <b>, </b>, <br/>
+}
+
+// MarkupPlaceholderPatterns match the tags, comments and character references of XML
+// and HTML, to translate the text of markup documents.
+var MarkupPlaceholderPatterns = []string{
+	`<!--[\s\S]*?-->`,
+	markupTagPattern,
+	`&(?:[A-Za-z]+|#\d+|#x[0-9A-Fa-f]+);`,
+}
+
+// ActivePlaceholderPatterns returns the patterns of the placeholders protected in plain
+// text: PlaceholderPatterns, DefaultPlaceholderPatterns when none are set, or none when
+// DisablePlaceholders is set.
+func (config AgentConfig) ActivePlaceholderPatterns() []string {
+	switch {
+	case config.DisablePlaceholders:
+		return nil
+	case len(config.PlaceholderPatterns) == 0:
+		return DefaultPlaceholderPatterns
+	}
+	return config.PlaceholderPatterns
+}
+
+const markupTagPattern = `</?[A-Za-z][A-Za-z0-9:_-]*(?:\s[^<>]*)?/?>`
+
+// placeholderToken matches the opaque tokens placeholders are replaced with. The model may
+// add a space before the slash, so that is accepted too.
+var placeholderToken = regexp.MustCompile(`<ph_(\d+)\s*/>`)
+
+// pluralBranchPattern matches the selector in front of an ICU plural branch, so that a
+// branch like "other {items}" is not mistaken for an {items} argument.
+var pluralBranchPattern = regexp.MustCompile(`(?:^|[\s,}])(?:zero|one|two|few|many|other|=\d+)\s*$`)
+
+// placeholderProtector replaces placeholders with numbered tokens such as <ph_1/> before a
+// text is sent to the model, checks the tokens survived and puts the placeholders back.
+type placeholderProtector struct {
+	pattern      *regexp.Regexp
+	placeholders []string
+}
+
+func newPlaceholderProtector(patterns []string) (*placeholderProtector, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid placeholder pattern %q: %v", pattern, err)
+		}
+	}
+	pattern, err := regexp.Compile("(?:" + strings.Join(patterns, ")|(?:") + ")")
+	if err != nil {
+		return nil, err
+	}
+	return &placeholderProtector{pattern: pattern}, nil
+}
+
+// protect returns text with every placeholder replaced by a token. Tokens are numbered
+// across all calls, so texts protected by the same protector can be mixed.
+func (p *placeholderProtector) protect(text string) string {
+	if p == nil {
+		return text
+	}
+	var sb strings.Builder
+	last := 0
+	for _, loc := range p.pattern.FindAllStringIndex(text, -1) {
+		if text[loc[0]] == '{' && pluralBranchPattern.MatchString(text[:loc[0]]) {
+			continue
+		}
+		p.placeholders = append(p.placeholders, text[loc[0]:loc[1]])
+		sb.WriteString(text[last:loc[0]])
+		fmt.Fprintf(&sb, "<ph_%d/>", len(p.placeholders))
+		last = loc[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// active reports whether any placeholder has been protected so far.
+func (p *placeholderProtector) active() bool {
+	return p != nil && len(p.placeholders) > 0
+}
+
+// verify checks that translation contains every token of source exactly once and no others.
+func (p *placeholderProtector) verify(source string, translation string) error {
+	if p == nil {
+		return nil
+	}
+	want := map[string]int{}
+	for _, m := range placeholderToken.FindAllStringSubmatch(source, -1) {
+		want[m[1]]++
+	}
+	got := map[string]int{}
+	for _, m := range placeholderToken.FindAllStringSubmatch(translation, -1) {
+		got[m[1]]++
+	}
+
+	var problems []string
+	for id, n := range want {
+		switch {
+		case got[id] == 0:
+			problems = append(problems, "lost "+p.placeholder(id))
+		case got[id] > n:
+			problems = append(problems, "duplicated "+p.placeholder(id))
+		}
+	}
+	for id := range got {
+		if want[id] == 0 {
+			problems = append(problems, "unexpected "+p.placeholder(id))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &PlaceholderError{Problems: problems}
+	}
+	return nil
+}
+
+func (p *placeholderProtector) placeholder(id string) string {
+	n, _ := strconv.Atoi(id)
+	if n >= 1 && n <= len(p.placeholders) {
+		return strconv.Quote(p.placeholders[n-1])
+	}
+	return "<ph_" + id + "/>"
+}
+
+// reprotect replaces the placeholders in text, a translation of the protected chunk
+// source, with the tokens they have in source. Repeated placeholders get the tokens of
+// their occurrences in order; placeholders missing from source are left as they are.
+func (p *placeholderProtector) reprotect(source string, text string) string {
+	if p == nil {
+		return text
+	}
+	tokens := map[string][]string{}
+	for _, m := range placeholderToken.FindAllStringSubmatch(source, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= len(p.placeholders) {
+			tokens[p.placeholders[n-1]] = append(tokens[p.placeholders[n-1]], m[0])
+		}
+	}
+	return p.pattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		queue := tokens[placeholder]
+		if len(queue) == 0 {
+			return placeholder
+		}
+		tokens[placeholder] = queue[1:]
+		return queue[0]
+	})
+}
+
+// restore replaces the tokens in text with the original placeholders.
+func (p *placeholderProtector) restore(text string) string {
+	if p == nil {
+		return text
+	}
+	return placeholderToken.ReplaceAllStringFunc(text, func(token string) string {
+		n, _ := strconv.Atoi(placeholderToken.FindStringSubmatch(token)[1])
+		if n >= 1 && n <= len(p.placeholders) {
+			return p.placeholders[n-1]
+		}
+		return token
+	})
+}
+
+// PlaceholderError reports placeholders that did not survive a translation step.
+type PlaceholderError struct {
+	Problems []string
+}
+
+func (e *PlaceholderError) Error() string {
+	return "placeholders not preserved: " + strings.Join(e.Problems, ", ")
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholderProtect(t *testing.T) {
+	tests := []struct {
+		text         string
+		want         string
+		placeholders []string
+	}{
+		{"Hello, {{name}}!", "Hello, <ph_1/>!", []string{"{{name}}"}},
+		{"%{count} of %{total}", "<ph_1/> of <ph_2/>", []string{"%{count}", "%{total}"}},
+		{"%1$s has %2$d files, %@", "<ph_1/> has <ph_2/> files, <ph_3/>", []string{"%1$s", "%2$d", "%@"}},
+		{"<b>Bold</b> and <br/>", "<ph_1/>Bold<ph_2/> and <ph_3/>", []string{"<b>", "</b>", "<br/>"}},
+		{"{count, plural, one {# item} other {# items}}", "<ph_1/> one {# item} other {# items}}", []string{"{count, plural,"}},
+		{"%#@files@ left", "<ph_1/> left", []string{"%#@files@"}},
+		{"No placeholders", "No placeholders", nil},
+	}
+	for _, tt := range tests {
+		p, err := newPlaceholderProtector(DefaultPlaceholderPatterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.protect(tt.text); got != tt.want {
+			t.Errorf("protect(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if !reflect.DeepEqual(p.placeholders, tt.placeholders) {
+			t.Errorf("protect(%q) placeholders = %q, want %q", tt.text, p.placeholders, tt.placeholders)
+		}
+		if got := p.restore(p.protect(tt.text)); got != tt.text {
+			t.Errorf("restore(protect(%q)) = %q", tt.text, got)
+		}
+	}
+}
+
+func TestPlaceholderProtectNumbersAcrossTexts(t *testing.T) {
+	p, _ := newPlaceholderProtector(DefaultPlaceholderPatterns)
+	first, second := p.protect("{{a}}"), p.protect("{{b}} {{a}}")
+	if first != "<ph_1/>" || second != "<ph_2/> <ph_3/>" {
+		t.Errorf("protect = %q, %q, want <ph_1/>, <ph_2/> <ph_3/>", first, second)
+	}
+	if got := p.restore(second + first); got != "{{b}} {{a}}{{a}}" {
+		t.Errorf("restore = %q", got)
+	}
+}
+
+func TestNewPlaceholderProtector(t *testing.T) {
+	if p, err := newPlaceholderProtector(nil); p != nil || err != nil {
+		t.Errorf("newPlaceholderProtector(nil) = %v, %v, want nil, nil", p, err)
+	}
+	if _, err := newPlaceholderProtector([]string{"("}); err == nil {
+		t.Error("newPlaceholderProtector with an invalid pattern did not fail")
+	}
+	// A nil protector leaves texts as they are.
+	var p *placeholderProtector
+	if p.protect("{{a}}") != "{{a}}" || p.restore("<ph_1/>") != "<ph_1/>" || p.verify("<ph_1/>", "") != nil || p.active() {
+		t.Error("nil protector changed a text")
+	}
+}
+
+func TestPlaceholderVerify(t *testing.T) {
+	p, _ := newPlaceholderProtector(DefaultPlaceholderPatterns)
+	source := p.protect("{{a}} and {{b}}")
+	tests := []struct {
+		translation string
+		problems    []string
+	}{
+		{"<ph_2/> und <ph_1/>", nil},
+		{"<ph_1 /> und <ph_2/>", nil},
+		{"<ph_1/> und", []string{`lost "{{b}}"`}},
+		{"<ph_1/> <ph_1/> und <ph_2/>", []string{`duplicated "{{a}}"`}},
+		{"<ph_1/> und <ph_2/> <ph_9/>", []string{"unexpected <ph_9/>"}},
+		{"<ph_8/> <ph_2/> <ph_2/> <ph_9/>", []string{`duplicated "{{b}}"`, `lost "{{a}}"`, "unexpected <ph_8/>", "unexpected <ph_9/>"}},
+	}
+	for _, tt := range tests {
+		err := p.verify(source, tt.translation)
+		if tt.problems == nil {
+			if err != nil {
+				t.Errorf("verify(%q) = %v, want nil", tt.translation, err)
+			}
+			continue
+		}
+		var placeholderErr *PlaceholderError
+		if !errors.As(err, &placeholderErr) || !reflect.DeepEqual(placeholderErr.Problems, tt.problems) {
+			t.Errorf("verify(%q) = %v, want problems %q", tt.translation, err, tt.problems)
+		}
+	}
+}
+
+func TestPlaceholderReprotect(t *testing.T) {
+	p, _ := newPlaceholderProtector(DefaultPlaceholderPatterns)
+	p.protect("{{x}}")
+	source := p.protect("{{a}} {{b}} {{a}}")
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{b}} {{a}} {{a}}", "<ph_3/> <ph_2/> <ph_4/>"},
+		{"{{a}} {{a}} {{a}}", "<ph_2/> <ph_4/> {{a}}"},
+		{"{{x}} {{c}}", "{{x}} {{c}}"},
+		{"<ph_3/> {{a}}", "<ph_3/> <ph_2/>"},
+	}
+	for _, tt := range tests {
+		if got := p.reprotect(source, tt.text); got != tt.want {
+			t.Errorf("reprotect(%q, %q) = %q, want %q", source, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholderRestoreUnknownToken(t *testing.T) {
+	p, _ := newPlaceholderProtector(DefaultPlaceholderPatterns)
+	p.protect("{{a}}")
+	if got := p.restore("<ph_1 /> <ph_2/>"); got != "{{a}} <ph_2/>" {
+		t.Errorf("restore = %q, want %q", got, "{{a}} <ph_2/>")
+	}
+}
+
+func TestExecuteKeepsPlaceholders(t *testing.T) {
+	agent := newStubAgent(t, toGerman)
+	result, err := agent.Execute(context.Background(), TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello, {{name}}!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Translation != "Hallo, {{name}}!" {
+		t.Errorf("Execute = %q, want %q", result.Translation, "Hallo, {{name}}!")
+	}
+
+	// Placeholders are only handed to the model when protection is turned off.
+	var prompted string
+	disabled := newStubAgent(t, func(s string) string { prompted = s; return toGerman(s) })
+	disabled.DisablePlaceholders = true
+	if _, err := disabled.Execute(context.Background(), TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello, {{name}}!"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompted, "{{name}}") {
+		t.Errorf("Execute with placeholders turned off prompted %q, want the placeholder as it is", prompted)
+	}
+
+	lossy := newStubAgent(t, func(s string) string { return strings.ReplaceAll(toGerman(s), "<ph_1/>", "") })
+	lossy.MaxRetries = 1
+	_, err = lossy.Execute(context.Background(), TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello, {{name}}!"})
+	var placeholderErr *PlaceholderError
+	if !errors.As(err, &placeholderErr) {
+		t.Errorf("Execute with a model losing placeholders = %v, want a PlaceholderError", err)
+	}
+}
@@ -24,9 +24,12 @@ func renderTemplate(templateStr string, data map[string]interface{}) (string, er
 // one chunk translation
 const (
 	oneChunkInitialTranslationSystemMessage = `You are an expert linguist, specializing in translation from {{.sourceLang}} to {{.targetLang}}.`
-	oneChunkInitialTranslationPrompt        = `This is an {{.sourceLang}} to {{.targetLang}} translation, please provide the {{.targetLang}} translation for this text.
+	oneChunkInitialTranslationPrompt        = `This is an {{.sourceLang}} to {{.targetLang}} translation, please provide the {{.targetLang}} translation for the text delimited by XML tags <SOURCE_TEXT></SOURCE_TEXT>.
 Do not provide any explanations or text apart from the translation.
-{{.sourceLang}}: {{.sourceText}}
+
+<SOURCE_TEXT>
+{{.sourceText}}
+</SOURCE_TEXT>
 
 {{.targetLang}}:`
 
@@ -226,3 +229,193 @@ to whether there are ways to improve the translation's
 
 Output only the new translation of the indicated part and nothing else.`
 )
+
+// segment translation
+const (
+	segmentInitialTranslationSystemMessage = `You are an expert linguist, specializing in translation from {{.sourceLang}} to {{.targetLang}}.`
+	segmentInitialTranslationPrompt        = `This is an {{.sourceLang}} to {{.targetLang}} translation of a set of short text segments, such as the strings of a resource file, please provide the {{.targetLang}} translation for each of them.
+
+The strings are given as a JSON object delimited by XML tags <SOURCE_SEGMENTS></SOURCE_SEGMENTS>. Each key identifies a string and each value is the {{.sourceLang}} text to translate.
+{{if .notes}}
+Notes describing where some of the strings are used are delimited by XML tags <NOTES></NOTES>. Use them as context only, do not translate them.
+
+<NOTES>
+{{.notes}}
+</NOTES>
+{{end}}
+Keep placeholders and markup exactly as they appear in the source, for example {{"{{name}}"}}, %{count}, {0}, %1$s, %@ and <b></b>.
+In ICU messages such as {count, plural, one {...} other {...}}, translate only the text inside the branches and keep argument names and keywords unchanged.
+{{if .surroundingText}}
+The segments are taken from a longer document. Surrounding text from that document, delimited by XML tags <CONTEXT></CONTEXT>, is given for reference only. Do not translate it.
+
+<CONTEXT>
+{{.surroundingText}}
+</CONTEXT>
+{{end}}
+
+<SOURCE_SEGMENTS>
+{{.segments}}
+</SOURCE_SEGMENTS>
+
+Respond with a JSON object with exactly the same keys whose values are the {{.targetLang}} translations.
+Do not provide any explanations or text apart from the JSON object.`
+
+	segmentReflectionSystemMessage = `You are an expert linguist specializing in translation from {{.sourceLang}} to {{.targetLang}}.
+You will be provided with source strings and their translations and your goal is to improve the translations.`
+	segmentReflectionPrompt = `Your task is to carefully read a set of source strings and their translations from {{.sourceLang}} to {{.targetLang}}, and then give constructive criticisms and helpful suggestions to improve the translations.
+
+The source strings and initial translations are JSON objects with the same keys, delimited by XML tags <SOURCE_SEGMENTS></SOURCE_SEGMENTS> and <TRANSLATION></TRANSLATION>, as follows:
+{{if .notes}}
+<NOTES>
+{{.notes}}
+</NOTES>
+{{end}}{{if .surroundingText}}
+The segments are taken from a longer document. Surrounding text from that document, delimited by XML tags <CONTEXT></CONTEXT>, is given for reference only. Do not translate it.
+
+<CONTEXT>
+{{.surroundingText}}
+</CONTEXT>
+{{end}}
+<SOURCE_SEGMENTS>
+{{.segments}}
+</SOURCE_SEGMENTS>
+
+<TRANSLATION>
+{{.translation1}}
+</TRANSLATION>
+
+When writing suggestions, pay attention to whether there are ways to improve the translations'
+(i) accuracy (by correcting errors of addition, mistranslation, omission, or untranslated text),
+(ii) fluency (by applying {{.targetLang}} grammar, spelling and punctuation rules, and ensuring there are no unnecessary repetitions),
+(iii) consistency (by ensuring the same term is translated the same way across all strings),
+(iv) placeholders (by ensuring placeholders, markup and ICU message syntax are kept exactly as in the source).
+
+Write a list of specific, helpful and constructive suggestions for improving the translations.
+Each suggestion should name the key it refers to.
+Output only the suggestions and nothing else.`
+	segmentReflectionCountryPrompt = `Your task is to carefully read a set of source strings and their translations from {{.sourceLang}} to {{.targetLang}}, and then give constructive criticisms and helpful suggestions to improve the translations.
+The final style and tone of the translations should match the style of {{.targetLang}} colloquially spoken in {{.country}}.
+
+The source strings and initial translations are JSON objects with the same keys, delimited by XML tags <SOURCE_SEGMENTS></SOURCE_SEGMENTS> and <TRANSLATION></TRANSLATION>, as follows:
+{{if .notes}}
+<NOTES>
+{{.notes}}
+</NOTES>
+{{end}}{{if .surroundingText}}
+The segments are taken from a longer document. Surrounding text from that document, delimited by XML tags <CONTEXT></CONTEXT>, is given for reference only. Do not translate it.
+
+<CONTEXT>
+{{.surroundingText}}
+</CONTEXT>
+{{end}}
+<SOURCE_SEGMENTS>
+{{.segments}}
+</SOURCE_SEGMENTS>
+
+<TRANSLATION>
+{{.translation1}}
+</TRANSLATION>
+
+When writing suggestions, pay attention to whether there are ways to improve the translations'
+(i) accuracy (by correcting errors of addition, mistranslation, omission, or untranslated text),
+(ii) fluency (by applying {{.targetLang}} grammar, spelling and punctuation rules, and ensuring there are no unnecessary repetitions),
+(iii) consistency (by ensuring the same term is translated the same way across all strings),
+(iv) placeholders (by ensuring placeholders, markup and ICU message syntax are kept exactly as in the source).
+
+Write a list of specific, helpful and constructive suggestions for improving the translations.
+Each suggestion should name the key it refers to.
+Output only the suggestions and nothing else.`
+
+	segmentImproveTranslationSystemMessage = `You are an expert linguist, specializing in translation editing from {{.sourceLang}} to {{.targetLang}}.`
+	segmentImproveTranslationPrompt        = `Your task is to carefully read, then edit, a set of translations from {{.sourceLang}} to {{.targetLang}}, taking into
+account a list of expert suggestions and constructive criticisms.
+
+The source strings, the initial translations, and the expert linguist suggestions are delimited by XML tags <SOURCE_SEGMENTS></SOURCE_SEGMENTS>, <TRANSLATION></TRANSLATION> and <EXPERT_SUGGESTIONS></EXPERT_SUGGESTIONS>
+as follows:
+{{if .surroundingText}}
+The segments are taken from a longer document. Surrounding text from that document, delimited by XML tags <CONTEXT></CONTEXT>, is given for reference only. Do not translate it.
+
+<CONTEXT>
+{{.surroundingText}}
+</CONTEXT>
+{{end}}
+<SOURCE_SEGMENTS>
+{{.segments}}
+</SOURCE_SEGMENTS>
+
+<TRANSLATION>
+{{.translation1}}
+</TRANSLATION>
+
+<EXPERT_SUGGESTIONS>
+{{.reflection}}
+</EXPERT_SUGGESTIONS>
+
+Please take into account the expert suggestions when editing the translations. Keep placeholders, markup and ICU message syntax exactly as in the source.
+
+Respond with a JSON object with exactly the same keys as the source whose values are the edited {{.targetLang}} translations.
+Do not provide any explanations or text apart from the JSON object.`
+)
+
+// placeholder protection, appended to every prompt when the text contains protected placeholders
+const placeholderInstruction = `
+
+The text contains placeholders written as <ph_1/>, <ph_2/> and so on. They stand for variables or markup and must not be translated.
+Keep every placeholder exactly once in the output, unchanged, at the position where it belongs in the {{.targetLang}} sentence.`
+
+// pivot translation, appended to the reflection prompt of the second leg
+const pivotSourceInstruction = `
+
+The {{.sourceLang}} source text is itself a translation from {{.originalLang}}. The {{.originalLang}} original of the translated part, delimited by XML tags <ORIGINAL_TEXT></ORIGINAL_TEXT>, is as follows:
+
+<ORIGINAL_TEXT>
+{{.originalText}}
+</ORIGINAL_TEXT>
+
+Also check the {{.targetLang}} translation against the original, and suggest how to restore any meaning, nuance or tone the {{.sourceLang}} text lost.`
+
+// glossary and style guide
+const guidanceInstruction = `{{if .glossary}}
+
+The {{.targetLang}} text must translate these terms as given:
+{{range .glossary}}- "{{.Source}}" as "{{.Target}}"
+{{end}}{{end}}{{if .styleGuide}}
+
+The {{.targetLang}} text must follow this style guide:
+<STYLE_GUIDE>
+{{.styleGuide}}
+</STYLE_GUIDE>{{end}}`
+
+// formality, appended to the prompts of every step when the request sets it
+const formalityPrompt = `
+
+{{if .formal}}Use the formal form of address ({{.address}}) and a formal register{{else}}Use the informal form of address ({{.address}}) and an informal register{{end}} consistently throughout the {{.targetLang}} text, whatever form the source text uses.{{if .reflection}}
+Add a suggestion for every place where the translation does not use the {{if .formal}}formal{{else}}informal{{end}} form of address, including verb forms, pronouns and possessives.{{end}}`
+
+// style profile, appended to the reflection and improvement prompts
+const styleProfileInstruction = `{{with .profile}}
+
+The {{$.targetLang}} translation must follow the "{{.Name}}" style profile:
+{{if .Audience}}- Audience: {{.Audience}}
+{{end}}{{if .Tone}}- Tone: {{.Tone}}
+{{end}}{{if .Punctuation}}- Punctuation: {{.Punctuation}}
+{{end}}{{if .Units}}- Units, numbers, dates and times: {{.Units}}
+{{end}}{{if .BannedPhrases}}- Never use these phrasings or their equivalents: {{range $i, $phrase := .BannedPhrases}}{{if $i}}, {{end}}"{{$phrase}}"{{end}}
+{{end}}{{if .Notes}}
+{{.Notes}}
+{{end}}{{end}}{{if .reflection}}
+Add a suggestion for every place where the translation departs from the style profile.{{else}}
+Make sure the new translation follows the style profile.{{end}}`
+
+// language detection, asked when the offline detection is not confident
+const languageDetectionSystemMessage = `You are an expert linguist, specializing in identifying the language of texts.`
+
+const languageDetectionPrompt = `Identify the language of the text delimited by XML tags <TEXT></TEXT>.
+
+<TEXT>
+{{.text}}
+</TEXT>
+
+Respond with a JSON object such as {"code": "fr", "language": "French", "confidence": 0.9}, where code is the ISO 639-1 code of the language (zh-Hans or zh-Hant for Chinese), language its English name and confidence between 0 and 1.
+Use the code "und" when the text has no language, such as numbers or symbols only.
+Do not provide any explanations or text apart from the JSON object.`
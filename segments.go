@@ -0,0 +1,330 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Segment is a short, self-contained string such as a UI label. Many segments are
+// translated together in one prompt instead of one completion per string.
+type Segment struct {
+	ID      string
+	Text    string
+	Context string // optional note for the translator, e.g. the key path or a resource comment
+}
+
+const maxSegmentsPerBatch = 40
+
+// TranslateSegments translates the segments in batches bounded by MaxTokens, running the
+// initial translation, reflection and improvement steps once per batch. Placeholders are
+// protected with PlaceholderPatterns, or DefaultPlaceholderPatterns when none are set.
+// It returns the translations keyed by segment ID. Segments that could not be translated
+// are left out of the result and reported in the returned error. The source language
+// is detected from all the segments when it is AutoDetect.
+func (agent *TranslationAgent) TranslateSegments(ctx context.Context, sourceLang string, targetLang string, segments []Segment, country string) (map[string]string, error) {
+	return agent.translateSegments(ctx, TranslationRequest{SourceLang: sourceLang, TargetLang: targetLang, Country: country}, segments, "")
+}
+
+// translateSegments is TranslateSegments with the settings of req other than its source
+// text, such as its formality and style profile, and surrounding text from the document the segments
+// belong to, which the prompts show as context.
+func (agent *TranslationAgent) translateSegments(ctx context.Context, req TranslationRequest, segments []Segment, surroundingText string) (map[string]string, error) {
+	req, err := agent.applyStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = resolveLanguages(req); err != nil {
+		return nil, err
+	}
+	if IsAutoDetect(req.SourceLang) {
+		texts := make([]string, len(segments))
+		for i, segment := range segments {
+			texts[i] = segment.Text
+		}
+		detection, err := agent.DetectLanguage(ctx, strings.Join(texts, "\n"))
+		if err != nil {
+			return nil, err
+		}
+		req.SourceLang = detection.Language
+	}
+	batches, err := agent.batchSegments(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]string, len(segments))
+	var errs []error
+	for _, batch := range batches {
+		translations, err := agent.translateSegmentBatch(ctx, req, batch, surroundingText)
+		for id, translation := range translations {
+			results[id] = translation
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// batchSegments groups segments so that the source text of each batch stays within MaxTokens.
+func (agent *TranslationAgent) batchSegments(segments []Segment) ([][]Segment, error) {
+	tokenEncoder, err := newTokenEncoder(encodingForModel(agent.ModelName), false)
+	if err != nil {
+		return nil, err
+	}
+	maxTokens := agent.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1000
+	}
+
+	var batches [][]Segment
+	var batch []Segment
+	batchTokens := 0
+	for _, segment := range segments {
+		numTokens := countTokens(tokenEncoder, segment.Text)
+		if len(batch) > 0 && (batchTokens+numTokens > maxTokens || len(batch) >= maxSegmentsPerBatch) {
+			batches = append(batches, batch)
+			batch, batchTokens = nil, 0
+		}
+		batch = append(batch, segment)
+		batchTokens += numTokens
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+func countTokens(tokenEncoder *tiktoken.Tiktoken, s string) int {
+	return len(tokenEncoder.Encode(s, nil, nil))
+}
+
+// translateSegmentBatch runs the three steps on a batch of segments for the resolved
+// languages of req.
+func (agent *TranslationAgent) translateSegmentBatch(ctx context.Context, req TranslationRequest, batch []Segment, surroundingText string) (map[string]string, error) {
+	sourceLang, targetLang, country := req.SourceLang, req.TargetLang, req.Country
+	config := agent.AgentConfig
+	config.DisablePlaceholders = false
+	protector, err := newPlaceholderProtector(config.ActivePlaceholderPatterns())
+	if err != nil {
+		return nil, err
+	}
+	protected := make(map[string]string, len(batch))
+	for _, segment := range batch {
+		protected[segment.ID] = protector.protect(segment.Text)
+	}
+	instruction := ""
+	if protector.active() {
+		instruction, err = renderTemplate(placeholderInstruction, map[string]interface{}{
+			"targetLang": targetLang,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("render placeholder instruction: %v", err)
+		}
+	}
+
+	segmentsJSON, err := marshalSegments(batch, func(s Segment) string { return protected[s.ID] })
+	if err != nil {
+		return nil, err
+	}
+	guidance, err := agent.guidance(targetLang, segmentsJSON)
+	if err != nil {
+		return nil, err
+	}
+	instruction = guidance + instruction
+	notes := segmentNotes(batch)
+	formality, err := formalityInstruction(req, false)
+	if err != nil {
+		return nil, err
+	}
+	reflectionFormality, err := formalityInstruction(req, true)
+	if err != nil {
+		return nil, err
+	}
+	reflectionStyle, err := agent.styleInstruction(req, true)
+	if err != nil {
+		return nil, err
+	}
+	improvementStyle, err := agent.styleInstruction(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// initial translation
+	systemMessage, err := renderTemplate(segmentInitialTranslationSystemMessage, map[string]interface{}{
+		"sourceLang": sourceLang,
+		"targetLang": targetLang,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render initial translation system message: %v", err)
+	}
+	translationPrompt, err := renderTemplate(segmentInitialTranslationPrompt, map[string]interface{}{
+		"sourceLang":      sourceLang,
+		"targetLang":      targetLang,
+		"segments":        segmentsJSON,
+		"notes":           notes,
+		"surroundingText": surroundingText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render initial translation prompt: %v", err)
+	}
+	completion, err := agent.getCompletion(ctx, translationPrompt+formality+instruction, systemMessage)
+	if err != nil {
+		return nil, fmt.Errorf("get initial translation: %v", err)
+	}
+	translation1, err := parseSegmentResponse(completion, batch)
+	if err != nil {
+		return nil, fmt.Errorf("parse initial translation: %v", err)
+	}
+
+	// reflection
+	translation1JSON, err := marshalSegments(batch, func(s Segment) string { return translation1[s.ID] })
+	if err != nil {
+		return nil, err
+	}
+	systemMessage, err = renderTemplate(segmentReflectionSystemMessage, map[string]interface{}{
+		"sourceLang": sourceLang,
+		"targetLang": targetLang,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render reflection system message: %v", err)
+	}
+	reflectionTemplate := segmentReflectionPrompt
+	if country != "" {
+		reflectionTemplate = segmentReflectionCountryPrompt
+	}
+	reflectionPrompt, err := renderTemplate(reflectionTemplate, map[string]interface{}{
+		"sourceLang":      sourceLang,
+		"targetLang":      targetLang,
+		"segments":        segmentsJSON,
+		"notes":           notes,
+		"translation1":    translation1JSON,
+		"country":         country,
+		"surroundingText": surroundingText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render reflection prompt: %v", err)
+	}
+	reflection, err := agent.getCompletion(ctx, reflectionPrompt+reflectionFormality+reflectionStyle+instruction, systemMessage)
+	if err != nil {
+		return nil, fmt.Errorf("get reflection: %v", err)
+	}
+
+	// improvement
+	systemMessage, err = renderTemplate(segmentImproveTranslationSystemMessage, map[string]interface{}{
+		"sourceLang": sourceLang,
+		"targetLang": targetLang,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render improve translation system message: %v", err)
+	}
+	improvementPrompt, err := renderTemplate(segmentImproveTranslationPrompt, map[string]interface{}{
+		"sourceLang":      sourceLang,
+		"targetLang":      targetLang,
+		"segments":        segmentsJSON,
+		"translation1":    translation1JSON,
+		"reflection":      reflection,
+		"surroundingText": surroundingText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render improve translation prompt: %v", err)
+	}
+	completion, err = agent.getCompletion(ctx, improvementPrompt+formality+improvementStyle+instruction, systemMessage)
+	if err != nil {
+		return nil, fmt.Errorf("get improved translation: %v", err)
+	}
+	translation2, err := parseSegmentResponse(completion, nil)
+	if err != nil {
+		// The draft is still usable when the edited version cannot be parsed.
+		translation2 = map[string]string{}
+	}
+
+	results := make(map[string]string, len(batch))
+	var failed []string
+	for _, segment := range batch {
+		source := protected[segment.ID]
+		switch {
+		case translation2[segment.ID] != "" && protector.verify(source, translation2[segment.ID]) == nil:
+			results[segment.ID] = protector.restore(translation2[segment.ID])
+		case translation1[segment.ID] != "" && protector.verify(source, translation1[segment.ID]) == nil:
+			results[segment.ID] = protector.restore(translation1[segment.ID])
+		default:
+			failed = append(failed, segment.ID)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("no usable translation for %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// marshalSegments renders the segments as an indented JSON object, keeping their order.
+func marshalSegments(segments []Segment, value func(Segment) string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for i, segment := range segments {
+		key, err := json.Marshal(segment.ID)
+		if err != nil {
+			return "", err
+		}
+		val, err := json.Marshal(value(segment))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString("  ")
+		sb.Write(key)
+		sb.WriteString(": ")
+		sb.Write(val)
+		if i < len(segments)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}")
+	return sb.String(), nil
+}
+
+func segmentNotes(segments []Segment) string {
+	var lines []string
+	for _, segment := range segments {
+		if segment.Context != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", segment.ID, segment.Context))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSegmentResponse extracts the JSON object from a completion. When want is not nil,
+// every segment in it must be present in the response.
+func parseSegmentResponse(completion string, want []Segment) (map[string]string, error) {
+	start := strings.Index(completion, "{")
+	end := strings.LastIndex(completion, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in response")
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(completion[start:end+1]), &raw); err != nil {
+		return nil, err
+	}
+	translations := make(map[string]string, len(raw))
+	for id, value := range raw {
+		if s, ok := value.(string); ok {
+			translations[id] = s
+		}
+	}
+	var missing []string
+	for _, segment := range want {
+		if _, ok := translations[segment.ID]; !ok {
+			missing = append(missing, segment.ID)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing keys %s", strings.Join(missing, ", "))
+	}
+	return translations, nil
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// chatModelPrefix starts the pseudo-models of /v1/chat/completions, such as
+// "translate:zh-en@US" for Chinese to English as written in the United States.
+const chatModelPrefix = "translate:"
+
+// chatRequest is the body of POST /v1/chat/completions. Other fields of the OpenAI API
+// are accepted and ignored.
+type chatRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content chatContent `json:"content"`
+}
+
+// chatContent is the content of a message, a string or an array of parts of which the text
+// parts are joined.
+type chatContent string
+
+func (c *chatContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = chatContent(s)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = chatContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type chatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int        `json:"index"`
+	Message      *chatDelta `json:"message,omitempty"`
+	Delta        *chatDelta `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// chatResponse is a chat.completion or, when streaming, a chat.completion.chunk.
+type chatResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+// registerChat mounts the chat completions endpoint of the OpenAI API, which runs the
+// translation pipeline on the last user message:
+//
+//	POST /v1/chat/completions   translate with a model such as "translate:zh-en@US"
+func (s *Server) registerChat() {
+	s.mux.Handle("POST /v1/chat/completions", s.authenticateWith(http.HandlerFunc(s.handleChat), func(w http.ResponseWriter) {
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "Incorrect API key provided.")
+	}))
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var chat chatRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)).Decode(&chat)
+	if err != nil {
+		err = bodyError(err, s.config.MaxRequestBytes)
+		writeOpenAIError(w, errorStatus(err), "invalid_request_error", err.Error())
+		return
+	}
+	req, err := chatTranslationRequest(chat)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	response := chatResponse{
+		ID:      "chatcmpl-" + chatID(),
+		Created: time.Now().Unix(),
+		Model:   chat.Model,
+	}
+	if chat.Stream {
+		s.streamChat(w, r, req, response, chat.StreamOptions != nil && chat.StreamOptions.IncludeUsage)
+		return
+	}
+
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	result, err := agent.Execute(r.Context(), req)
+	if err != nil {
+		writeOpenAIError(w, detectionStatus(err), "api_error", err.Error())
+		return
+	}
+	stop := "stop"
+	response.Object = "chat.completion"
+	response.Choices = []chatChoice{{
+		Message:      &chatDelta{Role: "assistant", Content: result.Translation},
+		FinishReason: &stop,
+	}}
+	response.Usage = newChatUsage(agent.Usage())
+	writeJSON(w, http.StatusOK, response)
+}
+
+// streamChat sends the translation as chat.completion.chunk events: the assistant role
+// right away, then the final translation once the pipeline is done, as the chunks of a
+// long text are only joined at the end.
+func (s *Server) streamChat(w http.ResponseWriter, r *http.Request, req ta.TranslationRequest, response chatResponse, includeUsage bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "api_error", "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	response.Object = "chat.completion.chunk"
+	send := func(choices []chatChoice, usage *chatUsage) error {
+		response.Choices, response.Usage = choices, usage
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if send([]chatChoice{{Delta: &chatDelta{Role: "assistant"}}}, nil) != nil {
+		return
+	}
+
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	for event := range agent.ExecuteStream(r.Context(), req) {
+		switch event.Type {
+		case ta.EventError:
+			data, _ := json.Marshal(openAIError("api_error", event.Error))
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			return
+		case ta.EventDone:
+			stop := "stop"
+			if send([]chatChoice{{Delta: &chatDelta{Content: event.Result.Translation}}}, nil) != nil ||
+				send([]chatChoice{{Delta: &chatDelta{}, FinishReason: &stop}}, nil) != nil {
+				return
+			}
+			if includeUsage && send([]chatChoice{}, newChatUsage(agent.Usage())) != nil {
+				return
+			}
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// chatTranslationRequest returns the translation of the last user message with the
+// languages of the model.
+func chatTranslationRequest(chat chatRequest) (ta.TranslationRequest, error) {
+	var req ta.TranslationRequest
+	source, target, country, err := parseChatModel(chat.Model)
+	if err != nil {
+		return req, err
+	}
+	for i := len(chat.Messages) - 1; i >= 0; i-- {
+		if chat.Messages[i].Role == "user" {
+			req.SourceText = string(chat.Messages[i].Content)
+			break
+		}
+	}
+	if strings.TrimSpace(req.SourceText) == "" {
+		return req, errors.New("no user message to translate")
+	}
+	req.SourceLang, req.TargetLang = source.Name, target.Name
+	req.Country = target.Country
+	if country != "" {
+		req.Country = country
+	}
+	return req, nil
+}
+
+// parseChatModel parses a model "translate:<source>-<target>[@<country>]". The languages
+// are codes such as zh, en or pt-BR, the source may be auto to detect it, and the country
+// a region code such as US or a name.
+func parseChatModel(model string) (source, target language, country string, err error) {
+	spec, ok := strings.CutPrefix(model, chatModelPrefix)
+	if !ok {
+		return source, target, "", fmt.Errorf("the model `%s` does not exist, use a model such as `translate:zh-en@US`", model)
+	}
+	spec, country, _ = strings.Cut(spec, "@")
+	// Try every dash, as the codes may have regions of their own, as in pt-BR-en.
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '-' {
+			continue
+		}
+		s, sourceOK := language{Name: ta.AutoDetect}, spec[:i] == "auto"
+		if !sourceOK {
+			s, sourceOK = lookupLanguage(spec[:i])
+		}
+		t, targetOK := lookupLanguage(spec[i+1:])
+		if sourceOK && targetOK {
+			return s, t, ta.RegionName(country), nil
+		}
+	}
+	return source, target, "", fmt.Errorf("the model `%s` has unknown languages, use a model such as `translate:zh-en@US`", model)
+}
+
+func chatID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newChatUsage(usage ta.Usage) *chatUsage {
+	return &chatUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens(),
+	}
+}
+
+func openAIError(kind string, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": kind, "param": nil, "code": nil},
+	}
+}
+
+// writeOpenAIError writes an error response of the OpenAI API.
+func writeOpenAIError(w http.ResponseWriter, status int, kind string, message string) {
+	writeJSON(w, status, openAIError(kind, message))
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+func TestParseChatModel(t *testing.T) {
+	tests := []struct {
+		model   string
+		source  language
+		target  language
+		country string
+	}{
+		{"translate:zh-en@US", language{Name: "Simplified Chinese"}, language{Name: "English"}, "United States"},
+		{"translate:pt-BR-en@US", language{Name: "Portuguese", Country: "Brazil"}, language{Name: "English"}, "United States"},
+		{"translate:en-pt-BR", language{Name: "English"}, language{Name: "Portuguese", Country: "Brazil"}, ""},
+		{"translate:auto-de@Austria", language{Name: ta.AutoDetect}, language{Name: "German"}, "Austria"},
+		{"translate:zh-Hant-en", language{Name: "Traditional Chinese"}, language{Name: "English"}, ""},
+	}
+	for _, tt := range tests {
+		source, target, country, err := parseChatModel(tt.model)
+		if err != nil {
+			t.Errorf("parseChatModel(%q): %v", tt.model, err)
+			continue
+		}
+		if source != tt.source || target != tt.target || country != tt.country {
+			t.Errorf("parseChatModel(%q) = %+v, %+v, %q, want %+v, %+v, %q", tt.model, source, target, country, tt.source, tt.target, tt.country)
+		}
+	}
+
+	for _, model := range []string{"gpt-4o", "translate:en", "translate:en-tlh", "translate:auto-auto"} {
+		if _, _, _, err := parseChatModel(model); err == nil {
+			t.Errorf("parseChatModel(%q) did not fail", model)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	s, model := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	body := `{"model": "translate:en-pt@BR", "messages": [
+		{"role": "system", "content": "You are a translator."},
+		{"role": "user", "content": "Goodbye"},
+		{"role": "user", "content": [{"type": "text", "text": "Hello"}, {"type": "image_url"}, {"type": "text", "text": "world"}]}
+	]}`
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	var response chatResponse
+	if status := serve(t, s, r, &response); status != http.StatusOK {
+		t.Fatalf("POST /v1/chat/completions = %d", status)
+	}
+	if response.Object != "chat.completion" || response.Model != "translate:en-pt@BR" || !strings.HasPrefix(response.ID, "chatcmpl-") {
+		t.Errorf("POST /v1/chat/completions = %+v", response)
+	}
+	if len(response.Choices) != 1 || response.Choices[0].Message == nil || response.Choices[0].Message.Content != "Hallo\nWelt" {
+		t.Fatalf("POST /v1/chat/completions choices = %+v, want the translation of the last user message", response.Choices)
+	}
+	if reason := response.Choices[0].FinishReason; reason == nil || *reason != "stop" {
+		t.Errorf("finish reason = %v, want stop", reason)
+	}
+	if response.Usage == nil || response.Usage.TotalTokens != response.Usage.PromptTokens+response.Usage.CompletionTokens || response.Usage.TotalTokens == 0 {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+	if !model.Asked("Portuguese colloquially spoken in Brazil") {
+		t.Error("the model was not asked for Portuguese as written in Brazil")
+	}
+}
+
+func TestChatErrors(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name    string
+		key     string
+		body    string
+		status  int
+		message string
+	}{
+		{"key", "wrong", `{"model": "translate:en-de", "messages": [{"role": "user", "content": "Hello"}]}`, http.StatusUnauthorized, "Incorrect API key provided."},
+		{"model", "secret", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hello"}]}`, http.StatusBadRequest, "does not exist"},
+		{"message", "secret", `{"model": "translate:en-de", "messages": [{"role": "system", "content": "Hello"}]}`, http.StatusBadRequest, "no user message to translate"},
+		{"content", "secret", `{"model": "translate:en-de", "messages": [{"role": "user", "content": 1}]}`, http.StatusBadRequest, "content must be a string or an array of parts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+			var response struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if status := serve(t, s, r, &response); status != tt.status || !strings.Contains(response.Error.Message, tt.message) {
+				t.Errorf("POST /v1/chat/completions = %d %q, want %d and a message containing %q", status, response.Error.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// language is a language of the LibreTranslate and Google Translate APIs, with the name
+// given to the agent.
+type language struct {
+	Name    string
+	Country string
+}
+
+// languageCodes are the ISO 639-1 codes listed by the LibreTranslate and Google Translate
+// APIs. Their BCP 47 tags with a script or region, such as zh-Hant or pt-BR, are
+// accepted too.
+var languageCodes = []string{
+	"ar", "bg", "cs", "da", "de", "el", "en", "es", "et", "fa", "fi", "fr", "he", "hi", "hu",
+	"id", "it", "ja", "ko", "lt", "lv", "nb", "nl", "no", "pl", "pt", "ro", "ru", "sk", "sl",
+	"sv", "th", "tr", "uk", "vi", "zh",
+}
+
+// languageAliases are the LibreTranslate codes that are not BCP 47 tags.
+var languageAliases = map[string]string{
+	"pb": "pt-BR",
+	"zt": "zh-Hant",
+}
+
+// lookupLanguage returns the language of a code of one of languageCodes, ignoring case and
+// accepting _ for -.
+func lookupLanguage(code string) (language, bool) {
+	if alias, ok := languageAliases[strings.ToLower(code)]; ok {
+		code = alias
+	}
+	l, err := ta.ParseLanguage(code)
+	if err != nil {
+		return language{}, false
+	}
+	base, _ := l.Tag.Base()
+	if i := sort.SearchStrings(languageCodes, base.String()); i == len(languageCodes) || languageCodes[i] != base.String() {
+		return language{}, false
+	}
+	return language{Name: l.Name, Country: l.Country}, true
+}
+
+// stringList is a JSON string or array of strings.
+type stringList struct {
+	texts []string
+	// array reports whether the JSON value was an array.
+	array bool
+}
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{texts: []string{s}}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = stringList{texts: list, array: true}
+	return nil
+}
+
+// requestError is an invalid request, answered with status in the error format of an API.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// errorStatus returns the status of a requestError, and 400 for other errors.
+func errorStatus(err error) int {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status
+	}
+	return http.StatusBadRequest
+}
+
+// detectionStatus returns the status of a failed language detection: 400 for a text
+// without a language, and 502 when the model failed.
+func detectionStatus(err error) int {
+	if errors.Is(err, ta.ErrLanguageNotDetected) {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+// decodeParams reads the parameters of a request of the DeepL, LibreTranslate and Google
+// APIs. A JSON body is decoded into v and nil is returned; the query and form parameters
+// of other requests are returned.
+func (s *Server) decodeParams(w http.ResponseWriter, r *http.Request, v interface{}) (url.Values, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+	if r.Method == http.MethodPost && !isForm(r) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			return nil, bodyError(err, s.config.MaxRequestBytes)
+		}
+		return nil, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, bodyError(err, s.config.MaxRequestBytes)
+	}
+	return r.Form, nil
+}
+
+func bodyError(err error, limit int64) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request size exceeds the limit of %d bytes", limit)}
+	}
+	return &requestError{http.StatusBadRequest, "Invalid request body: " + err.Error()}
+}
+
+func isForm(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+func TestLookupLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want language
+		ok   bool
+	}{
+		{"de", language{Name: "German"}, true},
+		{"PT_br", language{Name: "Portuguese", Country: "Brazil"}, true},
+		{"pb", language{Name: "Portuguese", Country: "Brazil"}, true},
+		{"zt", language{Name: "Traditional Chinese"}, true},
+		{"zh-TW", language{Name: "Traditional Chinese", Country: "Taiwan"}, true},
+		{"sw", language{}, false},
+		{"xx", language{}, false},
+	}
+	for _, tt := range tests {
+		if got, ok := lookupLanguage(tt.code); got != tt.want || ok != tt.ok {
+			t.Errorf("lookupLanguage(%q) = %+v, %v, want %+v, %v", tt.code, got, ok, tt.want, tt.ok)
+		}
+	}
+}
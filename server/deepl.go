@@ -0,0 +1,282 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// deeplLanguage is a language of the DeepL API.
+type deeplLanguage struct {
+	Name string
+	// Country is the region of a regional variant such as EN-GB.
+	Country string
+	// Formality reports whether the language has formal and informal forms of address.
+	Formality bool
+	// TargetOnly marks regional variants, which DeepL only accepts as target languages.
+	TargetOnly bool
+}
+
+// deeplLanguages are the languages of the DeepL API by their code.
+var deeplLanguages = map[string]deeplLanguage{
+	"AR":      {Name: "Arabic"},
+	"BG":      {Name: "Bulgarian"},
+	"CS":      {Name: "Czech"},
+	"DA":      {Name: "Danish"},
+	"DE":      {Name: "German", Formality: true},
+	"EL":      {Name: "Greek"},
+	"EN":      {Name: "English"},
+	"EN-GB":   {Name: "English", Country: "United Kingdom", TargetOnly: true},
+	"EN-US":   {Name: "English", Country: "United States", TargetOnly: true},
+	"ES":      {Name: "Spanish", Formality: true},
+	"ET":      {Name: "Estonian"},
+	"FI":      {Name: "Finnish"},
+	"FR":      {Name: "French", Formality: true},
+	"HU":      {Name: "Hungarian"},
+	"ID":      {Name: "Indonesian"},
+	"IT":      {Name: "Italian", Formality: true},
+	"JA":      {Name: "Japanese", Formality: true},
+	"KO":      {Name: "Korean", Formality: true},
+	"LT":      {Name: "Lithuanian"},
+	"LV":      {Name: "Latvian"},
+	"NB":      {Name: "Norwegian Bokmål"},
+	"NL":      {Name: "Dutch", Formality: true},
+	"PL":      {Name: "Polish", Formality: true},
+	"PT":      {Name: "Portuguese", Formality: true},
+	"PT-BR":   {Name: "Portuguese", Country: "Brazil", Formality: true, TargetOnly: true},
+	"PT-PT":   {Name: "Portuguese", Country: "Portugal", Formality: true, TargetOnly: true},
+	"RO":      {Name: "Romanian"},
+	"RU":      {Name: "Russian", Formality: true},
+	"SK":      {Name: "Slovak"},
+	"SL":      {Name: "Slovenian"},
+	"SV":      {Name: "Swedish"},
+	"TR":      {Name: "Turkish"},
+	"UK":      {Name: "Ukrainian"},
+	"ZH":      {Name: "Chinese"},
+	"ZH-HANS": {Name: "Simplified Chinese", TargetOnly: true},
+	"ZH-HANT": {Name: "Traditional Chinese", TargetOnly: true},
+}
+
+// deeplRequest is the body of POST /v2/translate, sent as a form or as JSON.
+type deeplRequest struct {
+	Text        []string `json:"text"`
+	SourceLang  string   `json:"source_lang"`
+	TargetLang  string   `json:"target_lang"`
+	Formality   string   `json:"formality"`
+	GlossaryID  string   `json:"glossary_id"`
+	TagHandling string   `json:"tag_handling"`
+}
+
+type deeplTranslation struct {
+	DetectedSourceLanguage string `json:"detected_source_language"`
+	Text                   string `json:"text"`
+}
+
+// registerDeepL mounts the endpoints of the DeepL API, so that DeepL clients can use the
+// server by changing their base URL:
+//
+//	POST /v2/translate   translate texts
+//	GET  /v2/languages   list the source or target languages
+//
+// They accept the API keys as "Authorization: DeepL-Auth-Key <key>" too.
+func (s *Server) registerDeepL() {
+	s.mux.Handle("POST /v2/translate", s.authenticateDeepL(http.HandlerFunc(s.handleDeepLTranslate)))
+	s.mux.Handle("GET /v2/translate", s.authenticateDeepL(http.HandlerFunc(s.handleDeepLTranslate)))
+	s.mux.Handle("GET /v2/languages", s.authenticateDeepL(http.HandlerFunc(s.handleDeepLLanguages)))
+	s.mux.Handle("POST /v2/languages", s.authenticateDeepL(http.HandlerFunc(s.handleDeepLLanguages)))
+}
+
+// authenticateDeepL rejects requests without one of the API keys like DeepL does, and also
+// accepts the legacy auth_key parameter.
+func (s *Server) authenticateDeepL(next http.Handler) http.Handler {
+	if len(s.config.APIKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestKey(r)
+		if key == "" {
+			key = r.URL.Query().Get("auth_key")
+		}
+		if key == "" && r.Method == http.MethodPost && isForm(r) {
+			r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+			if err := r.ParseForm(); err == nil {
+				key = r.PostForm.Get("auth_key")
+			}
+		}
+		if !s.validKey(key) {
+			writeDeepLError(w, http.StatusForbidden, "Authorization failure, check auth_key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleDeepLTranslate(w http.ResponseWriter, r *http.Request) {
+	req, err := s.decodeDeepLRequest(w, r)
+	if err == nil {
+		err = validateDeepLRequest(req)
+	}
+	var config ta.AgentConfig
+	if err == nil {
+		config, err = s.deeplAgentConfig(req)
+	}
+	if err != nil {
+		writeDeepLError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	source := strings.ToUpper(req.SourceLang)
+	sourceLang := ta.AutoDetect
+	if source != "" {
+		sourceLang = deeplLanguages[source].Name
+	}
+	target := deeplLanguages[strings.ToUpper(req.TargetLang)]
+	results, err := s.translateTexts(r.Context(), config, req.Text, ta.TranslationRequest{
+		SourceLang: sourceLang,
+		TargetLang: target.Name,
+		Country:    target.Country,
+		Formality:  ta.Formality(req.Formality),
+	})
+	if err != nil {
+		writeDeepLError(w, detectionStatus(err), err.Error())
+		return
+	}
+	translations := make([]deeplTranslation, len(results))
+	for i, result := range results {
+		translations[i] = deeplTranslation{DetectedSourceLanguage: source, Text: result.Translation}
+		if source == "" {
+			translations[i].DetectedSourceLanguage = deeplSourceCode(result.DetectedSourceLang)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]deeplTranslation{"translations": translations})
+}
+
+// decodeDeepLRequest reads a translation request from a form, the query or a JSON body.
+func (s *Server) decodeDeepLRequest(w http.ResponseWriter, r *http.Request) (deeplRequest, error) {
+	var req deeplRequest
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil || params == nil {
+		return req, err
+	}
+	req.Text = params["text"]
+	req.SourceLang = params.Get("source_lang")
+	req.TargetLang = params.Get("target_lang")
+	req.Formality = params.Get("formality")
+	req.GlossaryID = params.Get("glossary_id")
+	req.TagHandling = params.Get("tag_handling")
+	return req, nil
+}
+
+func validateDeepLRequest(req deeplRequest) error {
+	if len(req.Text) == 0 {
+		return errors.New(`Parameter "text" not specified.`)
+	}
+	if req.TargetLang == "" {
+		return errors.New(`Parameter "target_lang" not specified.`)
+	}
+	target, ok := deeplLanguages[strings.ToUpper(req.TargetLang)]
+	if !ok {
+		return errors.New(`Value for "target_lang" not supported.`)
+	}
+	if source, ok := deeplLanguages[strings.ToUpper(req.SourceLang)]; req.SourceLang != "" && (!ok || source.TargetOnly) {
+		return errors.New(`Value for "source_lang" not supported.`)
+	}
+	switch req.Formality {
+	case "", "default", "prefer_more", "prefer_less":
+	case "more", "less":
+		if !target.Formality {
+			return errors.New(`"formality" is not supported for the given "target_lang".`)
+		}
+	default:
+		return errors.New(`Value for "formality" not supported.`)
+	}
+	switch req.TagHandling {
+	case "", "xml", "html":
+	default:
+		return errors.New(`Value for "tag_handling" not supported.`)
+	}
+	return nil
+}
+
+// deeplAgentConfig returns the agent configuration of a request: the glossary it selects
+// and markup protection for tag handling.
+func (s *Server) deeplAgentConfig(req deeplRequest) (ta.AgentConfig, error) {
+	config := s.config.Agent
+	if req.GlossaryID != "" {
+		glossary, ok := s.config.Glossaries[req.GlossaryID]
+		if !ok {
+			return config, &requestError{http.StatusNotFound, "Glossary not found"}
+		}
+		config.Glossary = append(append(ta.Glossary{}, config.Glossary...), glossary...)
+	}
+	if req.TagHandling != "" {
+		config = withMarkup(config)
+	}
+	return config, nil
+}
+
+type deeplLanguageInfo struct {
+	Language          string `json:"language"`
+	Name              string `json:"name"`
+	SupportsFormality *bool  `json:"supports_formality,omitempty"`
+}
+
+func (s *Server) handleDeepLLanguages(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+	r.ParseForm()
+	kind := r.Form.Get("type")
+	if kind != "" && kind != "source" && kind != "target" {
+		writeDeepLError(w, http.StatusBadRequest, `Value for "type" not supported.`)
+		return
+	}
+	target := kind == "target"
+	languages := []deeplLanguageInfo{}
+	for code, language := range deeplLanguages {
+		if language.TargetOnly && !target || !language.TargetOnly && target && hasVariants(code) {
+			continue
+		}
+		info := deeplLanguageInfo{Language: code, Name: languageName(language)}
+		if target {
+			formality := language.Formality
+			info.SupportsFormality = &formality
+		}
+		languages = append(languages, info)
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i].Language < languages[j].Language })
+	writeJSON(w, http.StatusOK, languages)
+}
+
+// hasVariants reports whether a language is only a target language through its regional
+// variants, as EN is through EN-GB and EN-US.
+func hasVariants(code string) bool {
+	return code == "EN" || code == "PT"
+}
+
+// deeplSourceCode returns the DeepL source language code of a detected language, such as
+// ZH for zh-Hant.
+func deeplSourceCode(detection *ta.Detection) string {
+	if detection == nil {
+		return ""
+	}
+	code := strings.ToUpper(detection.Code)
+	if language, ok := deeplLanguages[code]; ok && !language.TargetOnly {
+		return code
+	}
+	base, _, _ := strings.Cut(code, "-")
+	return base
+}
+
+func languageName(language deeplLanguage) string {
+	if language.Country != "" {
+		return fmt.Sprintf("%s (%s)", language.Name, language.Country)
+	}
+	return language.Name
+}
+
+func writeDeepLError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeepLTranslate(t *testing.T) {
+	s, model := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	form := url.Values{"text": {"Hello", "world", " "}, "source_lang": {"EN"}, "target_lang": {"PT-BR"}}
+	r := httptest.NewRequest("POST", "/v2/translate", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "DeepL-Auth-Key secret")
+	var response struct {
+		Translations []deeplTranslation `json:"translations"`
+	}
+	if status := serve(t, s, r, &response); status != http.StatusOK {
+		t.Fatalf("POST /v2/translate = %d", status)
+	}
+	want := []deeplTranslation{{"EN", "Hallo"}, {"EN", "Welt"}, {"EN", " "}}
+	if !reflect.DeepEqual(response.Translations, want) {
+		t.Errorf("POST /v2/translate = %+v, want %+v", response.Translations, want)
+	}
+	if !model.Asked("Portuguese colloquially spoken in Brazil") {
+		t.Errorf("the model was not asked for Brazilian Portuguese: %q", model.Prompts())
+	}
+}
+
+func TestDeepLTranslateErrors(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name    string
+		body    string
+		key     string
+		status  int
+		message string
+	}{
+		{"key", `{"text": ["Hello"], "target_lang": "DE"}`, "wrong", http.StatusForbidden, "Authorization failure"},
+		{"text", `{"target_lang": "DE"}`, "secret", http.StatusBadRequest, `"text" not specified`},
+		{"target", `{"text": ["Hello"], "target_lang": "XX"}`, "secret", http.StatusBadRequest, `"target_lang" not supported`},
+		{"regional source", `{"text": ["Hello"], "source_lang": "EN-GB", "target_lang": "DE"}`, "secret", http.StatusBadRequest, `"source_lang" not supported`},
+		{"formality", `{"text": ["Hello"], "target_lang": "EN-US", "formality": "more"}`, "secret", http.StatusBadRequest, `"formality" is not supported`},
+		{"glossary", `{"text": ["Hello"], "target_lang": "DE", "glossary_id": "missing"}`, "secret", http.StatusNotFound, "Glossary not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v2/translate", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "DeepL-Auth-Key "+tt.key)
+			var response struct {
+				Message string `json:"message"`
+			}
+			if status := serve(t, s, r, &response); status != tt.status || !strings.Contains(response.Message, tt.message) {
+				t.Errorf("POST /v2/translate = %d %q, want %d and a message containing %q", status, response.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestDeepLLanguages(t *testing.T) {
+	s, _ := newTestServer(t, Config{})
+	var languages []deeplLanguageInfo
+	if status := serve(t, s, httptest.NewRequest("GET", "/v2/languages?type=target", nil), &languages); status != http.StatusOK {
+		t.Fatalf("GET /v2/languages = %d", status)
+	}
+	codes := map[string]bool{}
+	for _, l := range languages {
+		codes[l.Language] = l.SupportsFormality != nil && *l.SupportsFormality
+	}
+	if _, ok := codes["EN"]; ok || !codes["PT-BR"] || codes["EN-GB"] {
+		t.Errorf("GET /v2/languages?type=target = %+v, want the regional variants of EN and PT and formality for PT-BR only", languages)
+	}
+}
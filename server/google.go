@@ -0,0 +1,228 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// googleRequest is the body of a Google Cloud Translation v2 request, sent as query or
+// form parameters or as JSON.
+type googleRequest struct {
+	Q      stringList `json:"q"`
+	Source string     `json:"source"`
+	Target string     `json:"target"`
+	Format string     `json:"format"`
+	// Model is accepted for compatibility and ignored.
+	Model string `json:"model"`
+}
+
+type googleTranslation struct {
+	TranslatedText         string `json:"translatedText"`
+	DetectedSourceLanguage string `json:"detectedSourceLanguage,omitempty"`
+}
+
+type googleDetection struct {
+	Language   string  `json:"language"`
+	IsReliable bool    `json:"isReliable"`
+	Confidence float64 `json:"confidence"`
+}
+
+type googleLanguage struct {
+	Language string `json:"language"`
+	Name     string `json:"name,omitempty"`
+}
+
+// registerGoogle mounts the endpoints of the Google Cloud Translation v2 API:
+//
+//	POST /language/translate/v2             translate texts
+//	POST /language/translate/v2/detect      detect the language of texts
+//	GET  /language/translate/v2/languages   list the languages
+//
+// They accept the API keys as the key parameter or in the X-Goog-Api-Key header too.
+func (s *Server) registerGoogle() {
+	s.mux.Handle("GET /language/translate/v2", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleTranslate)))
+	s.mux.Handle("POST /language/translate/v2", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleTranslate)))
+	s.mux.Handle("GET /language/translate/v2/detect", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleDetect)))
+	s.mux.Handle("POST /language/translate/v2/detect", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleDetect)))
+	s.mux.Handle("GET /language/translate/v2/languages", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleLanguages)))
+	s.mux.Handle("POST /language/translate/v2/languages", s.authenticateGoogle(http.HandlerFunc(s.handleGoogleLanguages)))
+}
+
+func (s *Server) authenticateGoogle(next http.Handler) http.Handler {
+	return s.authenticateWith(next, func(w http.ResponseWriter) {
+		writeGoogleError(w, http.StatusForbidden, "forbidden", "The request is missing a valid API key.")
+	}, func(r *http.Request) string {
+		return firstKey(r.Header.Get("X-Goog-Api-Key"), r.URL.Query().Get("key"))
+	})
+}
+
+func (s *Server) handleGoogleTranslate(w http.ResponseWriter, r *http.Request) {
+	req, err := s.decodeGoogleRequest(w, r)
+	if err != nil {
+		writeGoogleError(w, errorStatus(err), "invalid", err.Error())
+		return
+	}
+	source, target, err := validateGoogleRequest(req)
+	if err != nil {
+		writeGoogleError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	// Google treats texts as HTML unless the format is text.
+	config := s.config.Agent
+	if req.Format != "text" {
+		config = withMarkup(config)
+	}
+	results, err := s.translateTexts(r.Context(), config, req.Q.texts, ta.TranslationRequest{
+		SourceLang: source.Name,
+		TargetLang: target.Name,
+		Country:    target.Country,
+	})
+	if err != nil {
+		writeGoogleError(w, detectionStatus(err), "backendError", err.Error())
+		return
+	}
+	translations := make([]googleTranslation, len(results))
+	for i, result := range results {
+		translations[i].TranslatedText = result.Translation
+		if result.DetectedSourceLang != nil {
+			translations[i].DetectedSourceLanguage = googleCode(*result.DetectedSourceLang)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string][]googleTranslation{"translations": translations},
+	})
+}
+
+func (s *Server) decodeGoogleRequest(w http.ResponseWriter, r *http.Request) (googleRequest, error) {
+	var req googleRequest
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil || params == nil {
+		return req, err
+	}
+	req.Q.texts = params["q"]
+	req.Source = params.Get("source")
+	req.Target = params.Get("target")
+	req.Format = params.Get("format")
+	req.Model = params.Get("model")
+	return req, nil
+}
+
+func validateGoogleRequest(req googleRequest) (source, target language, err error) {
+	switch {
+	case len(req.Q.texts) == 0:
+		return source, target, errors.New("Required Text")
+	case req.Target == "":
+		return source, target, errors.New("Required Target language")
+	case req.Format != "" && req.Format != "text" && req.Format != "html":
+		return source, target, errors.New("Invalid Value for format")
+	}
+	source, ok := language{Name: ta.AutoDetect}, true
+	if req.Source != "" {
+		source, ok = lookupLanguage(req.Source)
+	}
+	if !ok {
+		return source, target, errors.New("Bad language pair: " + req.Source + "|" + req.Target)
+	}
+	target, ok = lookupLanguage(req.Target)
+	if !ok {
+		return source, target, errors.New("Bad language pair: " + req.Source + "|" + req.Target)
+	}
+	return source, target, nil
+}
+
+// handleGoogleDetect detects the language of each text, reporting one detection per text.
+func (s *Server) handleGoogleDetect(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Q stringList `json:"q"`
+	}
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil {
+		writeGoogleError(w, errorStatus(err), "invalid", err.Error())
+		return
+	}
+	if params != nil {
+		req.Q.texts = params["q"]
+	}
+	if len(req.Q.texts) == 0 {
+		writeGoogleError(w, http.StatusBadRequest, "invalid", "Required Text")
+		return
+	}
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	detections := make([][]googleDetection, len(req.Q.texts))
+	for i, text := range req.Q.texts {
+		detection, err := agent.DetectLanguage(r.Context(), text)
+		if errors.Is(err, ta.ErrLanguageNotDetected) {
+			detections[i] = []googleDetection{{Language: "und"}}
+			continue
+		}
+		if err != nil {
+			writeGoogleError(w, http.StatusBadGateway, "backendError", err.Error())
+			return
+		}
+		detections[i] = []googleDetection{{
+			Language:   googleCode(detection),
+			IsReliable: detection.Confidence >= 0.9,
+			Confidence: detection.Confidence,
+		}}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string][][]googleDetection{"detections": detections},
+	})
+}
+
+// googleCode returns the Google code of a detected language, which names the Chinese
+// scripts zh-CN and zh-TW.
+func googleCode(detection ta.Detection) string {
+	switch strings.ToLower(detection.Code) {
+	case "zh-hans":
+		return "zh-CN"
+	case "zh-hant":
+		return "zh-TW"
+	}
+	return detection.Code
+}
+
+// handleGoogleLanguages lists the language codes, with their English names when a target
+// language is given.
+func (s *Server) handleGoogleLanguages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+		Model  string `json:"model"`
+	}
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil {
+		writeGoogleError(w, errorStatus(err), "invalid", err.Error())
+		return
+	}
+	if params != nil {
+		req.Target = params.Get("target")
+	}
+	var languages []googleLanguage
+	for _, code := range languageCodes {
+		language := googleLanguage{Language: code}
+		if req.Target != "" {
+			l, _ := lookupLanguage(code)
+			language.Name = l.Name
+		}
+		languages = append(languages, language)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string][]googleLanguage{"languages": languages},
+	})
+}
+
+// writeGoogleError writes an error response of the Google APIs.
+func writeGoogleError(w http.ResponseWriter, status int, reason string, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors": []map[string]string{
+				{"message": message, "domain": "global", "reason": reason},
+			},
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoogleTranslate(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name string
+		r    *http.Request
+		want []googleTranslation
+	}{
+		{
+			name: "query",
+			r:    httptest.NewRequest("GET", "/language/translate/v2?key=secret&q=Hello&q=world&source=en&target=de&format=text", nil),
+			want: []googleTranslation{{TranslatedText: "Hallo"}, {TranslatedText: "Welt"}},
+		},
+		{
+			// Texts are HTML unless the format is text.
+			name: "json",
+			r:    httptest.NewRequest("POST", "/language/translate/v2", strings.NewReader(`{"q": "<i>Hello</i>", "source": "en", "target": "zh-TW"}`)),
+			want: []googleTranslation{{TranslatedText: "<i>Hallo</i>"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.Header.Set("Content-Type", "application/json")
+			tt.r.Header.Set("X-Goog-Api-Key", "secret")
+			var response struct {
+				Data struct {
+					Translations []googleTranslation `json:"translations"`
+				} `json:"data"`
+			}
+			if status := serve(t, s, tt.r, &response); status != http.StatusOK {
+				t.Fatalf("%s %s = %d", tt.r.Method, tt.r.URL, status)
+			}
+			if !reflect.DeepEqual(response.Data.Translations, tt.want) {
+				t.Errorf("%s %s = %+v, want %+v", tt.r.Method, tt.r.URL, response.Data.Translations, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoogleTranslateErrors(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name    string
+		query   url.Values
+		status  int
+		message string
+	}{
+		{"key", url.Values{"key": {"wrong"}, "q": {"Hello"}, "target": {"de"}}, http.StatusForbidden, "The request is missing a valid API key."},
+		{"text", url.Values{"key": {"secret"}, "target": {"de"}}, http.StatusBadRequest, "Required Text"},
+		{"target", url.Values{"key": {"secret"}, "q": {"Hello"}}, http.StatusBadRequest, "Required Target language"},
+		{"language", url.Values{"key": {"secret"}, "q": {"Hello"}, "source": {"en"}, "target": {"tlh"}}, http.StatusBadRequest, "Bad language pair: en|tlh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/language/translate/v2?"+tt.query.Encode(), nil)
+			var response struct {
+				Error struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if status := serve(t, s, r, &response); status != tt.status || response.Error.Code != tt.status || response.Error.Message != tt.message {
+				t.Errorf("GET /language/translate/v2 = %d %+v, want %d %q", status, response.Error, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestGoogleLanguages(t *testing.T) {
+	s, _ := newTestServer(t, Config{})
+	var response struct {
+		Data struct {
+			Languages []googleLanguage `json:"languages"`
+		} `json:"data"`
+	}
+	if status := serve(t, s, httptest.NewRequest("GET", "/language/translate/v2/languages?target=en", nil), &response); status != http.StatusOK {
+		t.Fatalf("GET /language/translate/v2/languages = %d", status)
+	}
+	languages := response.Data.Languages
+	if len(languages) != len(languageCodes) || languages[0] != (googleLanguage{Language: "ar", Name: "Arabic"}) {
+		t.Errorf("GET /language/translate/v2/languages = %+v", languages)
+	}
+}
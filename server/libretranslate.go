@@ -0,0 +1,201 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	ta "github.com/zaigie/translation-agent-go"
+)
+
+// libreRequest is the body of a LibreTranslate POST /translate, sent as a form or as JSON.
+type libreRequest struct {
+	Q      stringList `json:"q"`
+	Source string     `json:"source"`
+	Target string     `json:"target"`
+	Format string     `json:"format"`
+	APIKey string     `json:"api_key"`
+	// Alternatives is accepted for compatibility, the agent returns no alternatives.
+	Alternatives int `json:"alternatives"`
+	// batch reports whether q was an array, answered with an array of translations.
+	batch bool
+}
+
+// libreDetection is a detected language, with a confidence between 0 and 100.
+type libreDetection struct {
+	Confidence float64 `json:"confidence"`
+	Language   string  `json:"language"`
+}
+
+type libreLanguage struct {
+	Code    string   `json:"code"`
+	Name    string   `json:"name"`
+	Targets []string `json:"targets"`
+}
+
+// registerLibreTranslate mounts the endpoints of the LibreTranslate API:
+//
+//	POST /translate   translate a text or an array of texts
+//	POST /detect      detect the language of a text
+//	GET  /languages   list the languages
+//
+// They accept the API keys as the api_key parameter too.
+func (s *Server) registerLibreTranslate() {
+	s.mux.HandleFunc("POST /translate", s.handleLibreTranslate)
+	s.mux.HandleFunc("POST /detect", s.handleLibreDetect)
+	s.mux.HandleFunc("GET /languages", s.handleLibreLanguages)
+}
+
+func (s *Server) handleLibreTranslate(w http.ResponseWriter, r *http.Request) {
+	req, err := s.decodeLibreRequest(w, r)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	if len(s.config.APIKeys) > 0 && !s.validKey(firstKey(requestKey(r), req.APIKey)) {
+		writeError(w, http.StatusForbidden, "Invalid API key")
+		return
+	}
+	source, target, err := validateLibreRequest(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	config := s.config.Agent
+	if req.Format == "html" {
+		config = withMarkup(config)
+	}
+	results, err := s.translateTexts(r.Context(), config, req.Q.texts, ta.TranslationRequest{
+		SourceLang: source.Name,
+		TargetLang: target.Name,
+		Country:    target.Country,
+	})
+	if err != nil {
+		writeError(w, detectionStatus(err), err.Error())
+		return
+	}
+	texts := make([]string, len(results))
+	detections := make([]libreDetection, len(results))
+	for i, result := range results {
+		texts[i], detections[i] = result.Translation, newLibreDetection(result.DetectedSourceLang)
+	}
+	auto := source.Name == ta.AutoDetect
+	switch {
+	case req.batch && auto:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"translatedText": texts, "detectedLanguage": detections})
+	case req.batch:
+		writeJSON(w, http.StatusOK, map[string][]string{"translatedText": texts})
+	case auto:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"translatedText": texts[0], "detectedLanguage": detections[0]})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"translatedText": texts[0]})
+	}
+}
+
+func (s *Server) handleLibreDetect(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Q      string `json:"q"`
+		APIKey string `json:"api_key"`
+	}
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	if params != nil {
+		req.Q, req.APIKey = params.Get("q"), params.Get("api_key")
+	}
+	if len(s.config.APIKeys) > 0 && !s.validKey(firstKey(requestKey(r), req.APIKey)) {
+		writeError(w, http.StatusForbidden, "Invalid API key")
+		return
+	}
+	if strings.TrimSpace(req.Q) == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request: missing q parameter")
+		return
+	}
+	detection, err := ta.NewTranslationAgent(s.config.Agent).DetectLanguage(r.Context(), req.Q)
+	if err != nil {
+		writeError(w, detectionStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, []libreDetection{newLibreDetection(&detection)})
+}
+
+// newLibreDetection returns a detected language with the codes of LibreTranslate, which
+// names Traditional Chinese zt.
+func newLibreDetection(detection *ta.Detection) libreDetection {
+	if detection == nil {
+		return libreDetection{}
+	}
+	code := strings.ToLower(detection.Code)
+	switch code {
+	case "zh-hans":
+		code = "zh"
+	case "zh-hant":
+		code = "zt"
+	}
+	return libreDetection{Confidence: detection.Confidence * 100, Language: code}
+}
+
+func (s *Server) decodeLibreRequest(w http.ResponseWriter, r *http.Request) (libreRequest, error) {
+	var req libreRequest
+	params, err := s.decodeParams(w, r, &req)
+	if err != nil {
+		return req, err
+	}
+	if params == nil {
+		req.batch = req.Q.array
+		return req, nil
+	}
+	req.Q.texts = params["q"]
+	req.batch = len(req.Q.texts) > 1
+	req.Source = params.Get("source")
+	req.Target = params.Get("target")
+	req.Format = params.Get("format")
+	req.APIKey = params.Get("api_key")
+	return req, nil
+}
+
+func validateLibreRequest(req libreRequest) (source, target language, err error) {
+	switch {
+	case len(req.Q.texts) == 0:
+		return source, target, errors.New("Invalid request: missing q parameter")
+	case req.Source == "":
+		return source, target, errors.New("Invalid request: missing source parameter")
+	case req.Target == "":
+		return source, target, errors.New("Invalid request: missing target parameter")
+	case req.Format != "" && req.Format != "text" && req.Format != "html":
+		return source, target, errors.New("Invalid request: format must be text or html")
+	}
+	source, ok := language{Name: ta.AutoDetect}, true
+	if req.Source != "auto" {
+		source, ok = lookupLanguage(req.Source)
+	}
+	if !ok {
+		return source, target, errors.New(req.Source + " is not supported")
+	}
+	target, ok = lookupLanguage(req.Target)
+	if !ok {
+		return source, target, errors.New(req.Target + " is not supported")
+	}
+	return source, target, nil
+}
+
+func (s *Server) handleLibreLanguages(w http.ResponseWriter, r *http.Request) {
+	languages := make([]libreLanguage, len(languageCodes))
+	for i, code := range languageCodes {
+		l, _ := lookupLanguage(code)
+		languages[i] = libreLanguage{Code: code, Name: l.Name, Targets: languageCodes}
+	}
+	writeJSON(w, http.StatusOK, languages)
+}
+
+// firstKey returns the first of the keys that is set.
+func firstKey(keys ...string) string {
+	for _, key := range keys {
+		if key != "" {
+			return key
+		}
+	}
+	return ""
+}
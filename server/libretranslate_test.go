@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLibreTranslate(t *testing.T) {
+	s, model := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"text", `{"q": "Hello", "source": "en", "target": "de", "api_key": "secret"}`, `{"translatedText":"Hallo"}`},
+		{"batch", `{"q": ["Hello", "world"], "source": "en", "target": "de", "api_key": "secret"}`, `{"translatedText":["Hallo","Welt"]}`},
+		{"html", `{"q": "<b>Hello</b> world", "source": "en", "target": "de", "format": "html", "api_key": "secret"}`, `{"translatedText":"<b>Hallo</b> Welt"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/translate", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != tt.want {
+				t.Errorf("POST /translate = %d %s, want %s", w.Code, got, tt.want)
+			}
+		})
+	}
+	if !model.Asked("<ph_1/>Hello<ph_2/> world") {
+		t.Error("the markup of an html text was not protected")
+	}
+
+	// The pb alias is Brazilian Portuguese, and forms are accepted too.
+	form := url.Values{"q": {"Hello"}, "source": {"en"}, "target": {"pb"}, "api_key": {"secret"}}
+	r := httptest.NewRequest("POST", "/translate", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var response struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if status := serve(t, s, r, &response); status != http.StatusOK || response.TranslatedText != "Hallo" {
+		t.Errorf("POST /translate of a form = %d %q, want Hallo", status, response.TranslatedText)
+	}
+	if !model.Asked("Portuguese colloquially spoken in Brazil") {
+		t.Error("the model was not asked for Brazilian Portuguese")
+	}
+}
+
+func TestLibreTranslateErrors(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		error  string
+	}{
+		{"key", `{"q": "Hello", "source": "en", "target": "de", "api_key": "wrong"}`, http.StatusForbidden, "Invalid API key"},
+		{"q", `{"source": "en", "target": "de", "api_key": "secret"}`, http.StatusBadRequest, "Invalid request: missing q parameter"},
+		{"source", `{"q": "Hello", "target": "de", "api_key": "secret"}`, http.StatusBadRequest, "Invalid request: missing source parameter"},
+		{"format", `{"q": "Hello", "source": "en", "target": "de", "format": "md", "api_key": "secret"}`, http.StatusBadRequest, "Invalid request: format must be text or html"},
+		{"unsupported", `{"q": "Hello", "source": "en", "target": "tlh", "api_key": "secret"}`, http.StatusBadRequest, "tlh is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/translate", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			var response struct {
+				Error string `json:"error"`
+			}
+			if status := serve(t, s, r, &response); status != tt.status || response.Error != tt.error {
+				t.Errorf("POST /translate = %d %q, want %d %q", status, response.Error, tt.status, tt.error)
+			}
+		})
+	}
+}
+
+func TestLibreLanguages(t *testing.T) {
+	s, _ := newTestServer(t, Config{})
+	var languages []libreLanguage
+	if status := serve(t, s, httptest.NewRequest("GET", "/languages", nil), &languages); status != http.StatusOK {
+		t.Fatalf("GET /languages = %d", status)
+	}
+	if len(languages) != len(languageCodes) {
+		t.Fatalf("GET /languages returned %d languages, want %d", len(languages), len(languageCodes))
+	}
+	if want := (libreLanguage{Code: "ar", Name: "Arabic", Targets: languageCodes}); !reflect.DeepEqual(languages[0], want) {
+		t.Errorf("GET /languages = %+v first, want %+v", languages[0], want)
+	}
+}
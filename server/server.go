@@ -0,0 +1,433 @@
+// Package server serves the translation agent over HTTP with a JSON API.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	ta "github.com/zaigie/translation-agent-go"
+	"github.com/zaigie/translation-agent-go/jobs"
+)
+
+// Config configures a Server.
+type Config struct {
+	// Agent is the configuration of the agents translating the requests.
+	Agent ta.AgentConfig
+	// APIKeys are the keys clients must send as "Authorization: Bearer <key>" or in the
+	// X-API-Key header. The API is open when there are none.
+	APIKeys []string
+	// Tenants maps API keys to the tenant owning the jobs created with them. Tenants only
+	// see their own jobs, and the running jobs of each are limited by
+	// Jobs.MaxPerTenant. Keys without a tenant share the unnamed tenant.
+	Tenants map[string]string
+	// MaxRequestBytes limits the body of synchronous requests, 1 MiB by default.
+	MaxRequestBytes int64
+	// MaxJobBytes limits the body of job requests, 16 MiB by default.
+	MaxJobBytes int64
+	// MaxConcurrentTexts limits the texts of a DeepL, LibreTranslate or Google Translate
+	// request translated at the same time, 4 by default.
+	MaxConcurrentTexts int
+	// Jobs configures the queue of background jobs.
+	Jobs jobs.Options
+	// Glossaries are the glossaries requests can select by id.
+	Glossaries map[string]ta.Glossary
+}
+
+// Server is an http.Handler translating requests with the agent:
+//
+//	POST /v1/translate   translate a text and return the result of every step
+//	POST /v1/translate/stream
+//	                     translate a text and stream its progress as Server-Sent Events
+//	POST /v1/jobs        queue a translation and return the job
+//	GET  /v1/jobs        list the jobs of the tenant
+//	GET  /v1/jobs/{id}   return a job and, once it succeeded, its result
+//	POST /v1/jobs/{id}/cancel
+//	                     cancel a queued or running job
+//	GET  /healthz        report that the server is up
+//
+// and the endpoints of the DeepL, LibreTranslate, Google Translate and OpenAI APIs listed
+// at registerDeepL, registerLibreTranslate, registerGoogle and registerChat.
+type Server struct {
+	config Config
+	queue  *jobs.Queue
+	mux    *http.ServeMux
+}
+
+// New returns a server and starts the workers of its job queue, loading the jobs of its
+// store.
+func New(config Config) (*Server, error) {
+	if config.MaxRequestBytes <= 0 {
+		config.MaxRequestBytes = 1 << 20
+	}
+	if config.MaxJobBytes <= 0 {
+		config.MaxJobBytes = 16 << 20
+	}
+	if config.MaxConcurrentTexts <= 0 {
+		config.MaxConcurrentTexts = 4
+	}
+	s := &Server{config: config, mux: http.NewServeMux()}
+	queue, err := jobs.NewQueue(s.translate, config.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	s.queue = queue
+
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.Handle("POST /v1/translate", s.authenticate(http.HandlerFunc(s.handleTranslate)))
+	s.mux.Handle("POST /v1/translate/stream", s.authenticate(http.HandlerFunc(s.handleTranslateStream)))
+	s.mux.Handle("POST /v1/jobs", s.authenticate(http.HandlerFunc(s.handleCreateJob)))
+	s.mux.Handle("GET /v1/jobs", s.authenticate(http.HandlerFunc(s.handleListJobs)))
+	s.mux.Handle("GET /v1/jobs/{id}", s.authenticate(http.HandlerFunc(s.handleGetJob)))
+	s.mux.Handle("POST /v1/jobs/{id}/cancel", s.authenticate(http.HandlerFunc(s.handleCancelJob)))
+	s.registerDeepL()
+	s.registerLibreTranslate()
+	s.registerGoogle()
+	s.registerChat()
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Jobs returns the job queue, to share it with other APIs.
+func (s *Server) Jobs() *jobs.Queue {
+	return s.queue
+}
+
+// Close stops accepting jobs and waits for the queued and running ones, canceling them
+// when ctx is done first.
+func (s *Server) Close(ctx context.Context) error {
+	return s.queue.Close(ctx)
+}
+
+// translate runs a request with its own agent, so that its usage can be reported.
+func (s *Server) translate(ctx context.Context, req ta.TranslationRequest) (*ta.TranslationResult, ta.Usage, error) {
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	result, err := agent.Execute(ctx, req)
+	return result, agent.Usage(), err
+}
+
+// translateTexts translates texts concurrently, MaxConcurrentTexts at a time, each with
+// its own agent and the settings of req. Blank texts are returned as they are, without a
+// detected source language. The first error cancels the texts still being translated.
+func (s *Server) translateTexts(ctx context.Context, config ta.AgentConfig, texts []string, req ta.TranslationRequest) ([]*ta.TranslationResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	translations := make([]*ta.TranslationResult, len(texts))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, s.config.MaxConcurrentTexts)
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			translations[i] = &ta.TranslationResult{Translation: text}
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		textReq := req
+		textReq.SourceText = text
+		go func(i int, req ta.TranslationRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result, err := ta.NewTranslationAgent(config).Execute(ctx, req)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			translations[i] = result
+		}(i, textReq)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// withMarkup returns config protecting the markup of XML and HTML texts.
+func withMarkup(config ta.AgentConfig) ta.AgentConfig {
+	config.PlaceholderPatterns = append(append([]string{}, config.ActivePlaceholderPatterns()...), ta.MarkupPlaceholderPatterns...)
+	config.DisablePlaceholders = false
+	return config
+}
+
+// translateResponse is the body returned by POST /v1/translate.
+type translateResponse struct {
+	*ta.TranslationResult
+	Usage ta.Usage `json:"usage"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleTranslate(w http.ResponseWriter, r *http.Request) {
+	var req ta.TranslationRequest
+	if !s.decodeRequest(w, r, s.config.MaxRequestBytes, &req) {
+		return
+	}
+	result, usage, err := s.translate(r.Context(), req)
+	if err != nil {
+		writeError(w, detectionStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, translateResponse{TranslationResult: result, Usage: usage})
+}
+
+// handleTranslateStream sends the events of a translation as Server-Sent Events named
+// after their type, ending with a "done" event holding the result and its usage, or an
+// "error" event.
+func (s *Server) handleTranslateStream(w http.ResponseWriter, r *http.Request) {
+	var req ta.TranslationRequest
+	if !s.decodeRequest(w, r, s.config.MaxRequestBytes, &req) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	agent := ta.NewTranslationAgent(s.config.Agent)
+	for event := range agent.ExecuteStream(r.Context(), req) {
+		data := interface{}(event)
+		if event.Type == ta.EventDone {
+			data = struct {
+				ta.Event
+				Usage ta.Usage `json:"usage"`
+			}{event, agent.Usage()}
+		}
+		if err := writeEvent(w, string(event.Type), data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a Server-Sent Event with a JSON payload.
+func writeEvent(w io.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// jobRequest is the body of POST /v1/jobs.
+type jobRequest struct {
+	ta.TranslationRequest
+	// Priority orders the queued jobs, higher first.
+	Priority int `json:"priority"`
+	// CallbackURL is posted the job once it finished.
+	CallbackURL string `json:"callback_url"`
+}
+
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := decodeJSON(w, r, s.config.MaxJobBytes, &req); err != nil {
+		return
+	}
+	if err := s.validateRequest(req.TranslationRequest); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := s.queue.Submit(req.TranslationRequest, jobs.SubmitOptions{
+		Tenant:      s.tenant(r),
+		Priority:    req.Priority,
+		CallbackURL: req.CallbackURL,
+	})
+	switch {
+	case errors.Is(err, jobs.ErrInvalidCallback):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrClosed):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	tenant := s.tenant(r)
+	list := []jobs.Job{}
+	for _, job := range s.queue.List() {
+		if job.Tenant == tenant {
+			list = append(list, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]jobs.Job{"jobs": list})
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.Get(r.PathValue("id"))
+	if !ok || job.Tenant != s.tenant(r) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.Get(r.PathValue("id"))
+	if !ok || job.Tenant != s.tenant(r) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	job, err := s.queue.Cancel(job.ID)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, http.StatusNotFound, "job not found")
+	case errors.Is(err, jobs.ErrFinished):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// tenant returns the tenant of the API key of a request.
+func (s *Server) tenant(r *http.Request) string {
+	return s.config.Tenants[requestKey(r)]
+}
+
+// decodeRequest reads a translation request of at most limit bytes, and writes the error
+// response when it is too large or invalid.
+func (s *Server) decodeRequest(w http.ResponseWriter, r *http.Request, limit int64, req *ta.TranslationRequest) bool {
+	if err := decodeJSON(w, r, limit, req); err != nil {
+		return false
+	}
+	if err := s.validateRequest(*req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) validateRequest(req ta.TranslationRequest) error {
+	switch {
+	case req.TargetLang == "":
+		return errors.New("missing target_lang")
+	case strings.TrimSpace(req.SourceText) == "":
+		return errors.New("missing source_text")
+	}
+	if _, err := s.config.Agent.StyleProfile(req.Style); err != nil {
+		return err
+	}
+	return ta.ValidateLanguages(req)
+}
+
+// decodeJSON reads a JSON body of at most limit bytes into v, and writes the error
+// response when it cannot.
+func decodeJSON(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", limit))
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+	}
+	return err
+}
+
+// authenticate rejects requests without one of the API keys.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return s.authenticateWith(next, func(w http.ResponseWriter) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+	})
+}
+
+// authenticateWith rejects requests without one of the API keys with the error response
+// of an API. The key is looked up with requestKey, then with the other functions given.
+func (s *Server) authenticateWith(next http.Handler, reject func(w http.ResponseWriter), keys ...func(r *http.Request) string) http.Handler {
+	if len(s.config.APIKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestKey(r)
+		for _, lookup := range keys {
+			if key == "" {
+				key = lookup(r)
+			}
+		}
+		if !s.validKey(key) {
+			reject(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestKey returns the API key of a request, sent in the X-API-Key header or the
+// Authorization header as a bearer token or a DeepL key.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "DeepL-Auth-Key "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(strings.TrimPrefix(auth, scheme))
+		}
+	}
+	return ""
+}
+
+func (s *Server) validKey(key string) bool {
+	valid := false
+	for _, apiKey := range s.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			valid = true
+		}
+	}
+	return key != "" && valid
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
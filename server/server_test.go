@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ta "github.com/zaigie/translation-agent-go"
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+	"github.com/zaigie/translation-agent-go/jobs"
+)
+
+// toGerman translates the words of the tests.
+var toGerman = strings.NewReplacer("Hello", "Hallo", "world", "Welt", "Goodbye", "Tschüss").Replace
+
+// newTestServer returns a server whose agents use a stub model, and the model.
+func newTestServer(t *testing.T, config Config) (*Server, *stubmodel.Model) {
+	t.Helper()
+	model := stubmodel.New(t, toGerman)
+	config.Agent = ta.AgentConfig{
+		BaseURL:   model.URL,
+		ApiKey:    "test",
+		ModelName: "gpt-4o-mini",
+		MaxTokens: 1000,
+	}
+	config.Jobs = jobs.Options{Workers: 1}
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s, model
+}
+
+// serve sends a request to s and decodes the JSON response into v, returning the status.
+func serve(t *testing.T, s http.Handler, r *http.Request, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", r.Method, r.URL, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+func TestTranslate(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	body := `{"source_lang": "English", "target_lang": "German", "source_text": "Hello, world"}`
+
+	r := httptest.NewRequest("POST", "/v1/translate", strings.NewReader(body))
+	if status := serve(t, s, r, nil); status != http.StatusUnauthorized {
+		t.Errorf("POST /v1/translate without a key = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	r = httptest.NewRequest("POST", "/v1/translate", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	var response struct {
+		Translation string   `json:"translation"`
+		Usage       ta.Usage `json:"usage"`
+	}
+	if status := serve(t, s, r, &response); status != http.StatusOK {
+		t.Fatalf("POST /v1/translate = %d", status)
+	}
+	if response.Translation != "Hallo, Welt" || response.Usage.Requests == 0 {
+		t.Errorf("POST /v1/translate = %+v, want Hallo, Welt with its usage", response)
+	}
+}
+
+func TestTranslateStream(t *testing.T) {
+	s, _ := newTestServer(t, Config{APIKeys: []string{"secret"}})
+	r := httptest.NewRequest("POST", "/v1/translate/stream", strings.NewReader(`{"source_lang": "English", "target_lang": "German", "source_text": "Hello"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("POST /v1/translate/stream = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var names []string
+	var done struct {
+		Result ta.TranslationResult `json:"result"`
+		Usage  ta.Usage             `json:"usage"`
+	}
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		name, data, _ := strings.Cut(block, "\n")
+		name = strings.TrimPrefix(name, "event: ")
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+		if name == "done" {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &done); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if names[0] != "split" || names[len(names)-1] != "done" {
+		t.Errorf("events = %q, want split first and done last", names)
+	}
+	if done.Result.Translation != "Hallo" || done.Usage.Requests != 3 {
+		t.Errorf("done event = %+v, want Hallo after 3 requests", done)
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/pkoukk/tiktoken-go"
 	ts "github.com/tmc/langchaingo/textsplitter"
@@ -10,8 +11,8 @@ import (
 
 var ErrNoSplitterNeeded = errors.New("input does not require splitting")
 
-// createTextSplitter creates a text splitter using encoding or model name based on the input parameters.
-func createTextSplitter(inputStr string, identifier string, maxTokens int, useModel bool) (ts.RecursiveCharacter, error) {
+// newTokenEncoder returns the tiktoken encoder for a model name or an encoding name.
+func newTokenEncoder(identifier string, useModel bool) (*tiktoken.Tiktoken, error) {
 	var tokenEncoder *tiktoken.Tiktoken
 	var err error
 
@@ -21,7 +22,30 @@ func createTextSplitter(inputStr string, identifier string, maxTokens int, useMo
 		tokenEncoder, err = tiktoken.GetEncoding(identifier)
 	}
 	if err != nil {
-		return ts.RecursiveCharacter{}, fmt.Errorf("get encoding/model: %v", err)
+		return nil, fmt.Errorf("get encoding/model: %v", err)
+	}
+	return tokenEncoder, nil
+}
+
+// encodingForModel returns the name of the encoding used by a model. Models unknown to
+// tiktoken, such as local or proxied ones, are counted with the GPT-4 encoding.
+func encodingForModel(model string) string {
+	if encoding, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return encoding
+	}
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return encoding
+		}
+	}
+	return tiktoken.MODEL_CL100K_BASE
+}
+
+// createTextSplitter creates a text splitter using encoding or model name based on the input parameters.
+func createTextSplitter(inputStr string, identifier string, maxTokens int, useModel bool) (ts.RecursiveCharacter, error) {
+	tokenEncoder, err := newTokenEncoder(identifier, useModel)
+	if err != nil {
+		return ts.RecursiveCharacter{}, err
 	}
 
 	numTokens := len(tokenEncoder.Encode(inputStr, nil, nil))
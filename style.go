@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// StyleProfile is a named set of style rules, such as a brand's, that the reflection and
+// improvement steps hold the translation to. A request selects it by name.
+//
+//	formality: more
+//	audience: IT administrators
+//	tone: confident and concise, no marketing superlatives
+//	banned_phrases:
+//	  - cutting-edge
+//	  - seamless
+//	punctuation: German quotation marks „…“, no exclamation marks
+//	units: metric units, dates as 31.12.2024, 24 hour times
+//	notes: |
+//	  Product names are never translated.
+type StyleProfile struct {
+	Name string `json:"name"`
+	// Formality is the form of address of the requests that leave it unset. As a profile
+	// serves every target language, FormalityMore and FormalityLess are ignored for the
+	// languages without formal and informal forms instead of failing.
+	Formality     Formality `json:"formality,omitempty"`
+	Audience      string    `json:"audience,omitempty"`
+	Tone          string    `json:"tone,omitempty"`
+	BannedPhrases []string  `json:"banned_phrases,omitempty"`
+	Punctuation   string    `json:"punctuation,omitempty"`
+	// Units are the rules for units, numbers, dates and times.
+	Units string `json:"units,omitempty"`
+	// Notes is free text on anything else.
+	Notes string `json:"notes,omitempty"`
+}
+
+// ErrUnknownStyle is returned for a request whose style profile is not in the
+// StyleProfiles of the agent.
+var ErrUnknownStyle = errors.New("unknown style profile")
+
+// LoadStyleProfile reads a style profile from a YAML (.yaml, .yml) or TOML (.toml) file.
+// Its name is the file name without the extension, unless the file sets one.
+func LoadStyleProfile(path string) (StyleProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return StyleProfile{}, err
+	}
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return StyleProfile{}, &ConfigError{File: path, Message: "unknown format, expected .yaml, .yml or .toml"}
+	}
+	if err != nil {
+		return StyleProfile{}, &ConfigError{File: path, Message: err.Error()}
+	}
+	profile, err := parseStyleProfile(configValue{value: raw})
+	if err != nil {
+		if configErr, ok := err.(*ConfigError); ok {
+			configErr.File = path
+		}
+		return StyleProfile{}, err
+	}
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return profile, nil
+}
+
+func parseStyleProfile(v configValue) (StyleProfile, error) {
+	var profile StyleProfile
+	if v.value == nil {
+		return profile, nil
+	}
+	fields, err := v.object("name", "formality", "audience", "tone", "banned_phrases", "punctuation", "units", "notes")
+	if err != nil {
+		return profile, err
+	}
+	for key, target := range map[string]*string{
+		"name":        &profile.Name,
+		"audience":    &profile.Audience,
+		"tone":        &profile.Tone,
+		"punctuation": &profile.Punctuation,
+		"units":       &profile.Units,
+		"notes":       &profile.Notes,
+	} {
+		if *target, err = fields[key].string(); err != nil {
+			return profile, err
+		}
+		*target = strings.TrimSpace(*target)
+	}
+	if profile.BannedPhrases, err = fields["banned_phrases"].strings(); err != nil {
+		return profile, err
+	}
+	formality, err := fields["formality"].string()
+	if err != nil {
+		return profile, err
+	}
+	profile.Formality = Formality(strings.TrimSpace(formality))
+	if err := checkFormality(profile.Formality); err != nil {
+		return profile, fields["formality"].errorf("%v", err)
+	}
+	return profile, nil
+}
+
+// StyleProfile returns the style profile with the given name, or nil when name is empty.
+func (config AgentConfig) StyleProfile(name string) (*StyleProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	profile, ok := config.StyleProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(config.StyleProfiles))
+		for known := range config.StyleProfiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w %q, none are loaded", ErrUnknownStyle, name)
+		}
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownStyle, name, strings.Join(names, ", "))
+	}
+	if profile.Name == "" {
+		profile.Name = name
+	}
+	return &profile, nil
+}
+
+// applyStyle checks the style profile of req and gives req the formality of the profile
+// when req leaves it unset.
+func (config AgentConfig) applyStyle(req TranslationRequest) (TranslationRequest, error) {
+	profile, err := config.StyleProfile(req.Style)
+	if err != nil || profile == nil || profile.Formality == "" || req.Formality != "" {
+		return req, err
+	}
+	if err := checkFormality(profile.Formality); err != nil {
+		return req, fmt.Errorf("style profile %q: %w", profile.Name, err)
+	}
+	if (profile.Formality == FormalityMore || profile.Formality == FormalityLess) && !SupportsFormality(req.TargetLang) {
+		return req, nil
+	}
+	req.Formality = profile.Formality
+	return req, nil
+}
+
+// styleInstruction renders the style profile of req for the reflection step, which
+// checks the translation against it, or for the improvement step, which applies it. It
+// returns an empty string when req has no style profile.
+func (agent *TranslationAgent) styleInstruction(req TranslationRequest, reflection bool) (string, error) {
+	profile, err := agent.StyleProfile(req.Style)
+	if err != nil || profile == nil {
+		return "", err
+	}
+	instruction, err := renderTemplate(styleProfileInstruction, map[string]interface{}{
+		"targetLang": req.TargetLang,
+		"profile":    profile,
+		"reflection": reflection,
+	})
+	if err != nil {
+		return "", fmt.Errorf("render style profile: %v", err)
+	}
+	return instruction, nil
+}
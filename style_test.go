@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStyleProfile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"brand.yaml":  "formality: more\ntone: concise\nbanned_phrases: [seamless]\n",
+		"casual.toml": "name = \"chat\"\nformality = \"prefer_less\"\n",
+		"bad.yaml":    "formality: formal, address the reader with Sie\n",
+	})
+	brand, err := LoadStyleProfile(filepath.Join(dir, "brand.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if brand.Name != "brand" || brand.Formality != FormalityMore || brand.Tone != "concise" || len(brand.BannedPhrases) != 1 {
+		t.Errorf("LoadStyleProfile(brand.yaml) = %+v", brand)
+	}
+	casual, err := LoadStyleProfile(filepath.Join(dir, "casual.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if casual.Name != "chat" || casual.Formality != FormalityPreferLess {
+		t.Errorf("LoadStyleProfile(casual.toml) = %+v", casual)
+	}
+
+	_, err = LoadStyleProfile(filepath.Join(dir, "bad.yaml"))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Key != "formality" {
+		t.Errorf("LoadStyleProfile with a free text formality = %v, want a ConfigError for formality", err)
+	}
+}
+
+func TestApplyStyle(t *testing.T) {
+	config := AgentConfig{StyleProfiles: map[string]StyleProfile{
+		"formal":   {Formality: FormalityMore},
+		"informal": {Formality: FormalityPreferLess},
+		"plain":    {Tone: "concise"},
+		"invalid":  {Formality: "formal"},
+	}}
+	tests := []struct {
+		style     string
+		target    string
+		formality Formality
+		want      Formality
+	}{
+		{"formal", "German", "", FormalityMore},
+		{"formal", "de-AT", FormalityLess, FormalityLess},
+		// English has no formal and informal forms, so the profile does not apply.
+		{"formal", "English", "", ""},
+		{"informal", "English", "", FormalityPreferLess},
+		{"plain", "German", "", ""},
+		{"", "German", FormalityPreferMore, FormalityPreferMore},
+	}
+	for _, tt := range tests {
+		req, err := config.applyStyle(TranslationRequest{Style: tt.style, TargetLang: tt.target, Formality: tt.formality})
+		if err != nil {
+			t.Errorf("applyStyle(%q, %q): %v", tt.style, tt.target, err)
+			continue
+		}
+		if req.Formality != tt.want {
+			t.Errorf("applyStyle(%q, %q, %q) formality = %q, want %q", tt.style, tt.target, tt.formality, req.Formality, tt.want)
+		}
+	}
+
+	if _, err := config.applyStyle(TranslationRequest{Style: "invalid", TargetLang: "German"}); err == nil {
+		t.Error("applyStyle with an unknown formality in the profile did not fail")
+	}
+	if _, err := config.applyStyle(TranslationRequest{Style: "missing", TargetLang: "German"}); !errors.Is(err, ErrUnknownStyle) {
+		t.Errorf("applyStyle with an unknown profile = %v, want %v", err, ErrUnknownStyle)
+	}
+}
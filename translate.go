@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 type AgentConfig struct {
@@ -12,273 +15,553 @@ type AgentConfig struct {
 	MaxTokens   int
 	Temperature float32
 	ApiKey      string
+
+	// PlaceholderPatterns are regular expressions for placeholders and markup that must
+	// survive translation, DefaultPlaceholderPatterns when none are set. Matches are
+	// replaced with opaque tokens before prompting, checked after every step and
+	// restored at the end.
+	PlaceholderPatterns []string
+	// DisablePlaceholders turns placeholder protection off for plain text. Segments of
+	// i18n files are always protected.
+	DisablePlaceholders bool
+	// MaxRetries is how many more times a step is run when it loses placeholders.
+	MaxRetries int
+
+	// Glossary holds terms with fixed translations, which every step is asked to use.
+	Glossary Glossary
+	// StyleGuide is free text on the style the translation must follow.
+	StyleGuide string
+	// StyleProfiles are the style profiles requests can select by name, which the
+	// reflection and improvement steps follow on top of the style guide.
+	StyleProfiles map[string]StyleProfile
+
+	// MinDetectionConfidence is the confidence below which the model is asked to detect
+	// the source language when the offline detection is not sure, 0.7 by default. A
+	// negative value never asks the model.
+	MinDetectionConfidence float64
 }
 
 type TranslationAgent struct {
 	AgentConfig
+
+	usageMu sync.Mutex
+	usage   Usage
 }
 
 func NewTranslationAgent(config AgentConfig) *TranslationAgent {
-	return &TranslationAgent{config}
+	return &TranslationAgent{AgentConfig: config}
 }
 
-func (agent *TranslationAgent) Translate(sourceLang string, targetLang string, sourceText string, country string) string {
-	// Check if the source text is a single chunk or multiple chunks
-	// If the source text is a single chunk, call the OneChunkTranslateText function
-	// If the source text is multiple chunks, call the MultiChunkTranslateText function
-	textSplitter, err := createTextSplitter(sourceText, agent.ModelName, agent.MaxTokens, true)
-	if err != nil {
-		if err != ErrNoSplitterNeeded {
-			fmt.Printf("Error creating text splitter: %v\n", err)
-			return ""
-		}
-	}
-	if err == ErrNoSplitterNeeded {
-		return agent.oneChunkTranslateText(sourceLang, targetLang, sourceText, country)
-	} else {
-		textChunks, err := textSplitter.SplitText(sourceText)
-		if err != nil {
-			fmt.Printf("Error splitting text: %v\n", err)
-			return ""
-		}
-		translationChunks := agent.multiChunkTranslateText(sourceLang, targetLang, textChunks, country)
-		for i := range translationChunks {
-			translationChunks[i] = removeWrappingTags(translationChunks[i])
-		}
-		return strings.Trim(strings.Join(translationChunks, ""), "\n")
-	}
+// TranslationRequest describes a text to translate. The languages are BCP 47 tags such as
+// "pt-BR" or English names such as "Brazilian Portuguese", and the source language is
+// detected when it is AutoDetect or empty. The country defaults to the region of the
+// target language, and may be an ISO 3166 code or a name.
+type TranslationRequest struct {
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+	SourceText string `json:"source_text"`
+	Country    string `json:"country,omitempty"`
+	// Formality selects the formal or informal form of address in target languages that
+	// have both, FormalityDefault when empty.
+	Formality Formality `json:"formality,omitempty"`
+	// Style names one of the StyleProfiles of the agent.
+	Style string `json:"style,omitempty"`
+	// PivotLang, such as English for Thai to Finnish, translates the text into the pivot
+	// language first and then into the target language, when it is neither of them.
+	PivotLang string `json:"pivot_lang,omitempty"`
 }
 
-// one chunk
-func (agent *TranslationAgent) oneChunkInitialTranslation(sourceLang string, targetLang string, sourceText string) string {
-	systemMessage, err := renderTemplate(oneChunkInitialTranslationSystemMessage, map[string]interface{}{
-		"sourceLang": sourceLang,
-		"targetLang": targetLang,
-	})
-	if err != nil {
-		fmt.Printf("Error rendering initial translation system message: %v\n", err)
-		return ""
-	}
-	translationPrompt, err := renderTemplate(oneChunkInitialTranslationPrompt, map[string]interface{}{
-		"sourceLang": sourceLang,
-		"sourceText": sourceText,
-		"targetLang": targetLang,
+// TranslationResult holds the final translation together with the output of every step.
+type TranslationResult struct {
+	Translation string        `json:"translation"`
+	Chunks      []ChunkResult `json:"chunks"`
+	// DetectedSourceLang is the detected language of a request with AutoDetect as source.
+	DetectedSourceLang *Detection `json:"detected_source_lang,omitempty"`
+	// Skipped reports that the source text was returned as it is, because it is already
+	// in the target language.
+	Skipped bool `json:"skipped,omitempty"`
+	// Pivot is the first leg of a pivot translation, from the source language into
+	// PivotLang. The chunks of the result then hold the second leg, whose source texts
+	// are the pivot translations.
+	Pivot     *TranslationResult `json:"pivot,omitempty"`
+	PivotLang string             `json:"pivot_lang,omitempty"`
+}
+
+// ChunkResult holds the steps of the translation of one chunk of the source text.
+type ChunkResult struct {
+	SourceText   string `json:"source_text"`
+	Translation1 string `json:"translation1"`
+	Reflection   string `json:"reflection"`
+	Translation2 string `json:"translation2"`
+}
+
+// Translate translates sourceText and returns the final translation, or an empty string
+// if the translation failed. Use Execute to get the error and the intermediate steps.
+func (agent *TranslationAgent) Translate(sourceLang string, targetLang string, sourceText string, country string) string {
+	result, err := agent.Execute(context.Background(), TranslationRequest{
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		SourceText: sourceText,
+		Country:    country,
 	})
 	if err != nil {
-		fmt.Printf("Error rendering initial translation prompt: %v\n", err)
+		fmt.Printf("Error translating text: %v\n", err)
 		return ""
 	}
-	translation, err := agent.getCompletion(translationPrompt, systemMessage)
-	if err != nil {
-		fmt.Printf("Error getting initial translation: %v\n", err)
-		return ""
-	}
-	return translation
+	return result.Translation
 }
 
-func (agent *TranslationAgent) oneChunkReflectOnTranslation(sourceLang string, targetLang string, sourceText string, translation1 string, country string) string {
-	systemMessage, err := renderTemplate(oneChunkReflectionSystemMessage, map[string]interface{}{
-		"sourceLang": sourceLang,
-		"targetLang": targetLang,
-	})
+// Execute runs the initial translation, reflection and improvement steps on the request.
+// Texts longer than MaxTokens are split into chunks, and every chunk is translated with
+// the rest of the text as context. Progress is reported to a context from WithEvents.
+// When the source language is detected or given as the target language and no country
+// is set, the source text is returned untranslated. With a PivotLang, the text goes
+// through the pivot language, and the reflection on the second leg also sees the
+// original.
+func (agent *TranslationAgent) Execute(ctx context.Context, req TranslationRequest) (*TranslationResult, error) {
+	req, err := agent.applyStyle(req)
 	if err != nil {
-		fmt.Printf("Error rendering reflection system message: %v\n", err)
-		return ""
+		return nil, err
 	}
-	var reflectionPrompt string = ""
-	if country == "" {
-		reflectionPrompt, err = renderTemplate(oneChunkReflectionPrompt, map[string]interface{}{
-			"sourceLang":   sourceLang,
-			"sourceText":   sourceText,
-			"translation1": translation1,
-			"targetLang":   targetLang,
-		})
-		if err != nil {
-			fmt.Printf("Error rendering reflection prompt: %v\n", err)
-			return ""
-		}
-	} else {
-		reflectionPrompt, err = renderTemplate(oneChunkReflectionCountryPrompt, map[string]interface{}{
-			"sourceLang":   sourceLang,
-			"sourceText":   sourceText,
-			"translation1": translation1,
-			"targetLang":   targetLang,
-			"country":      country,
-		})
+	if req, err = resolveLanguages(req); err != nil {
+		return nil, err
+	}
+	var detection *Detection
+	if IsAutoDetect(req.SourceLang) {
+		detected, err := agent.DetectLanguage(ctx, req.SourceText)
 		if err != nil {
-			fmt.Printf("Error rendering reflection prompt: %v\n", err)
-			return ""
+			return nil, err
 		}
+		detection, req.SourceLang = &detected, detected.Language
+	}
+	if req.Country == "" && sameLanguage(req.SourceLang, req.TargetLang) {
+		return skippedResult(ctx, req.SourceText, detection), nil
 	}
-	reflection, err := agent.getCompletion(reflectionPrompt, systemMessage)
+
+	protector, err := newPlaceholderProtector(agent.ActivePlaceholderPatterns())
 	if err != nil {
-		fmt.Printf("Error getting reflection: %v\n", err)
-		return ""
+		return nil, err
 	}
-	return reflection
+	sourceTextChunks, err := agent.splitText(protector.protect(req.SourceText))
+	if err != nil {
+		return nil, err
+	}
+	if usePivot(req) {
+		pivot, err := agent.translatePivot(ctx, req, protector, sourceTextChunks, detection)
+		if err != nil {
+			return nil, err
+		}
+		return agent.translateFromPivot(ctx, req, protector, sourceTextChunks, pivot)
+	}
+	return agent.translateChunks(ctx, req, protector, sourceTextChunks, nil, detection)
 }
 
-func (agent *TranslationAgent) oneChunkImproveTranslation(sourceLang string, targetLang string, sourceText string, translation1 string, reflection string) string {
-	systemMessage, err := renderTemplate(oneChunkImproveTranslationSystemMessage, map[string]interface{}{
-		"sourceLang": sourceLang,
-		"targetLang": targetLang,
-	})
+// pivotSource is the original text of the second leg of a pivot translation.
+type pivotSource struct {
+	lang   string
+	chunks []string
+}
+
+// usePivot reports whether req, with resolved languages, goes through its pivot language.
+func usePivot(req TranslationRequest) bool {
+	return req.PivotLang != "" && !sameLanguage(req.PivotLang, req.SourceLang) && !sameLanguage(req.PivotLang, req.TargetLang)
+}
+
+// translatePivot runs the first leg of a pivot translation, from the source language of
+// req into its pivot language, without the country and formality, which belong to the
+// target.
+func (agent *TranslationAgent) translatePivot(ctx context.Context, req TranslationRequest, protector *placeholderProtector, sourceTextChunks []string, detection *Detection) (*TranslationResult, error) {
+	req.TargetLang, req.Country, req.Formality = req.PivotLang, "", ""
+	pivot, err := agent.translateChunks(withTarget(ctx, req.PivotLang), req, protector, sourceTextChunks, nil, detection)
 	if err != nil {
-		fmt.Printf("Error rendering improve translation system message: %v\n", err)
-		return ""
+		return nil, fmt.Errorf("pivot translation into %s: %w", req.PivotLang, err)
 	}
-	improvementPrompt, err := renderTemplate(oneChunkImproveTranslationPrompt, map[string]interface{}{
-		"sourceLang":   sourceLang,
-		"sourceText":   sourceText,
-		"translation1": translation1,
-		"reflection":   reflection,
-		"targetLang":   targetLang,
-	})
-	if err != nil {
-		fmt.Printf("Error rendering improve translation prompt: %v\n", err)
-		return ""
+	return pivot, nil
+}
+
+// translateFromPivot runs the second leg of a pivot translation, from the chunks of the
+// first leg into the target language of req, and records the first leg in the result.
+func (agent *TranslationAgent) translateFromPivot(ctx context.Context, req TranslationRequest, protector *placeholderProtector, sourceTextChunks []string, pivot *TranslationResult) (*TranslationResult, error) {
+	pivotChunks := make([]string, len(pivot.Chunks))
+	for i, chunk := range pivot.Chunks {
+		pivotChunks[i] = protector.reprotect(sourceTextChunks[i], removeWrappingTags(chunk.Translation2))
 	}
-	translation2, err := agent.getCompletion(improvementPrompt, systemMessage)
+	original := &pivotSource{lang: req.SourceLang, chunks: sourceTextChunks}
+	req.SourceLang = req.PivotLang
+	result, err := agent.translateChunks(ctx, req, protector, pivotChunks, original, pivot.DetectedSourceLang)
 	if err != nil {
-		fmt.Printf("Error getting improved translation: %v\n", err)
-		return ""
+		return nil, err
 	}
-	return translation2
+	result.Pivot, result.PivotLang = pivot, req.PivotLang
+	return result, nil
 }
 
-func (agent *TranslationAgent) oneChunkTranslateText(sourceLang string, targetLang string, sourceText string, country string) string {
-	translation1 := agent.oneChunkInitialTranslation(sourceLang, targetLang, sourceText)
-	reflection := agent.oneChunkReflectOnTranslation(sourceLang, targetLang, sourceText, translation1, country)
-	translation2 := agent.oneChunkImproveTranslation(sourceLang, targetLang, sourceText, translation1, reflection)
-	return translation2
+// skippedResult returns the result of a source text that is already in the target
+// language.
+func skippedResult(ctx context.Context, sourceText string, detection *Detection) *TranslationResult {
+	emitEvent(ctx, Event{Type: EventSplit, Chunks: 1})
+	return &TranslationResult{
+		Translation: sourceText,
+		Chunks: []ChunkResult{{
+			SourceText:   sourceText,
+			Translation1: sourceText,
+			Translation2: sourceText,
+		}},
+		DetectedSourceLang: detection,
+		Skipped:            true,
+	}
 }
 
-// multi chunk
-func (agent *TranslationAgent) multiChunkInitialTranslation(sourceLang string, targetLang string, sourceTextChunks []string) []string {
-	translationChunks := make([]string, len(sourceTextChunks))
+// translateChunks runs the three steps on the chunks of a source text protected by
+// protector, for the resolved languages of req. original is the text the source text
+// was translated from by the first leg of a pivot translation, or nil.
+func (agent *TranslationAgent) translateChunks(ctx context.Context, req TranslationRequest, protector *placeholderProtector, sourceTextChunks []string, original *pivotSource, detection *Detection) (*TranslationResult, error) {
+	var err error
+	n := len(sourceTextChunks)
+	emitEvent(ctx, Event{Type: EventSplit, Chunks: n})
+
+	translation1Chunks := make([]string, n)
 	for i := range sourceTextChunks {
-		taggedText := fmt.Sprintf("%s<TRANSLATE_THIS>%s</TRANSLATE_THIS>%s", strings.Join(sourceTextChunks[0:i], ""), sourceTextChunks[i], sourceTextChunks[i+1:])
-		systemMessage, err := renderTemplate(multiChunkInitialTranslationSystemMessage, map[string]interface{}{
-			"sourceLang": sourceLang,
-			"targetLang": targetLang,
+		stepCtx := withStep(ctx, StageInitialTranslation, i, n)
+		translation1Chunks[i], err = agent.runStep(stepCtx, protector, req, sourceTextChunks[i], func() (string, string, error) {
+			return agent.initialTranslationPrompt(req, sourceTextChunks, i)
 		})
 		if err != nil {
-			fmt.Printf("Error rendering initial translation system message: %v\n", err)
-			return []string{}
+			return nil, fmt.Errorf("initial translation of chunk %d: %w", i+1, err)
 		}
-		translationPrompt, err := renderTemplate(multiChunkInitialTranslationPrompt, map[string]interface{}{
-			"sourceLang":       sourceLang,
-			"targetLang":       targetLang,
-			"taggedText":       taggedText,
-			"chunkToTranslate": sourceTextChunks[i],
+		emitEvent(stepCtx, Event{Type: EventDraft, Text: protector.restore(translation1Chunks[i])})
+	}
+	reflectionChunks := make([]string, n)
+	for i := range sourceTextChunks {
+		stepCtx := withStep(ctx, StageReflection, i, n)
+		reflectionChunks[i], err = agent.runStep(stepCtx, nil, req, sourceTextChunks[i], func() (string, string, error) {
+			return agent.reflectionPrompt(req, original, sourceTextChunks, translation1Chunks, i)
 		})
 		if err != nil {
-			fmt.Printf("Error rendering initial translation prompt: %v\n", err)
-			return []string{}
+			return nil, fmt.Errorf("reflection on chunk %d: %w", i+1, err)
 		}
-		translation, err := agent.getCompletion(translationPrompt, systemMessage)
+		emitEvent(stepCtx, Event{Type: EventReflection, Text: protector.restore(reflectionChunks[i])})
+	}
+	translation2Chunks := make([]string, n)
+	for i := range sourceTextChunks {
+		stepCtx := withStep(ctx, StageImprovement, i, n)
+		translation2Chunks[i], err = agent.runStep(stepCtx, protector, req, sourceTextChunks[i], func() (string, string, error) {
+			return agent.improvementPrompt(req, sourceTextChunks, translation1Chunks, reflectionChunks, i)
+		})
 		if err != nil {
-			fmt.Printf("Error getting initial translation: %v\n", err)
-			return []string{}
+			return nil, fmt.Errorf("improved translation of chunk %d: %w", i+1, err)
+		}
+		emitEvent(stepCtx, Event{Type: EventFinal, Text: protector.restore(translation2Chunks[i])})
+	}
+
+	result := &TranslationResult{Chunks: make([]ChunkResult, len(sourceTextChunks))}
+	for i := range sourceTextChunks {
+		result.Chunks[i] = ChunkResult{
+			SourceText:   protector.restore(sourceTextChunks[i]),
+			Translation1: protector.restore(translation1Chunks[i]),
+			Reflection:   protector.restore(reflectionChunks[i]),
+			Translation2: protector.restore(translation2Chunks[i]),
 		}
-		translationChunks[i] = translation
 	}
-	return translationChunks
+	result.Translation = joinTranslationChunks(translation2Chunks)
+	result.Translation = protector.restore(result.Translation)
+	result.DetectedSourceLang = detection
+	return result, nil
 }
 
-func (agent *TranslationAgent) multiChunkReflectOnTranslation(sourceLang string, targetLang string, sourceTextChunks []string, translation1Chunks []string, country string) []string {
-	reflectionChunks := make([]string, len(sourceTextChunks))
+// Refine runs another improvement step on a result of Execute or Refine for req, with
+// feedback, such as a reviewer's comments, in place of the reflection. The chunks of the
+// new result hold the previous translation as Translation1 and the feedback as
+// Reflection.
+func (agent *TranslationAgent) Refine(ctx context.Context, req TranslationRequest, previous *TranslationResult, feedback string) (*TranslationResult, error) {
+	if previous == nil || len(previous.Chunks) == 0 {
+		return nil, errors.New("no previous translation to refine")
+	}
+	req, err := agent.applyStyle(req)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = resolveLanguages(req); err != nil {
+		return nil, err
+	}
+	if IsAutoDetect(req.SourceLang) {
+		if previous.DetectedSourceLang == nil {
+			return nil, errors.New("no detected source language to refine with")
+		}
+		req.SourceLang = previous.DetectedSourceLang.Language
+	}
+	if previous.PivotLang != "" {
+		// The chunks of a pivot translation translate the pivot text.
+		req.SourceLang = previous.PivotLang
+	}
+	protector, err := newPlaceholderProtector(agent.ActivePlaceholderPatterns())
+	if err != nil {
+		return nil, err
+	}
+	n := len(previous.Chunks)
+	sourceTextChunks := make([]string, n)
+	translation1Chunks := make([]string, n)
+	feedbackChunks := make([]string, n)
+	for i, chunk := range previous.Chunks {
+		sourceTextChunks[i] = protector.protect(chunk.SourceText)
+		translation1Chunks[i] = protector.reprotect(sourceTextChunks[i], chunk.Translation2)
+		feedbackChunks[i] = feedback
+	}
+
+	translation2Chunks := make([]string, n)
 	for i := range sourceTextChunks {
-		taggedText := fmt.Sprintf("%s<TRANSLATE_THIS>%s</TRANSLATE_THIS>%s", strings.Join(sourceTextChunks[0:i], ""), sourceTextChunks[i], sourceTextChunks[i+1:])
-		systemMessage, err := renderTemplate(multiChunkReflectionSystemMessage, map[string]interface{}{
-			"sourceLang": sourceLang,
-			"targetLang": targetLang,
+		stepCtx := withStep(ctx, StageImprovement, i, n)
+		translation2Chunks[i], err = agent.runStep(stepCtx, protector, req, sourceTextChunks[i], func() (string, string, error) {
+			return agent.improvementPrompt(req, sourceTextChunks, translation1Chunks, feedbackChunks, i)
 		})
 		if err != nil {
-			fmt.Printf("Error rendering reflection system message: %v\n", err)
-			return []string{}
+			return nil, fmt.Errorf("refined translation of chunk %d: %w", i+1, err)
 		}
-		if country == "" {
-			reflectionPrompt, err := renderTemplate(multiChunkReflectionPrompt, map[string]interface{}{
-				"sourceLang":        sourceLang,
-				"targetLang":        targetLang,
-				"taggedText":        taggedText,
-				"chunkToTranslate":  sourceTextChunks[i],
-				"translation1Chunk": translation1Chunks[i],
-			})
-			if err != nil {
-				fmt.Printf("Error rendering reflection prompt: %v\n", err)
-				return []string{}
-			}
-			reflection, err := agent.getCompletion(reflectionPrompt, systemMessage)
-			if err != nil {
-				fmt.Printf("Error getting reflection: %v\n", err)
-				return []string{}
-			}
-			reflectionChunks[i] = reflection
-		} else {
-			reflectionPrompt, err := renderTemplate(multiChunkReflectionCountryPrompt, map[string]interface{}{
-				"sourceLang":        sourceLang,
-				"targetLang":        targetLang,
-				"taggedText":        taggedText,
-				"chunkToTranslate":  sourceTextChunks[i],
-				"translation1Chunk": translation1Chunks[i],
-				"country":           country,
-			})
-			if err != nil {
-				fmt.Printf("Error rendering reflection prompt: %v\n", err)
-				return []string{}
-			}
-			reflection, err := agent.getCompletion(reflectionPrompt, systemMessage)
-			if err != nil {
-				fmt.Printf("Error getting reflection: %v\n", err)
-				return []string{}
-			}
-			reflectionChunks[i] = reflection
+		emitEvent(stepCtx, Event{Type: EventFinal, Text: protector.restore(translation2Chunks[i])})
+	}
+
+	result := &TranslationResult{Chunks: make([]ChunkResult, n)}
+	for i, chunk := range previous.Chunks {
+		result.Chunks[i] = ChunkResult{
+			SourceText:   chunk.SourceText,
+			Translation1: chunk.Translation2,
+			Reflection:   feedback,
+			Translation2: protector.restore(translation2Chunks[i]),
 		}
 	}
-	return reflectionChunks
+	result.Translation = protector.restore(joinTranslationChunks(translation2Chunks))
+	result.DetectedSourceLang = previous.DetectedSourceLang
+	result.Pivot, result.PivotLang = previous.Pivot, previous.PivotLang
+	return result, nil
 }
 
-func (agent *TranslationAgent) multiChunkImproveTranslation(sourceLang string, targetLang string, sourceTextChunks []string, translation1Chunks []string, reflectionChunks []string) []string {
-	translation2Chunks := make([]string, len(sourceTextChunks))
-	for i := range sourceTextChunks {
-		taggedText := fmt.Sprintf("%s<TRANSLATE_THIS>%s</TRANSLATE_THIS>%s", strings.Join(sourceTextChunks[0:i], ""), sourceTextChunks[i], sourceTextChunks[i+1:])
-		systemMessage, err := renderTemplate(multiChunkImproveTranslationSystemMessage, map[string]interface{}{
-			"sourceLang": sourceLang,
-			"targetLang": targetLang,
-		})
+// splitText returns the source text as a single chunk, or split into chunks of about
+// MaxTokens tokens when it is longer than that.
+func (agent *TranslationAgent) splitText(sourceText string) ([]string, error) {
+	textSplitter, err := createTextSplitter(sourceText, encodingForModel(agent.ModelName), agent.MaxTokens, false)
+	if err == ErrNoSplitterNeeded {
+		return []string{sourceText}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create text splitter: %v", err)
+	}
+	textChunks, err := textSplitter.SplitText(sourceText)
+	if err != nil {
+		return nil, fmt.Errorf("split text: %v", err)
+	}
+	return textChunks, nil
+}
+
+func joinTranslationChunks(translationChunks []string) string {
+	if len(translationChunks) == 1 {
+		return translationChunks[0]
+	}
+	cleaned := make([]string, len(translationChunks))
+	for i := range translationChunks {
+		cleaned[i] = removeWrappingTags(translationChunks[i])
+	}
+	return strings.Trim(strings.Join(cleaned, ""), "\n")
+}
+
+// runStep renders a prompt and gets its completion. When protector is set, the completion
+// must keep the placeholder tokens of sourceChunk, and the step is retried up to
+// MaxRetries times if it does not.
+func (agent *TranslationAgent) runStep(ctx context.Context, protector *placeholderProtector, req TranslationRequest, sourceChunk string, render func() (string, string, error)) (string, error) {
+	systemMessage, prompt, err := agent.stepPrompt(protector, req, sourceChunk, render)
+	if err != nil {
+		return "", err
+	}
+	emitEvent(ctx, Event{Type: EventStageStarted})
+	for attempt := 0; ; attempt++ {
+		completion, err := agent.getCompletion(ctx, prompt, systemMessage)
 		if err != nil {
-			fmt.Printf("Error rendering improve translation system message: %v\n", err)
-			return []string{}
+			return "", err
+		}
+		err = protector.verify(sourceChunk, completion)
+		var placeholderErr *PlaceholderError
+		if err == nil || !errors.As(err, &placeholderErr) || attempt >= agent.MaxRetries {
+			return completion, err
 		}
-		improvementPrompt, err := renderTemplate(multiChunkImproveTranslationPrompt, map[string]interface{}{
-			"sourceLang":        sourceLang,
-			"targetLang":        targetLang,
-			"taggedText":        taggedText,
-			"chunkToTranslate":  sourceTextChunks[i],
-			"translation1Chunk": translation1Chunks[i],
-			"reflectionChunk":   reflectionChunks[i],
+		emitEvent(ctx, Event{Type: EventRetry, Error: err.Error()})
+	}
+}
+
+// stepPrompt renders the system message and prompt of a step on sourceChunk, with the
+// glossary terms of the chunk and the style guide, and asking to keep the placeholder
+// tokens when protector is set.
+func (agent *TranslationAgent) stepPrompt(protector *placeholderProtector, req TranslationRequest, sourceChunk string, render func() (string, string, error)) (string, string, error) {
+	systemMessage, prompt, err := render()
+	if err != nil {
+		return "", "", err
+	}
+	guidance, err := agent.guidance(req.TargetLang, sourceChunk)
+	if err != nil {
+		return "", "", err
+	}
+	prompt += guidance
+	if protector.active() {
+		instruction, err := renderTemplate(placeholderInstruction, map[string]interface{}{
+			"targetLang": req.TargetLang,
 		})
 		if err != nil {
-			fmt.Printf("Error rendering improve translation prompt: %v\n", err)
-			return []string{}
+			return "", "", fmt.Errorf("render placeholder instruction: %v", err)
+		}
+		prompt += instruction
+	}
+	return systemMessage, prompt, nil
+}
+
+// guidance renders the glossary entries found in sourceText and the style guide, or
+// returns an empty string when there are none.
+func (agent *TranslationAgent) guidance(targetLang string, sourceText string) (string, error) {
+	glossary := agent.Glossary.matching(sourceText)
+	if len(glossary) == 0 && agent.StyleGuide == "" {
+		return "", nil
+	}
+	guidance, err := renderTemplate(guidanceInstruction, map[string]interface{}{
+		"targetLang": targetLang,
+		"glossary":   glossary,
+		"styleGuide": strings.TrimSpace(agent.StyleGuide),
+	})
+	if err != nil {
+		return "", fmt.Errorf("render glossary and style guide: %v", err)
+	}
+	return guidance, nil
+}
+
+// taggedText returns the source text with chunk i marked by <TRANSLATE_THIS> tags.
+func taggedText(sourceTextChunks []string, i int) string {
+	return fmt.Sprintf("%s<TRANSLATE_THIS>%s</TRANSLATE_THIS>%s", strings.Join(sourceTextChunks[0:i], ""), sourceTextChunks[i], strings.Join(sourceTextChunks[i+1:], ""))
+}
+
+// initialTranslationPrompt renders the system message and prompt for the initial
+// translation of chunk i, in the form of address of req. A text with a single chunk uses
+// the one chunk prompts.
+func (agent *TranslationAgent) initialTranslationPrompt(req TranslationRequest, sourceTextChunks []string, i int) (string, string, error) {
+	systemTemplate, promptTemplate := oneChunkInitialTranslationSystemMessage, oneChunkInitialTranslationPrompt
+	if len(sourceTextChunks) > 1 {
+		systemTemplate, promptTemplate = multiChunkInitialTranslationSystemMessage, multiChunkInitialTranslationPrompt
+	}
+	systemMessage, err := renderTemplate(systemTemplate, map[string]interface{}{
+		"sourceLang": req.SourceLang,
+		"targetLang": req.TargetLang,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render initial translation system message: %v", err)
+	}
+	translationPrompt, err := renderTemplate(promptTemplate, map[string]interface{}{
+		"sourceLang":       req.SourceLang,
+		"targetLang":       req.TargetLang,
+		"sourceText":       sourceTextChunks[i],
+		"taggedText":       taggedText(sourceTextChunks, i),
+		"chunkToTranslate": sourceTextChunks[i],
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render initial translation prompt: %v", err)
+	}
+	formality, err := formalityInstruction(req, false)
+	if err != nil {
+		return "", "", err
+	}
+	return systemMessage, translationPrompt + formality, nil
+}
+
+// reflectionPrompt renders the system message and prompt asking for suggestions on the
+// initial translation of chunk i, in the style of the request country when it is set,
+// against the original of a pivot translation when original is set, and against the
+// formality and style profile of req.
+func (agent *TranslationAgent) reflectionPrompt(req TranslationRequest, original *pivotSource, sourceTextChunks []string, translation1Chunks []string, i int) (string, string, error) {
+	systemTemplate, promptTemplate := oneChunkReflectionSystemMessage, oneChunkReflectionPrompt
+	if req.Country != "" {
+		promptTemplate = oneChunkReflectionCountryPrompt
+	}
+	if len(sourceTextChunks) > 1 {
+		systemTemplate, promptTemplate = multiChunkReflectionSystemMessage, multiChunkReflectionPrompt
+		if req.Country != "" {
+			promptTemplate = multiChunkReflectionCountryPrompt
 		}
-		translation2, err := agent.getCompletion(improvementPrompt, systemMessage)
+	}
+	systemMessage, err := renderTemplate(systemTemplate, map[string]interface{}{
+		"sourceLang": req.SourceLang,
+		"targetLang": req.TargetLang,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render reflection system message: %v", err)
+	}
+	reflectionPrompt, err := renderTemplate(promptTemplate, map[string]interface{}{
+		"sourceLang":        req.SourceLang,
+		"targetLang":        req.TargetLang,
+		"country":           req.Country,
+		"sourceText":        sourceTextChunks[i],
+		"translation1":      translation1Chunks[i],
+		"taggedText":        taggedText(sourceTextChunks, i),
+		"chunkToTranslate":  sourceTextChunks[i],
+		"translation1Chunk": translation1Chunks[i],
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render reflection prompt: %v", err)
+	}
+	if original != nil {
+		instruction, err := renderTemplate(pivotSourceInstruction, map[string]interface{}{
+			"sourceLang":   req.SourceLang,
+			"targetLang":   req.TargetLang,
+			"originalLang": original.lang,
+			"originalText": original.chunks[i],
+		})
 		if err != nil {
-			fmt.Printf("Error getting improved translation: %v\n", err)
-			return []string{}
+			return "", "", fmt.Errorf("render pivot source instruction: %v", err)
 		}
-		translation2Chunks[i] = translation2
+		reflectionPrompt += instruction
+	}
+	formality, err := formalityInstruction(req, true)
+	if err != nil {
+		return "", "", err
+	}
+	style, err := agent.styleInstruction(req, true)
+	if err != nil {
+		return "", "", err
 	}
-	return translation2Chunks
+	return systemMessage, reflectionPrompt + formality + style, nil
 }
 
-func (agent *TranslationAgent) multiChunkTranslateText(sourceLang string, targetLang string, sourceTextChunks []string, country string) []string {
-	translation1Chunks := agent.multiChunkInitialTranslation(sourceLang, targetLang, sourceTextChunks)
-	reflectionChunks := agent.multiChunkReflectOnTranslation(sourceLang, targetLang, sourceTextChunks, translation1Chunks, country)
-	translation2Chunks := agent.multiChunkImproveTranslation(sourceLang, targetLang, sourceTextChunks, translation1Chunks, reflectionChunks)
-	return translation2Chunks
+// improvementPrompt renders the system message and prompt asking to edit the initial
+// translation of chunk i according to its reflection, and to the formality and style
+// profile of req.
+func (agent *TranslationAgent) improvementPrompt(req TranslationRequest, sourceTextChunks []string, translation1Chunks []string, reflectionChunks []string, i int) (string, string, error) {
+	systemTemplate, promptTemplate := oneChunkImproveTranslationSystemMessage, oneChunkImproveTranslationPrompt
+	if len(sourceTextChunks) > 1 {
+		systemTemplate, promptTemplate = multiChunkImproveTranslationSystemMessage, multiChunkImproveTranslationPrompt
+	}
+	systemMessage, err := renderTemplate(systemTemplate, map[string]interface{}{
+		"sourceLang": req.SourceLang,
+		"targetLang": req.TargetLang,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render improve translation system message: %v", err)
+	}
+	improvementPrompt, err := renderTemplate(promptTemplate, map[string]interface{}{
+		"sourceLang":        req.SourceLang,
+		"targetLang":        req.TargetLang,
+		"sourceText":        sourceTextChunks[i],
+		"translation1":      translation1Chunks[i],
+		"reflection":        reflectionChunks[i],
+		"taggedText":        taggedText(sourceTextChunks, i),
+		"chunkToTranslate":  sourceTextChunks[i],
+		"translation1Chunk": translation1Chunks[i],
+		"reflectionChunk":   reflectionChunks[i],
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("render improve translation prompt: %v", err)
+	}
+	formality, err := formalityInstruction(req, false)
+	if err != nil {
+		return "", "", err
+	}
+	style, err := agent.styleInstruction(req, false)
+	if err != nil {
+		return "", "", err
+	}
+	return systemMessage, improvementPrompt + formality + style, nil
 }
 
 // removeWrappingTags Used to remove XML tags at the beginning and end
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zaigie/translation-agent-go/internal/stubmodel"
+)
+
+func TestRefine(t *testing.T) {
+	model := stubmodel.New(t, toGerman)
+	agent := NewTranslationAgent(stubConfig(model))
+	req := TranslationRequest{SourceLang: "English", TargetLang: "German", SourceText: "Hello, {{name}}!"}
+	result, err := agent.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refined, err := agent.Refine(context.Background(), req, result, "Greet the reader warmly.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refined.Translation != "Hallo, {{name}}!" {
+		t.Errorf("Refine = %q, want %q", refined.Translation, "Hallo, {{name}}!")
+	}
+	chunk := refined.Chunks[0]
+	if chunk.Translation1 != result.Translation || chunk.Reflection != "Greet the reader warmly." {
+		t.Errorf("refined chunk = %+v, want the previous translation and the feedback", chunk)
+	}
+	if !model.Asked("Greet the reader warmly.") {
+		t.Error("the feedback was not passed to the model")
+	}
+
+	if _, err := agent.Refine(context.Background(), req, nil, "Shorter."); err == nil {
+		t.Error("Refine without a previous translation did not fail")
+	}
+	auto := req
+	auto.SourceLang = AutoDetect
+	if _, err := agent.Refine(context.Background(), auto, result, "Shorter."); err == nil {
+		t.Error("Refine of a detected source without its detection did not fail")
+	}
+}
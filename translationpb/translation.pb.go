@@ -0,0 +1,1444 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: translation/v1/translation.proto
+
+// The translation agent as a gRPC service. Regenerate the Go code in translationpb with
+// go generate ./grpcserver.
+
+package translationpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Stage int32
+
+const (
+	Stage_STAGE_UNSPECIFIED         Stage = 0
+	Stage_STAGE_INITIAL_TRANSLATION Stage = 1
+	Stage_STAGE_REFLECTION          Stage = 2
+	Stage_STAGE_IMPROVEMENT         Stage = 3
+)
+
+// Enum value maps for Stage.
+var (
+	Stage_name = map[int32]string{
+		0: "STAGE_UNSPECIFIED",
+		1: "STAGE_INITIAL_TRANSLATION",
+		2: "STAGE_REFLECTION",
+		3: "STAGE_IMPROVEMENT",
+	}
+	Stage_value = map[string]int32{
+		"STAGE_UNSPECIFIED":         0,
+		"STAGE_INITIAL_TRANSLATION": 1,
+		"STAGE_REFLECTION":          2,
+		"STAGE_IMPROVEMENT":         3,
+	}
+)
+
+func (x Stage) Enum() *Stage {
+	p := new(Stage)
+	*p = x
+	return p
+}
+
+func (x Stage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Stage) Descriptor() protoreflect.EnumDescriptor {
+	return file_translation_v1_translation_proto_enumTypes[0].Descriptor()
+}
+
+func (Stage) Type() protoreflect.EnumType {
+	return &file_translation_v1_translation_proto_enumTypes[0]
+}
+
+func (x Stage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Stage.Descriptor instead.
+func (Stage) EnumDescriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{0}
+}
+
+type JobStatus int32
+
+const (
+	JobStatus_JOB_STATUS_UNSPECIFIED JobStatus = 0
+	JobStatus_JOB_STATUS_QUEUED      JobStatus = 1
+	JobStatus_JOB_STATUS_RUNNING     JobStatus = 2
+	JobStatus_JOB_STATUS_SUCCEEDED   JobStatus = 3
+	JobStatus_JOB_STATUS_FAILED      JobStatus = 4
+	JobStatus_JOB_STATUS_CANCELED    JobStatus = 5
+)
+
+// Enum value maps for JobStatus.
+var (
+	JobStatus_name = map[int32]string{
+		0: "JOB_STATUS_UNSPECIFIED",
+		1: "JOB_STATUS_QUEUED",
+		2: "JOB_STATUS_RUNNING",
+		3: "JOB_STATUS_SUCCEEDED",
+		4: "JOB_STATUS_FAILED",
+		5: "JOB_STATUS_CANCELED",
+	}
+	JobStatus_value = map[string]int32{
+		"JOB_STATUS_UNSPECIFIED": 0,
+		"JOB_STATUS_QUEUED":      1,
+		"JOB_STATUS_RUNNING":     2,
+		"JOB_STATUS_SUCCEEDED":   3,
+		"JOB_STATUS_FAILED":      4,
+		"JOB_STATUS_CANCELED":    5,
+	}
+)
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+
+func (x JobStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_translation_v1_translation_proto_enumTypes[1].Descriptor()
+}
+
+func (JobStatus) Type() protoreflect.EnumType {
+	return &file_translation_v1_translation_proto_enumTypes[1]
+}
+
+func (x JobStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobStatus.Descriptor instead.
+func (JobStatus) EnumDescriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{1}
+}
+
+type TranslationEvent_Type int32
+
+const (
+	TranslationEvent_TYPE_UNSPECIFIED TranslationEvent_Type = 0
+	// SPLIT reports the number of chunks the text was split into.
+	TranslationEvent_TYPE_SPLIT TranslationEvent_Type = 1
+	// STAGE_STARTED reports that a stage starts on a chunk.
+	TranslationEvent_TYPE_STAGE_STARTED TranslationEvent_Type = 2
+	// TOKEN carries a piece of a completion as the model streams it.
+	TranslationEvent_TYPE_TOKEN TranslationEvent_Type = 3
+	// RETRY reports that a completion lost placeholders, so its tokens are discarded.
+	TranslationEvent_TYPE_RETRY TranslationEvent_Type = 4
+	// DRAFT, REFLECTION and FINAL carry the output of the stages of a chunk.
+	TranslationEvent_TYPE_DRAFT      TranslationEvent_Type = 5
+	TranslationEvent_TYPE_REFLECTION TranslationEvent_Type = 6
+	TranslationEvent_TYPE_FINAL      TranslationEvent_Type = 7
+	// DONE ends the stream with the result and usage.
+	TranslationEvent_TYPE_DONE TranslationEvent_Type = 8
+)
+
+// Enum value maps for TranslationEvent_Type.
+var (
+	TranslationEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_SPLIT",
+		2: "TYPE_STAGE_STARTED",
+		3: "TYPE_TOKEN",
+		4: "TYPE_RETRY",
+		5: "TYPE_DRAFT",
+		6: "TYPE_REFLECTION",
+		7: "TYPE_FINAL",
+		8: "TYPE_DONE",
+	}
+	TranslationEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED":   0,
+		"TYPE_SPLIT":         1,
+		"TYPE_STAGE_STARTED": 2,
+		"TYPE_TOKEN":         3,
+		"TYPE_RETRY":         4,
+		"TYPE_DRAFT":         5,
+		"TYPE_REFLECTION":    6,
+		"TYPE_FINAL":         7,
+		"TYPE_DONE":          8,
+	}
+)
+
+func (x TranslationEvent_Type) Enum() *TranslationEvent_Type {
+	p := new(TranslationEvent_Type)
+	*p = x
+	return p
+}
+
+func (x TranslationEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TranslationEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_translation_v1_translation_proto_enumTypes[2].Descriptor()
+}
+
+func (TranslationEvent_Type) Type() protoreflect.EnumType {
+	return &file_translation_v1_translation_proto_enumTypes[2]
+}
+
+func (x TranslationEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TranslationEvent_Type.Descriptor instead.
+func (TranslationEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{6, 0}
+}
+
+type TranslateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// source_lang is detected when it is empty or "auto".
+	SourceLang string `protobuf:"bytes,1,opt,name=source_lang,json=sourceLang,proto3" json:"source_lang,omitempty"`
+	TargetLang string `protobuf:"bytes,2,opt,name=target_lang,json=targetLang,proto3" json:"target_lang,omitempty"`
+	SourceText string `protobuf:"bytes,3,opt,name=source_text,json=sourceText,proto3" json:"source_text,omitempty"`
+	// country is the region whose variant of the target language is wanted.
+	Country string `protobuf:"bytes,4,opt,name=country,proto3" json:"country,omitempty"`
+	// pivot_lang, such as English, is a language the text is translated into first.
+	PivotLang string `protobuf:"bytes,5,opt,name=pivot_lang,json=pivotLang,proto3" json:"pivot_lang,omitempty"`
+	// style names a style profile of the server.
+	Style string `protobuf:"bytes,6,opt,name=style,proto3" json:"style,omitempty"`
+	// formality is default, more, less, prefer_more or prefer_less, as in the DeepL API.
+	Formality     string `protobuf:"bytes,7,opt,name=formality,proto3" json:"formality,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TranslateRequest) Reset() {
+	*x = TranslateRequest{}
+	mi := &file_translation_v1_translation_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TranslateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TranslateRequest) ProtoMessage() {}
+
+func (x *TranslateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TranslateRequest.ProtoReflect.Descriptor instead.
+func (*TranslateRequest) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TranslateRequest) GetSourceLang() string {
+	if x != nil {
+		return x.SourceLang
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetTargetLang() string {
+	if x != nil {
+		return x.TargetLang
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetSourceText() string {
+	if x != nil {
+		return x.SourceText
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetPivotLang() string {
+	if x != nil {
+		return x.PivotLang
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetStyle() string {
+	if x != nil {
+		return x.Style
+	}
+	return ""
+}
+
+func (x *TranslateRequest) GetFormality() string {
+	if x != nil {
+		return x.Formality
+	}
+	return ""
+}
+
+type TranslateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Result        *TranslationResult     `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	Usage         *Usage                 `protobuf:"bytes,2,opt,name=usage,proto3" json:"usage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TranslateResponse) Reset() {
+	*x = TranslateResponse{}
+	mi := &file_translation_v1_translation_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TranslateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TranslateResponse) ProtoMessage() {}
+
+func (x *TranslateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TranslateResponse.ProtoReflect.Descriptor instead.
+func (*TranslateResponse) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *TranslateResponse) GetResult() *TranslationResult {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *TranslateResponse) GetUsage() *Usage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+type TranslationResult struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Translation string                 `protobuf:"bytes,1,opt,name=translation,proto3" json:"translation,omitempty"`
+	Chunks      []*ChunkResult         `protobuf:"bytes,2,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	// detected_source_lang is set when the source language was detected.
+	DetectedSourceLang *Detection `protobuf:"bytes,3,opt,name=detected_source_lang,json=detectedSourceLang,proto3" json:"detected_source_lang,omitempty"`
+	// skipped reports that the text was already in the target language.
+	Skipped bool `protobuf:"varint,4,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	// pivot is the first leg of a pivot translation, into pivot_lang. The chunks then
+	// translate the pivot text.
+	Pivot         *TranslationResult `protobuf:"bytes,5,opt,name=pivot,proto3" json:"pivot,omitempty"`
+	PivotLang     string             `protobuf:"bytes,6,opt,name=pivot_lang,json=pivotLang,proto3" json:"pivot_lang,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TranslationResult) Reset() {
+	*x = TranslationResult{}
+	mi := &file_translation_v1_translation_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TranslationResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TranslationResult) ProtoMessage() {}
+
+func (x *TranslationResult) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TranslationResult.ProtoReflect.Descriptor instead.
+func (*TranslationResult) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TranslationResult) GetTranslation() string {
+	if x != nil {
+		return x.Translation
+	}
+	return ""
+}
+
+func (x *TranslationResult) GetChunks() []*ChunkResult {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+func (x *TranslationResult) GetDetectedSourceLang() *Detection {
+	if x != nil {
+		return x.DetectedSourceLang
+	}
+	return nil
+}
+
+func (x *TranslationResult) GetSkipped() bool {
+	if x != nil {
+		return x.Skipped
+	}
+	return false
+}
+
+func (x *TranslationResult) GetPivot() *TranslationResult {
+	if x != nil {
+		return x.Pivot
+	}
+	return nil
+}
+
+func (x *TranslationResult) GetPivotLang() string {
+	if x != nil {
+		return x.PivotLang
+	}
+	return ""
+}
+
+// Detection is the detected language of a text.
+type Detection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// code is a language code such as "fr" or "zh-Hant", and language its English name.
+	Code     string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Language string `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`
+	// confidence is between 0 and 1.
+	Confidence float64 `protobuf:"fixed64,3,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	// method is "script", "ngram" or "model".
+	Method        string `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Detection) Reset() {
+	*x = Detection{}
+	mi := &file_translation_v1_translation_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Detection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Detection) ProtoMessage() {}
+
+func (x *Detection) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Detection.ProtoReflect.Descriptor instead.
+func (*Detection) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Detection) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Detection) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *Detection) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Detection) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+// ChunkResult holds the steps of a chunk of a text.
+type ChunkResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SourceText    string                 `protobuf:"bytes,1,opt,name=source_text,json=sourceText,proto3" json:"source_text,omitempty"`
+	Translation1  string                 `protobuf:"bytes,2,opt,name=translation1,proto3" json:"translation1,omitempty"`
+	Reflection    string                 `protobuf:"bytes,3,opt,name=reflection,proto3" json:"reflection,omitempty"`
+	Translation2  string                 `protobuf:"bytes,4,opt,name=translation2,proto3" json:"translation2,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkResult) Reset() {
+	*x = ChunkResult{}
+	mi := &file_translation_v1_translation_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkResult) ProtoMessage() {}
+
+func (x *ChunkResult) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkResult.ProtoReflect.Descriptor instead.
+func (*ChunkResult) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ChunkResult) GetSourceText() string {
+	if x != nil {
+		return x.SourceText
+	}
+	return ""
+}
+
+func (x *ChunkResult) GetTranslation1() string {
+	if x != nil {
+		return x.Translation1
+	}
+	return ""
+}
+
+func (x *ChunkResult) GetReflection() string {
+	if x != nil {
+		return x.Reflection
+	}
+	return ""
+}
+
+func (x *ChunkResult) GetTranslation2() string {
+	if x != nil {
+		return x.Translation2
+	}
+	return ""
+}
+
+// Usage counts the completion requests of a translation and the tokens they used.
+type Usage struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Requests         int64                  `protobuf:"varint,1,opt,name=requests,proto3" json:"requests,omitempty"`
+	PromptTokens     int64                  `protobuf:"varint,2,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	CompletionTokens int64                  `protobuf:"varint,3,opt,name=completion_tokens,json=completionTokens,proto3" json:"completion_tokens,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Usage) Reset() {
+	*x = Usage{}
+	mi := &file_translation_v1_translation_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Usage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Usage) ProtoMessage() {}
+
+func (x *Usage) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Usage.ProtoReflect.Descriptor instead.
+func (*Usage) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Usage) GetRequests() int64 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+func (x *Usage) GetPromptTokens() int64 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetCompletionTokens() int64 {
+	if x != nil {
+		return x.CompletionTokens
+	}
+	return 0
+}
+
+// TranslationEvent reports the progress of a translation. A failed translation ends the
+// stream with an error status instead of an event.
+type TranslationEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  TranslationEvent_Type  `protobuf:"varint,1,opt,name=type,proto3,enum=translation.v1.TranslationEvent_Type" json:"type,omitempty"`
+	Stage Stage                  `protobuf:"varint,2,opt,name=stage,proto3,enum=translation.v1.Stage" json:"stage,omitempty"`
+	// chunk is the number of the chunk, starting at 1, and chunks their count.
+	Chunk  int32              `protobuf:"varint,3,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	Chunks int32              `protobuf:"varint,4,opt,name=chunks,proto3" json:"chunks,omitempty"`
+	Text   string             `protobuf:"bytes,5,opt,name=text,proto3" json:"text,omitempty"`
+	Result *TranslationResult `protobuf:"bytes,6,opt,name=result,proto3" json:"result,omitempty"`
+	Usage  *Usage             `protobuf:"bytes,7,opt,name=usage,proto3" json:"usage,omitempty"`
+	// target_lang is the pivot language for the events of the first leg of a pivot
+	// translation, and empty otherwise.
+	TargetLang    string `protobuf:"bytes,8,opt,name=target_lang,json=targetLang,proto3" json:"target_lang,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TranslationEvent) Reset() {
+	*x = TranslationEvent{}
+	mi := &file_translation_v1_translation_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TranslationEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TranslationEvent) ProtoMessage() {}
+
+func (x *TranslationEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TranslationEvent.ProtoReflect.Descriptor instead.
+func (*TranslationEvent) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TranslationEvent) GetType() TranslationEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return TranslationEvent_TYPE_UNSPECIFIED
+}
+
+func (x *TranslationEvent) GetStage() Stage {
+	if x != nil {
+		return x.Stage
+	}
+	return Stage_STAGE_UNSPECIFIED
+}
+
+func (x *TranslationEvent) GetChunk() int32 {
+	if x != nil {
+		return x.Chunk
+	}
+	return 0
+}
+
+func (x *TranslationEvent) GetChunks() int32 {
+	if x != nil {
+		return x.Chunks
+	}
+	return 0
+}
+
+func (x *TranslationEvent) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *TranslationEvent) GetResult() *TranslationResult {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *TranslationEvent) GetUsage() *Usage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *TranslationEvent) GetTargetLang() string {
+	if x != nil {
+		return x.TargetLang
+	}
+	return ""
+}
+
+type Job struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status     JobStatus              `protobuf:"varint,2,opt,name=status,proto3,enum=translation.v1.JobStatus" json:"status,omitempty"`
+	Request    *TranslateRequest      `protobuf:"bytes,3,opt,name=request,proto3" json:"request,omitempty"`
+	Result     *TranslationResult     `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	Usage      *Usage                 `protobuf:"bytes,5,opt,name=usage,proto3" json:"usage,omitempty"`
+	Error      string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt  *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	StartedAt  *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Tenant     string                 `protobuf:"bytes,10,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	// priority orders the queued jobs, higher first.
+	Priority int32 `protobuf:"varint,11,opt,name=priority,proto3" json:"priority,omitempty"`
+	// callback_url receives the job once it finished, and deliveries log the attempts.
+	CallbackUrl string `protobuf:"bytes,12,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
+	// callback_status is "pending", "delivered" or "failed".
+	CallbackStatus string      `protobuf:"bytes,13,opt,name=callback_status,json=callbackStatus,proto3" json:"callback_status,omitempty"`
+	Deliveries     []*Delivery `protobuf:"bytes,14,rep,name=deliveries,proto3" json:"deliveries,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_translation_v1_translation_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *Job) GetRequest() *TranslateRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *Job) GetResult() *TranslationResult {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *Job) GetUsage() *Usage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Job) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Job) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Job) GetTenant() string {
+	if x != nil {
+		return x.Tenant
+	}
+	return ""
+}
+
+func (x *Job) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Job) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+func (x *Job) GetCallbackStatus() string {
+	if x != nil {
+		return x.CallbackStatus
+	}
+	return ""
+}
+
+func (x *Job) GetDeliveries() []*Delivery {
+	if x != nil {
+		return x.Deliveries
+	}
+	return nil
+}
+
+// Delivery is an attempt to deliver the callback of a job.
+type Delivery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Attempt       int32                  `protobuf:"varint,1,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,3,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,5,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Delivery) Reset() {
+	*x = Delivery{}
+	mi := &file_translation_v1_translation_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Delivery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Delivery) ProtoMessage() {}
+
+func (x *Delivery) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Delivery.ProtoReflect.Descriptor instead.
+func (*Delivery) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Delivery) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *Delivery) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Delivery) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *Delivery) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Delivery) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+type CreateJobRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Request *TranslateRequest      `protobuf:"bytes,1,opt,name=request,proto3" json:"request,omitempty"`
+	// priority orders the queued jobs, higher first.
+	Priority int32 `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	// callback_url is posted the job once it finished.
+	CallbackUrl   string `protobuf:"bytes,3,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateJobRequest) Reset() {
+	*x = CreateJobRequest{}
+	mi := &file_translation_v1_translation_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateJobRequest) ProtoMessage() {}
+
+func (x *CreateJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateJobRequest.ProtoReflect.Descriptor instead.
+func (*CreateJobRequest) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CreateJobRequest) GetRequest() *TranslateRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *CreateJobRequest) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *CreateJobRequest) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_translation_v1_translation_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListJobsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_translation_v1_translation_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{11}
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_translation_v1_translation_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type CancelJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobRequest) Reset() {
+	*x = CancelJobRequest{}
+	mi := &file_translation_v1_translation_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobRequest) ProtoMessage() {}
+
+func (x *CancelJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_translation_v1_translation_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelJobRequest) Descriptor() ([]byte, []int) {
+	return file_translation_v1_translation_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *CancelJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+var File_translation_v1_translation_proto protoreflect.FileDescriptor
+
+const file_translation_v1_translation_proto_rawDesc = "" +
+	"\n" +
+	" translation/v1/translation.proto\x12\x0etranslation.v1\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\"\xe2\x01\n" +
+	"\x10TranslateRequest\x12\x1f\n" +
+	"\vsource_lang\x18\x01 \x01(\tR\n" +
+	"sourceLang\x12\x1f\n" +
+	"\vtarget_lang\x18\x02 \x01(\tR\n" +
+	"targetLang\x12\x1f\n" +
+	"\vsource_text\x18\x03 \x01(\tR\n" +
+	"sourceText\x12\x18\n" +
+	"\acountry\x18\x04 \x01(\tR\acountry\x12\x1d\n" +
+	"\n" +
+	"pivot_lang\x18\x05 \x01(\tR\tpivotLang\x12\x14\n" +
+	"\x05style\x18\x06 \x01(\tR\x05style\x12\x1c\n" +
+	"\tformality\x18\a \x01(\tR\tformality\"{\n" +
+	"\x11TranslateResponse\x129\n" +
+	"\x06result\x18\x01 \x01(\v2!.translation.v1.TranslationResultR\x06result\x12+\n" +
+	"\x05usage\x18\x02 \x01(\v2\x15.translation.v1.UsageR\x05usage\"\xa9\x02\n" +
+	"\x11TranslationResult\x12 \n" +
+	"\vtranslation\x18\x01 \x01(\tR\vtranslation\x123\n" +
+	"\x06chunks\x18\x02 \x03(\v2\x1b.translation.v1.ChunkResultR\x06chunks\x12K\n" +
+	"\x14detected_source_lang\x18\x03 \x01(\v2\x19.translation.v1.DetectionR\x12detectedSourceLang\x12\x18\n" +
+	"\askipped\x18\x04 \x01(\bR\askipped\x127\n" +
+	"\x05pivot\x18\x05 \x01(\v2!.translation.v1.TranslationResultR\x05pivot\x12\x1d\n" +
+	"\n" +
+	"pivot_lang\x18\x06 \x01(\tR\tpivotLang\"s\n" +
+	"\tDetection\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x03 \x01(\x01R\n" +
+	"confidence\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\"\x96\x01\n" +
+	"\vChunkResult\x12\x1f\n" +
+	"\vsource_text\x18\x01 \x01(\tR\n" +
+	"sourceText\x12\"\n" +
+	"\ftranslation1\x18\x02 \x01(\tR\ftranslation1\x12\x1e\n" +
+	"\n" +
+	"reflection\x18\x03 \x01(\tR\n" +
+	"reflection\x12\"\n" +
+	"\ftranslation2\x18\x04 \x01(\tR\ftranslation2\"u\n" +
+	"\x05Usage\x12\x1a\n" +
+	"\brequests\x18\x01 \x01(\x03R\brequests\x12#\n" +
+	"\rprompt_tokens\x18\x02 \x01(\x03R\fpromptTokens\x12+\n" +
+	"\x11completion_tokens\x18\x03 \x01(\x03R\x10completionTokens\"\xf0\x03\n" +
+	"\x10TranslationEvent\x129\n" +
+	"\x04type\x18\x01 \x01(\x0e2%.translation.v1.TranslationEvent.TypeR\x04type\x12+\n" +
+	"\x05stage\x18\x02 \x01(\x0e2\x15.translation.v1.StageR\x05stage\x12\x14\n" +
+	"\x05chunk\x18\x03 \x01(\x05R\x05chunk\x12\x16\n" +
+	"\x06chunks\x18\x04 \x01(\x05R\x06chunks\x12\x12\n" +
+	"\x04text\x18\x05 \x01(\tR\x04text\x129\n" +
+	"\x06result\x18\x06 \x01(\v2!.translation.v1.TranslationResultR\x06result\x12+\n" +
+	"\x05usage\x18\a \x01(\v2\x15.translation.v1.UsageR\x05usage\x12\x1f\n" +
+	"\vtarget_lang\x18\b \x01(\tR\n" +
+	"targetLang\"\xa8\x01\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x0e\n" +
+	"\n" +
+	"TYPE_SPLIT\x10\x01\x12\x16\n" +
+	"\x12TYPE_STAGE_STARTED\x10\x02\x12\x0e\n" +
+	"\n" +
+	"TYPE_TOKEN\x10\x03\x12\x0e\n" +
+	"\n" +
+	"TYPE_RETRY\x10\x04\x12\x0e\n" +
+	"\n" +
+	"TYPE_DRAFT\x10\x05\x12\x13\n" +
+	"\x0fTYPE_REFLECTION\x10\x06\x12\x0e\n" +
+	"\n" +
+	"TYPE_FINAL\x10\a\x12\r\n" +
+	"\tTYPE_DONE\x10\b\"\xef\x04\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x121\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x19.translation.v1.JobStatusR\x06status\x12:\n" +
+	"\arequest\x18\x03 \x01(\v2 .translation.v1.TranslateRequestR\arequest\x129\n" +
+	"\x06result\x18\x04 \x01(\v2!.translation.v1.TranslationResultR\x06result\x12+\n" +
+	"\x05usage\x18\x05 \x01(\v2\x15.translation.v1.UsageR\x05usage\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"started_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x16\n" +
+	"\x06tenant\x18\n" +
+	" \x01(\tR\x06tenant\x12\x1a\n" +
+	"\bpriority\x18\v \x01(\x05R\bpriority\x12!\n" +
+	"\fcallback_url\x18\f \x01(\tR\vcallbackUrl\x12'\n" +
+	"\x0fcallback_status\x18\r \x01(\tR\x0ecallbackStatus\x128\n" +
+	"\n" +
+	"deliveries\x18\x0e \x03(\v2\x18.translation.v1.DeliveryR\n" +
+	"deliveries\"\xc2\x01\n" +
+	"\bDelivery\x12\x18\n" +
+	"\aattempt\x18\x01 \x01(\x05R\aattempt\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1f\n" +
+	"\vstatus_code\x18\x03 \x01(\x05R\n" +
+	"statusCode\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x125\n" +
+	"\bduration\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\bduration\"\x8d\x01\n" +
+	"\x10CreateJobRequest\x12:\n" +
+	"\arequest\x18\x01 \x01(\v2 .translation.v1.TranslateRequestR\arequest\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\x05R\bpriority\x12!\n" +
+	"\fcallback_url\x18\x03 \x01(\tR\vcallbackUrl\"\x1f\n" +
+	"\rGetJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x11\n" +
+	"\x0fListJobsRequest\";\n" +
+	"\x10ListJobsResponse\x12'\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x13.translation.v1.JobR\x04jobs\"\"\n" +
+	"\x10CancelJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id*j\n" +
+	"\x05Stage\x12\x15\n" +
+	"\x11STAGE_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19STAGE_INITIAL_TRANSLATION\x10\x01\x12\x14\n" +
+	"\x10STAGE_REFLECTION\x10\x02\x12\x15\n" +
+	"\x11STAGE_IMPROVEMENT\x10\x03*\xa0\x01\n" +
+	"\tJobStatus\x12\x1a\n" +
+	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11JOB_STATUS_QUEUED\x10\x01\x12\x16\n" +
+	"\x12JOB_STATUS_RUNNING\x10\x02\x12\x18\n" +
+	"\x14JOB_STATUS_SUCCEEDED\x10\x03\x12\x15\n" +
+	"\x11JOB_STATUS_FAILED\x10\x04\x12\x17\n" +
+	"\x13JOB_STATUS_CANCELED\x10\x052\xd4\x03\n" +
+	"\x12TranslationService\x12P\n" +
+	"\tTranslate\x12 .translation.v1.TranslateRequest\x1a!.translation.v1.TranslateResponse\x12W\n" +
+	"\x0fTranslateStream\x12 .translation.v1.TranslateRequest\x1a .translation.v1.TranslationEvent0\x01\x12B\n" +
+	"\tCreateJob\x12 .translation.v1.CreateJobRequest\x1a\x13.translation.v1.Job\x12<\n" +
+	"\x06GetJob\x12\x1d.translation.v1.GetJobRequest\x1a\x13.translation.v1.Job\x12M\n" +
+	"\bListJobs\x12\x1f.translation.v1.ListJobsRequest\x1a .translation.v1.ListJobsResponse\x12B\n" +
+	"\tCancelJob\x12 .translation.v1.CancelJobRequest\x1a\x13.translation.v1.JobB6Z4github.com/zaigie/translation-agent-go/translationpbb\x06proto3"
+
+var (
+	file_translation_v1_translation_proto_rawDescOnce sync.Once
+	file_translation_v1_translation_proto_rawDescData []byte
+)
+
+func file_translation_v1_translation_proto_rawDescGZIP() []byte {
+	file_translation_v1_translation_proto_rawDescOnce.Do(func() {
+		file_translation_v1_translation_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_translation_v1_translation_proto_rawDesc), len(file_translation_v1_translation_proto_rawDesc)))
+	})
+	return file_translation_v1_translation_proto_rawDescData
+}
+
+var file_translation_v1_translation_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_translation_v1_translation_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_translation_v1_translation_proto_goTypes = []any{
+	(Stage)(0),                    // 0: translation.v1.Stage
+	(JobStatus)(0),                // 1: translation.v1.JobStatus
+	(TranslationEvent_Type)(0),    // 2: translation.v1.TranslationEvent.Type
+	(*TranslateRequest)(nil),      // 3: translation.v1.TranslateRequest
+	(*TranslateResponse)(nil),     // 4: translation.v1.TranslateResponse
+	(*TranslationResult)(nil),     // 5: translation.v1.TranslationResult
+	(*Detection)(nil),             // 6: translation.v1.Detection
+	(*ChunkResult)(nil),           // 7: translation.v1.ChunkResult
+	(*Usage)(nil),                 // 8: translation.v1.Usage
+	(*TranslationEvent)(nil),      // 9: translation.v1.TranslationEvent
+	(*Job)(nil),                   // 10: translation.v1.Job
+	(*Delivery)(nil),              // 11: translation.v1.Delivery
+	(*CreateJobRequest)(nil),      // 12: translation.v1.CreateJobRequest
+	(*GetJobRequest)(nil),         // 13: translation.v1.GetJobRequest
+	(*ListJobsRequest)(nil),       // 14: translation.v1.ListJobsRequest
+	(*ListJobsResponse)(nil),      // 15: translation.v1.ListJobsResponse
+	(*CancelJobRequest)(nil),      // 16: translation.v1.CancelJobRequest
+	(*timestamppb.Timestamp)(nil), // 17: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 18: google.protobuf.Duration
+}
+var file_translation_v1_translation_proto_depIdxs = []int32{
+	5,  // 0: translation.v1.TranslateResponse.result:type_name -> translation.v1.TranslationResult
+	8,  // 1: translation.v1.TranslateResponse.usage:type_name -> translation.v1.Usage
+	7,  // 2: translation.v1.TranslationResult.chunks:type_name -> translation.v1.ChunkResult
+	6,  // 3: translation.v1.TranslationResult.detected_source_lang:type_name -> translation.v1.Detection
+	5,  // 4: translation.v1.TranslationResult.pivot:type_name -> translation.v1.TranslationResult
+	2,  // 5: translation.v1.TranslationEvent.type:type_name -> translation.v1.TranslationEvent.Type
+	0,  // 6: translation.v1.TranslationEvent.stage:type_name -> translation.v1.Stage
+	5,  // 7: translation.v1.TranslationEvent.result:type_name -> translation.v1.TranslationResult
+	8,  // 8: translation.v1.TranslationEvent.usage:type_name -> translation.v1.Usage
+	1,  // 9: translation.v1.Job.status:type_name -> translation.v1.JobStatus
+	3,  // 10: translation.v1.Job.request:type_name -> translation.v1.TranslateRequest
+	5,  // 11: translation.v1.Job.result:type_name -> translation.v1.TranslationResult
+	8,  // 12: translation.v1.Job.usage:type_name -> translation.v1.Usage
+	17, // 13: translation.v1.Job.created_at:type_name -> google.protobuf.Timestamp
+	17, // 14: translation.v1.Job.started_at:type_name -> google.protobuf.Timestamp
+	17, // 15: translation.v1.Job.finished_at:type_name -> google.protobuf.Timestamp
+	11, // 16: translation.v1.Job.deliveries:type_name -> translation.v1.Delivery
+	17, // 17: translation.v1.Delivery.time:type_name -> google.protobuf.Timestamp
+	18, // 18: translation.v1.Delivery.duration:type_name -> google.protobuf.Duration
+	3,  // 19: translation.v1.CreateJobRequest.request:type_name -> translation.v1.TranslateRequest
+	10, // 20: translation.v1.ListJobsResponse.jobs:type_name -> translation.v1.Job
+	3,  // 21: translation.v1.TranslationService.Translate:input_type -> translation.v1.TranslateRequest
+	3,  // 22: translation.v1.TranslationService.TranslateStream:input_type -> translation.v1.TranslateRequest
+	12, // 23: translation.v1.TranslationService.CreateJob:input_type -> translation.v1.CreateJobRequest
+	13, // 24: translation.v1.TranslationService.GetJob:input_type -> translation.v1.GetJobRequest
+	14, // 25: translation.v1.TranslationService.ListJobs:input_type -> translation.v1.ListJobsRequest
+	16, // 26: translation.v1.TranslationService.CancelJob:input_type -> translation.v1.CancelJobRequest
+	4,  // 27: translation.v1.TranslationService.Translate:output_type -> translation.v1.TranslateResponse
+	9,  // 28: translation.v1.TranslationService.TranslateStream:output_type -> translation.v1.TranslationEvent
+	10, // 29: translation.v1.TranslationService.CreateJob:output_type -> translation.v1.Job
+	10, // 30: translation.v1.TranslationService.GetJob:output_type -> translation.v1.Job
+	15, // 31: translation.v1.TranslationService.ListJobs:output_type -> translation.v1.ListJobsResponse
+	10, // 32: translation.v1.TranslationService.CancelJob:output_type -> translation.v1.Job
+	27, // [27:33] is the sub-list for method output_type
+	21, // [21:27] is the sub-list for method input_type
+	21, // [21:21] is the sub-list for extension type_name
+	21, // [21:21] is the sub-list for extension extendee
+	0,  // [0:21] is the sub-list for field type_name
+}
+
+func init() { file_translation_v1_translation_proto_init() }
+func file_translation_v1_translation_proto_init() {
+	if File_translation_v1_translation_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_translation_v1_translation_proto_rawDesc), len(file_translation_v1_translation_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_translation_v1_translation_proto_goTypes,
+		DependencyIndexes: file_translation_v1_translation_proto_depIdxs,
+		EnumInfos:         file_translation_v1_translation_proto_enumTypes,
+		MessageInfos:      file_translation_v1_translation_proto_msgTypes,
+	}.Build()
+	File_translation_v1_translation_proto = out.File
+	file_translation_v1_translation_proto_goTypes = nil
+	file_translation_v1_translation_proto_depIdxs = nil
+}
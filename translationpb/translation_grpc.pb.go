@@ -0,0 +1,338 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: translation/v1/translation.proto
+
+// The translation agent as a gRPC service. Regenerate the Go code in translationpb with
+// go generate ./grpcserver.
+
+package translationpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TranslationService_Translate_FullMethodName       = "/translation.v1.TranslationService/Translate"
+	TranslationService_TranslateStream_FullMethodName = "/translation.v1.TranslationService/TranslateStream"
+	TranslationService_CreateJob_FullMethodName       = "/translation.v1.TranslationService/CreateJob"
+	TranslationService_GetJob_FullMethodName          = "/translation.v1.TranslationService/GetJob"
+	TranslationService_ListJobs_FullMethodName        = "/translation.v1.TranslationService/ListJobs"
+	TranslationService_CancelJob_FullMethodName       = "/translation.v1.TranslationService/CancelJob"
+)
+
+// TranslationServiceClient is the client API for TranslationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TranslationService translates texts with the initial translation, reflection and
+// improvement steps of the agent.
+type TranslationServiceClient interface {
+	// Translate translates a text and returns the result of every step.
+	Translate(ctx context.Context, in *TranslateRequest, opts ...grpc.CallOption) (*TranslateResponse, error)
+	// TranslateStream translates a text and streams its progress, ending with a DONE event
+	// holding the result and its usage.
+	TranslateStream(ctx context.Context, in *TranslateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TranslationEvent], error)
+	// CreateJob queues a translation, for long documents.
+	CreateJob(ctx context.Context, in *CreateJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// GetJob returns a job and, once it succeeded, its result.
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// ListJobs returns the jobs of the tenant kept by the server, oldest first.
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// CancelJob cancels a queued or running job.
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type translationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTranslationServiceClient(cc grpc.ClientConnInterface) TranslationServiceClient {
+	return &translationServiceClient{cc}
+}
+
+func (c *translationServiceClient) Translate(ctx context.Context, in *TranslateRequest, opts ...grpc.CallOption) (*TranslateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TranslateResponse)
+	err := c.cc.Invoke(ctx, TranslationService_Translate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) TranslateStream(ctx context.Context, in *TranslateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TranslationEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TranslationService_ServiceDesc.Streams[0], TranslationService_TranslateStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TranslateRequest, TranslationEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TranslationService_TranslateStreamClient = grpc.ServerStreamingClient[TranslationEvent]
+
+func (c *translationServiceClient) CreateJob(ctx context.Context, in *CreateJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, TranslationService_CreateJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, TranslationService_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, TranslationService_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, TranslationService_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TranslationServiceServer is the server API for TranslationService service.
+// All implementations must embed UnimplementedTranslationServiceServer
+// for forward compatibility.
+//
+// TranslationService translates texts with the initial translation, reflection and
+// improvement steps of the agent.
+type TranslationServiceServer interface {
+	// Translate translates a text and returns the result of every step.
+	Translate(context.Context, *TranslateRequest) (*TranslateResponse, error)
+	// TranslateStream translates a text and streams its progress, ending with a DONE event
+	// holding the result and its usage.
+	TranslateStream(*TranslateRequest, grpc.ServerStreamingServer[TranslationEvent]) error
+	// CreateJob queues a translation, for long documents.
+	CreateJob(context.Context, *CreateJobRequest) (*Job, error)
+	// GetJob returns a job and, once it succeeded, its result.
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// ListJobs returns the jobs of the tenant kept by the server, oldest first.
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// CancelJob cancels a queued or running job.
+	CancelJob(context.Context, *CancelJobRequest) (*Job, error)
+	mustEmbedUnimplementedTranslationServiceServer()
+}
+
+// UnimplementedTranslationServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTranslationServiceServer struct{}
+
+func (UnimplementedTranslationServiceServer) Translate(context.Context, *TranslateRequest) (*TranslateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Translate not implemented")
+}
+func (UnimplementedTranslationServiceServer) TranslateStream(*TranslateRequest, grpc.ServerStreamingServer[TranslationEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method TranslateStream not implemented")
+}
+func (UnimplementedTranslationServiceServer) CreateJob(context.Context, *CreateJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateJob not implemented")
+}
+func (UnimplementedTranslationServiceServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedTranslationServiceServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedTranslationServiceServer) CancelJob(context.Context, *CancelJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedTranslationServiceServer) mustEmbedUnimplementedTranslationServiceServer() {}
+func (UnimplementedTranslationServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeTranslationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TranslationServiceServer will
+// result in compilation errors.
+type UnsafeTranslationServiceServer interface {
+	mustEmbedUnimplementedTranslationServiceServer()
+}
+
+func RegisterTranslationServiceServer(s grpc.ServiceRegistrar, srv TranslationServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTranslationServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TranslationService_ServiceDesc, srv)
+}
+
+func _TranslationService_Translate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TranslateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).Translate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_Translate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).Translate(ctx, req.(*TranslateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_TranslateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TranslateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TranslationServiceServer).TranslateStream(m, &grpc.GenericServerStream[TranslateRequest, TranslationEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TranslationService_TranslateStreamServer = grpc.ServerStreamingServer[TranslationEvent]
+
+func _TranslationService_CreateJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).CreateJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_CreateJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).CreateJob(ctx, req.(*CreateJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TranslationService_ServiceDesc is the grpc.ServiceDesc for TranslationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TranslationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "translation.v1.TranslationService",
+	HandlerType: (*TranslationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Translate",
+			Handler:    _TranslationService_Translate_Handler,
+		},
+		{
+			MethodName: "CreateJob",
+			Handler:    _TranslationService_CreateJob_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _TranslationService_GetJob_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _TranslationService_ListJobs_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _TranslationService_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TranslateStream",
+			Handler:       _TranslationService_TranslateStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "translation/v1/translation.proto",
+}
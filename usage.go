@@ -0,0 +1,42 @@
+package internal
+
+import openai "github.com/sashabaranov/go-openai"
+
+// Usage counts the completion requests of an agent and the tokens they used.
+type Usage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// TotalTokens returns the sum of prompt and completion tokens.
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Requests:         u.Requests + other.Requests,
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+	}
+}
+
+// Usage returns the requests and tokens used by the agent so far. It is safe to call
+// while translations are running.
+func (agent *TranslationAgent) Usage() Usage {
+	agent.usageMu.Lock()
+	defer agent.usageMu.Unlock()
+	return agent.usage
+}
+
+func (agent *TranslationAgent) addUsage(usage openai.Usage) {
+	agent.usageMu.Lock()
+	defer agent.usageMu.Unlock()
+	agent.usage = agent.usage.Add(Usage{
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	})
+}